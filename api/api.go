@@ -0,0 +1,526 @@
+// Package api exposes a node over a local HTTP/JSON API. Clients can submit transactions, query
+// the status of their transactions, fetch finalized blocks and get the status of the node.
+//
+//	POST /txs            Submit a transaction: {"tx": "<base64>"}
+//	GET  /txs/<hash>     Status of a submitted transaction, the hash is the hex encoded sha256 hash
+//	                     of the submitted bytes, i.e. of the ciphertext with client encryption
+//	GET  /blocks/<round> Finalized block of a round
+//	GET  /status         Status of the node
+//	GET  /stream?from=<round>
+//	                     Server-sent events with the finalized blocks in round order
+//
+// The status of an included or dropped transaction is kept for Config.StatusTTL, after that its
+// hash is unknown.
+package api
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	abc "github.com/sochsenreither/tardigrade/tardigrade"
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+// Statuses of a submitted transaction
+const (
+	StatusPending  = "pending"  // Transaction is in the buffer of the node
+	StatusIncluded = "included" // Transaction is part of a finalized block
+	StatusDropped  = "dropped"  // Transaction was refused by the node or evicted from its buffer
+)
+
+// Config contains the limits for admitting transactions.
+type Config struct {
+	MaxTxSize      int           // Maximum size of a transaction in bytes
+	MaxPendingTxs  int           // Transactions are dropped while the buffer holds this many transactions
+	MaxSubscribers int           // Maximum number of concurrent block streams
+	MaxTrackedTxs  int           // Maximum number of transactions whose status is kept, 0 for no limit
+	StatusTTL      time.Duration // Time the status of an included or dropped transaction is kept, 0 for no limit
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		MaxTxSize:      1024,
+		MaxPendingTxs:  100_000,
+		MaxSubscribers: 100,
+		MaxTrackedTxs:  1_000_000,
+		StatusTTL:      time.Hour,
+	}
+}
+
+// TxRequest is the body of a transaction submission.
+type TxRequest struct {
+	Tx []byte `json:"tx"`
+}
+
+// TxStatus is the status of a submitted transaction.
+type TxStatus struct {
+	Hash   string `json:"hash"`
+	Status string `json:"status"`
+	Round  *int   `json:"round,omitempty"` // Round of the block that includes the transaction
+	Error  string `json:"error,omitempty"` // Reason why the transaction was dropped
+}
+
+// Block is a finalized block.
+type Block struct {
+	Round      int      `json:"round"`
+	Height     int      `json:"height"`
+	ParentHash string   `json:"parent_hash"`
+	TxRoot     string   `json:"tx_root"`
+	Path       string   `json:"path"` // "bla" or "acs"
+	Hash       string   `json:"hash"`
+	Txs        [][]byte `json:"txs"`
+}
+
+// NodeStatus is the status of the node.
+type NodeStatus struct {
+	NodeId         int              `json:"node_id"`
+	Height         int              `json:"height"` // Number of rounds that are finalized without gaps
+	FinishedRounds int              `json:"finished_rounds"`
+	PendingTxs     int              `json:"pending_txs"`
+	SubmittedTxs   int              `json:"submitted_txs"`        // Transactions submitted over the API whose status is kept
+	DupTxsInBlock  int              `json:"dup_txs_in_block"`     // Transactions dropped as duplicates within a block
+	DupTxsInLedger int              `json:"dup_txs_in_ledger"`    // Transactions dropped as already in the ledger
+	ReplayedTxs    int              `json:"replayed_txs"`         // Envelopes dropped because their nonce was already used
+	Proposers      []ProposerStatus `json:"proposers"`            // Cumulative statistics, indexed by node id
+	LastRound      *RoundStatus     `json:"last_round,omitempty"` // Proposers of the last finished round
+}
+
+// ProposerStatus shows how many transactions of a node ended up in blocks.
+type ProposerStatus struct {
+	NodeId    int   `json:"node_id"`
+	SlotsBLA  int   `json:"slots_bla"`     // Included pre-block slots in rounds agreed on with BLA
+	SlotsACS  int   `json:"slots_acs"`     // Included pre-block slots in rounds agreed on with ACS
+	Txs       int   `json:"txs"`           // Transactions of the node in blocks
+	AvgWaitMs int64 `json:"avg_wait_ms"`   // Average time its transactions waited in the mempool
+	Missed    int   `json:"missed_rounds"` // Consecutive rounds without an included slot
+	Flagged   bool  `json:"flagged"`       // Set if the node is systematically left out
+}
+
+// RoundStatus shows whose transactions were included in the block of a round.
+type RoundStatus struct {
+	Round     int     `json:"round"`
+	Path      string  `json:"path"`        // "bla" or "acs"
+	Slots     []int   `json:"slots"`       // Included pre-block slots, indexed by node id
+	Txs       []int   `json:"txs"`         // Transactions in the block, indexed by node id
+	AvgWaitMs []int64 `json:"avg_wait_ms"` // Average wait of the transactions, indexed by node id
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// txRecord is the status of a submitted transaction. Once the status is final it is in the list of
+// final statuses and forgotten after the retention time.
+type txRecord struct {
+	TxStatus
+	hash  [32]byte
+	at    time.Time     // Time the status became final
+	final *list.Element // Entry in the list of final statuses, nil while pending
+}
+
+// Server serves the API of a node.
+type Server struct {
+	abc         *abc.ABC
+	cfg         *Config
+	mux         *http.ServeMux
+	txs         map[[32]byte]*txRecord // Maps hash -> status of the transactions submitted over the API
+	final       *list.List             // Records with a final status in the order they became final
+	height      int                    // Number of rounds that are finalized without gaps
+	subscribers int                    // Number of open block streams
+	done        chan struct{}          // Closed when the server is closed
+	now         func() time.Time       // Clock, replaceable in tests
+	sync.Mutex
+}
+
+// NewServer returns the API of node u. The server keeps track of the finalized rounds and of the
+// transactions the node includes or drops until it is closed.
+func NewServer(u *abc.ABC, cfg *Config) *Server {
+	s := &Server{
+		abc:   u,
+		cfg:   cfg,
+		mux:   http.NewServeMux(),
+		txs:   make(map[[32]byte]*txRecord),
+		final: list.New(),
+		done:  make(chan struct{}),
+		now:   time.Now,
+	}
+	u.SetDropHandler(s.dropped)
+	u.SetIncludeHandler(s.included)
+	s.mux.HandleFunc("/txs", s.handleSubmit)
+	s.mux.HandleFunc("/txs/", s.handleTxStatus)
+	s.mux.HandleFunc("/blocks/", s.handleBlock)
+	s.mux.HandleFunc("/status", s.handleStatus)
+	s.mux.HandleFunc("/stream", s.handleStream)
+	go s.trackCommits()
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close stops tracking finalized rounds and transactions and ends all block streams.
+func (s *Server) Close() {
+	s.abc.SetDropHandler(nil)
+	s.abc.SetIncludeHandler(nil)
+	close(s.done)
+}
+
+// trackCommits marks submitted transactions as included when their block is finalized. A
+// transaction that was evicted from the buffer of this node can still be included by another node.
+func (s *Server) trackCommits() {
+	for c := range s.abc.Commits(0, s.done) {
+		s.Lock()
+		for _, tx := range c.Block.Txs {
+			s.include(sha256.Sum256(tx), c.Round)
+		}
+		s.height = c.Round + 1
+		s.prune(s.cfg.MaxTrackedTxs)
+		s.Unlock()
+	}
+}
+
+// included marks a transaction encrypted by a client as included when the node decrypted it for the
+// block of round r. Blocks only contain the plaintexts, so these transactions can't be found by
+// trackCommits.
+func (s *Server) included(h [32]byte, r int) {
+	s.Lock()
+	defer s.Unlock()
+	s.include(h, r)
+}
+
+// include marks the transaction with hash h as included in the block of round r.
+func (s *Server) include(h [32]byte, r int) {
+	if rec, ok := s.txs[h]; ok && rec.Status != StatusIncluded {
+		rec.Status = StatusIncluded
+		rec.Round = &r
+		rec.Error = ""
+		s.finalize(rec)
+	}
+}
+
+// dropped marks a pending transaction as dropped when the node evicts it from its buffer or it
+// expires there.
+func (s *Server) dropped(h [32]byte, reason error) {
+	s.Lock()
+	defer s.Unlock()
+	if rec, ok := s.txs[h]; ok && rec.Status == StatusPending {
+		rec.Status = StatusDropped
+		rec.Error = reason.Error()
+		s.finalize(rec)
+	}
+}
+
+// finalize adds a record whose status became final to the end of the list of final statuses.
+func (s *Server) finalize(rec *txRecord) {
+	if rec.final != nil {
+		s.final.Remove(rec.final)
+	}
+	rec.at = s.now()
+	rec.final = s.final.PushBack(rec)
+}
+
+// prune forgets the final statuses that are older than the retention time. While more than max
+// transactions are tracked the oldest final statuses are forgotten as well, a max of 0 doesn't
+// limit the number.
+func (s *Server) prune(max int) {
+	now := s.now()
+	for e := s.final.Front(); e != nil; e = s.final.Front() {
+		rec := e.Value.(*txRecord)
+		expired := s.cfg.StatusTTL > 0 && now.Sub(rec.at) >= s.cfg.StatusTTL
+		if !expired && (max == 0 || len(s.txs) <= max) {
+			return
+		}
+		s.final.Remove(e)
+		delete(s.txs, rec.hash)
+	}
+}
+
+// handleSubmit admits a transaction to the buffer of the node.
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use POST to submit transactions"))
+		return
+	}
+	// Allow for the base64 and JSON overhead
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(2*s.cfg.MaxTxSize+1024)))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("request has more than %d bytes", tooLarge.Limit))
+			return
+		}
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	req := new(TxRequest)
+	if err = json.Unmarshal(body, req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	if len(req.Tx) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("empty transaction"))
+		return
+	}
+	if len(req.Tx) > s.cfg.MaxTxSize {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("transaction has %d bytes, at most %d are allowed", len(req.Tx), s.cfg.MaxTxSize))
+		return
+	}
+
+	h := sha256.Sum256(req.Tx)
+	s.Lock()
+	old, ok := s.txs[h]
+	if ok && old.Status != StatusDropped {
+		// The transaction was already admitted
+		ret := old.TxStatus
+		s.Unlock()
+		writeJSON(w, http.StatusOK, &ret)
+		return
+	}
+	if ok {
+		s.final.Remove(old.final)
+		delete(s.txs, h)
+	}
+	if s.cfg.MaxTrackedTxs > 0 {
+		s.prune(s.cfg.MaxTrackedTxs - 1)
+		if len(s.txs) >= s.cfg.MaxTrackedTxs {
+			s.Unlock()
+			writeError(w, http.StatusTooManyRequests, errors.New("too many tracked transactions"))
+			return
+		}
+	}
+	rec := &txRecord{
+		TxStatus: TxStatus{
+			Hash:   hex.EncodeToString(h[:]),
+			Status: StatusPending,
+		},
+		hash: h,
+	}
+	s.txs[h] = rec
+	s.Unlock()
+
+	code := http.StatusAccepted
+	if s.abc.PendingTxs() >= s.cfg.MaxPendingTxs {
+		err = errors.New("buffer is full")
+		code = http.StatusTooManyRequests
+	} else if err = s.abc.SubmitTx(req.Tx); err == abc.ErrDuplicateTx {
+		// The transaction reached the mempool by other means and is pending
+		err = nil
+	} else if err != nil {
+		code = http.StatusUnprocessableEntity
+	}
+	s.Lock()
+	if err != nil && rec.Status == StatusPending {
+		rec.Status = StatusDropped
+		rec.Error = err.Error()
+		s.finalize(rec)
+	}
+	ret := rec.TxStatus
+	s.Unlock()
+	writeJSON(w, code, &ret)
+}
+
+// handleTxStatus returns the status of a submitted transaction.
+func (s *Server) handleTxStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use GET to query transactions"))
+		return
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(r.URL.Path, "/txs/"))
+	if err != nil || len(b) != sha256.Size {
+		writeError(w, http.StatusBadRequest, errors.New("invalid transaction hash"))
+		return
+	}
+	var h [32]byte
+	copy(h[:], b)
+	s.Lock()
+	s.prune(s.cfg.MaxTrackedTxs)
+	rec, ok := s.txs[h]
+	var ret TxStatus
+	if ok {
+		ret = rec.TxStatus
+	}
+	s.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown transaction"))
+		return
+	}
+	writeJSON(w, http.StatusOK, &ret)
+}
+
+// handleBlock returns the finalized block of a round.
+func (s *Server) handleBlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use GET to fetch blocks"))
+		return
+	}
+	round, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/blocks/"))
+	if err != nil || round < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("invalid round"))
+		return
+	}
+	block, ok := s.abc.GetBlock(round)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("round %d isn't finalized", round))
+		return
+	}
+	writeJSON(w, http.StatusOK, newBlock(round, block))
+}
+
+// newBlock returns the API representation of the block of round r.
+func newBlock(r int, block *utils.Block) *Block {
+	h := block.Hash()
+	ret := &Block{
+		Round: r,
+		Hash:  hex.EncodeToString(h[:]),
+		Txs:   block.Txs,
+	}
+	if block.Header != nil {
+		ret.Height = block.Header.Height
+		ret.ParentHash = hex.EncodeToString(block.Header.ParentHash[:])
+		ret.TxRoot = hex.EncodeToString(block.Header.TxRoot[:])
+		ret.Path = block.Header.Path
+	}
+	return ret
+}
+
+// handleStream sends the finalized blocks from the requested round on as server-sent events. The
+// id of an event is the round of the block, so a client that reconnects with the Last-Event-ID
+// header resumes after the last block it received. Blocks the client is behind on are replayed
+// from the store. A slow client only delays its own stream.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use GET to stream blocks"))
+		return
+	}
+	from := 0
+	if v := r.URL.Query().Get("from"); v != "" {
+		f, err := strconv.Atoi(v)
+		if err != nil || f < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid round"))
+			return
+		}
+		from = f
+	}
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		last, err := strconv.Atoi(v)
+		if err != nil || last < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid last event id"))
+			return
+		}
+		from = last + 1
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	s.Lock()
+	if s.subscribers >= s.cfg.MaxSubscribers {
+		s.Unlock()
+		writeError(w, http.StatusServiceUnavailable, errors.New("too many subscribers"))
+		return
+	}
+	s.subscribers++
+	s.Unlock()
+	defer func() {
+		s.Lock()
+		s.subscribers--
+		s.Unlock()
+	}()
+
+	// The stream ends when the client disconnects or the server is closed
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-r.Context().Done():
+		case <-s.done:
+		case <-finished:
+		}
+		close(done)
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for c := range s.abc.Commits(from, done) {
+		data, err := json.Marshal(newBlock(c.Round, c.Block))
+		if err != nil {
+			return
+		}
+		if _, err = fmt.Fprintf(w, "id: %d\nevent: block\ndata: %s\n\n", c.Round, data); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// handleStatus returns the status of the node.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use GET to query the status"))
+		return
+	}
+	s.abc.Lock()
+	ret := &NodeStatus{
+		NodeId:         s.abc.Cfg.NodeId,
+		FinishedRounds: s.abc.FinishedRounds,
+		DupTxsInBlock:  s.abc.DupTxsInBlock,
+		DupTxsInLedger: s.abc.DupTxsInLedger,
+		ReplayedTxs:    s.abc.ReplayedTxs,
+	}
+	s.abc.Unlock()
+	s.Lock()
+	ret.Height = s.height
+	ret.SubmittedTxs = len(s.txs)
+	s.Unlock()
+	ret.PendingTxs = s.abc.PendingTxs()
+	for i, st := range s.abc.ProposerStats() {
+		ret.Proposers = append(ret.Proposers, ProposerStatus{
+			NodeId:    i,
+			SlotsBLA:  st.SlotsBLA,
+			SlotsACS:  st.SlotsACS,
+			Txs:       st.Txs,
+			AvgWaitMs: st.AvgWait.Milliseconds(),
+			Missed:    st.Missed,
+			Flagged:   st.Flagged,
+		})
+	}
+	if rf, ok := s.abc.LastRoundFairness(); ok {
+		ret.LastRound = &RoundStatus{
+			Round:     rf.Round,
+			Path:      rf.Path,
+			Slots:     rf.Slots,
+			Txs:       rf.Txs,
+			AvgWaitMs: make([]int64, len(rf.Wait)),
+		}
+		for i, d := range rf.Wait {
+			ret.LastRound.AvgWaitMs[i] = d.Milliseconds()
+		}
+	}
+	writeJSON(w, http.StatusOK, ret)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, &errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,455 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/niclabs/tcpaillier"
+	"github.com/niclabs/tcrsa"
+	aba "github.com/sochsenreither/tardigrade/binaryagreement"
+	abc "github.com/sochsenreither/tardigrade/tardigrade"
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+// testApp rejects transactions starting with "invalid".
+type testApp struct{}
+
+func (testApp) CheckTx(tx []byte) error {
+	if bytes.HasPrefix(tx, []byte("invalid")) {
+		return errors.New("invalid transaction")
+	}
+	return nil
+}
+
+func (testApp) DeliverBlock(c *abc.Commit) {}
+
+func (testApp) Commit() [32]byte {
+	return [32]byte{}
+}
+
+func TestServer(t *testing.T) {
+	cfg := abc.NewABCConfig(1, 0, 0, 0, 1, 1, 10, 0, 8, map[int]bool{0: true}, nil, nil)
+	u := abc.NewABC(cfg, nil)
+	u.SetApplication(testApp{})
+	s := NewServer(u, &Config{MaxTxSize: 8, MaxPendingTxs: 2})
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	submit := func(tx []byte) (int, *TxStatus) {
+		body, _ := json.Marshal(&TxRequest{Tx: tx})
+		resp, err := http.Post(ts.URL+"/txs", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		status := new(TxStatus)
+		json.NewDecoder(resp.Body).Decode(status)
+		return resp.StatusCode, status
+	}
+	get := func(path string, v interface{}) int {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		json.NewDecoder(resp.Body).Decode(v)
+		return resp.StatusCode
+	}
+	hash := func(tx string) string {
+		h := sha256.Sum256([]byte(tx))
+		return hex.EncodeToString(h[:])
+	}
+
+	t.Run("Admits transactions", func(t *testing.T) {
+		if code, status := submit([]byte("foo")); code != http.StatusAccepted || status.Status != StatusPending || status.Hash != hash("foo") {
+			t.Errorf("Got unexpected response %d %+v", code, status)
+		}
+		if code, status := submit([]byte("foo")); code != http.StatusOK || status.Status != StatusPending {
+			t.Errorf("Got unexpected response for resubmitted transaction %d %+v", code, status)
+		}
+		if u.PendingTxs() != 1 {
+			t.Errorf("Expected %d pending transaction, got %d", 1, u.PendingTxs())
+		}
+	})
+
+	t.Run("Refuses transactions", func(t *testing.T) {
+		if code, _ := submit([]byte("too large")); code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected %d for a large transaction, got %d", http.StatusRequestEntityTooLarge, code)
+		}
+		// A body larger than the limit is refused before it is parsed
+		body := bytes.Repeat([]byte("a"), 2*8+1024+1)
+		resp, err := http.Post(ts.URL+"/txs", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected %d for a large request body, got %d", http.StatusRequestEntityTooLarge, resp.StatusCode)
+		}
+		if code, _ := submit(nil); code != http.StatusBadRequest {
+			t.Errorf("Expected %d for an empty transaction, got %d", http.StatusBadRequest, code)
+		}
+		if code, status := submit([]byte("invalid")); code != http.StatusUnprocessableEntity || status.Status != StatusDropped || status.Error == "" {
+			t.Errorf("Got unexpected response for a rejected transaction %d %+v", code, status)
+		}
+		submit([]byte("bar"))
+		if code, status := submit([]byte("baz")); code != http.StatusTooManyRequests || status.Status != StatusDropped {
+			t.Errorf("Got unexpected response for a full buffer %d %+v", code, status)
+		}
+		status := new(TxStatus)
+		if code := get("/txs/"+hash("invalid"), status); code != http.StatusOK || status.Status != StatusDropped {
+			t.Errorf("Got unexpected status of a rejected transaction %d %+v", code, status)
+		}
+		if code := get("/txs/"+hash("unknown"), status); code != http.StatusNotFound {
+			t.Errorf("Expected %d for an unknown transaction, got %d", http.StatusNotFound, code)
+		}
+		if code := get("/txs/foo", status); code != http.StatusBadRequest {
+			t.Errorf("Expected %d for an invalid hash, got %d", http.StatusBadRequest, code)
+		}
+	})
+
+	t.Run("Reports included transactions and blocks", func(t *testing.T) {
+		block := &utils.Block{Txs: [][]byte{[]byte("bar"), []byte("foo")}}
+		block.Header = utils.NewBlockHeader(0, nil, block.Txs, "acs", nil)
+		store := abc.NewMemoryStore()
+		store.PutBlock(0, block)
+		if err := u.SetStore(store); err != nil {
+			t.Fatal(err)
+		}
+
+		status := new(TxStatus)
+		deadline := time.Now().Add(time.Second)
+		for status.Status != StatusIncluded && time.Now().Before(deadline) {
+			get("/txs/"+hash("foo"), status)
+			time.Sleep(10 * time.Millisecond)
+		}
+		if status.Status != StatusIncluded || status.Round == nil || *status.Round != 0 {
+			t.Errorf("Got unexpected status of an included transaction %+v", status)
+		}
+
+		b := new(Block)
+		h := block.Hash()
+		if code := get("/blocks/0", b); code != http.StatusOK || b.Hash != hex.EncodeToString(h[:]) || len(b.Txs) != 2 || string(b.Txs[1]) != "foo" {
+			t.Errorf("Got unexpected block %d %+v", code, b)
+		}
+		if code := get("/blocks/1", b); code != http.StatusNotFound {
+			t.Errorf("Expected %d for a round that isn't finalized, got %d", http.StatusNotFound, code)
+		}
+
+		nodeStatus := new(NodeStatus)
+		if code := get("/status", nodeStatus); code != http.StatusOK || nodeStatus.Height != 1 || nodeStatus.SubmittedTxs != 4 {
+			t.Errorf("Got unexpected node status %d %+v", code, nodeStatus)
+		}
+		if len(nodeStatus.Proposers) != 1 || nodeStatus.Proposers[0].NodeId != 0 || nodeStatus.LastRound != nil {
+			t.Errorf("Got unexpected proposer statistics %+v", nodeStatus.Proposers)
+		}
+	})
+}
+
+func TestTrackTxs(t *testing.T) {
+	cfg := abc.NewABCConfig(1, 0, 0, 0, 1, 1, 10, 0, 8, map[int]bool{0: true}, nil, nil)
+	cfg.SetMempoolLimits(3, 500*time.Millisecond)
+	u := abc.NewABC(cfg, nil)
+	s := NewServer(u, &Config{MaxTxSize: 8, MaxPendingTxs: 10, MaxTrackedTxs: 3, StatusTTL: time.Minute})
+	defer s.Close()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	submit := func(tx string) int {
+		body, _ := json.Marshal(&TxRequest{Tx: []byte(tx)})
+		resp, err := http.Post(ts.URL+"/txs", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	get := func(tx string) (int, *TxStatus) {
+		h := sha256.Sum256([]byte(tx))
+		resp, err := http.Get(ts.URL + "/txs/" + hex.EncodeToString(h[:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		status := new(TxStatus)
+		json.NewDecoder(resp.Body).Decode(status)
+		return resp.StatusCode, status
+	}
+
+	for _, tx := range []string{"a", "b", "c"} {
+		if code := submit(tx); code != http.StatusAccepted {
+			t.Fatalf("Expected %d, got %d", http.StatusAccepted, code)
+		}
+	}
+	// Pending transactions are never forgotten
+	if code := submit("d"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected %d while only pending transactions are tracked, got %d", http.StatusTooManyRequests, code)
+	}
+
+	// Transactions that expire in the mempool are dropped
+	time.Sleep(600 * time.Millisecond)
+	u.PendingTxs()
+	if code, status := get("a"); code != http.StatusOK || status.Status != StatusDropped || status.Error != abc.ErrTxExpired.Error() {
+		t.Errorf("Got unexpected status of an expired transaction %d %+v", code, status)
+	}
+
+	// The oldest final statuses make room for new transactions
+	for _, tx := range []string{"d", "e"} {
+		if code := submit(tx); code != http.StatusAccepted {
+			t.Fatalf("Expected %d, got %d", http.StatusAccepted, code)
+		}
+	}
+	if code, _ := get("a"); code != http.StatusNotFound {
+		t.Errorf("Expected status of the oldest dropped transaction to be forgotten, got %d", code)
+	}
+
+	// Transactions that are evicted from the full mempool are dropped, also when other
+	// transactions reach the mempool by other means
+	u.SubmitTx([]byte("f"))
+	u.SubmitTx([]byte("g"))
+	if code, status := get("d"); code != http.StatusOK || status.Status != StatusDropped || status.Error != abc.ErrTxEvicted.Error() {
+		t.Errorf("Got unexpected status of an evicted transaction %d %+v", code, status)
+	}
+
+	// Final statuses are forgotten after the retention time
+	now = now.Add(time.Minute)
+	if code, _ := get("d"); code != http.StatusNotFound {
+		t.Errorf("Expected status of a dropped transaction to be forgotten, got %d", code)
+	}
+	if code, status := get("e"); code != http.StatusOK || status.Status != StatusPending {
+		t.Errorf("Got unexpected status of a pending transaction %d %+v", code, status)
+	}
+}
+
+func TestClientEncryption(t *testing.T) {
+	n := 4
+	kappa := 2
+	maxRounds := 3
+	abcs := setupNodes(t, n, kappa)
+	s := NewServer(abcs[0], DefaultConfig())
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	// Clients submit ciphertexts, the status is tracked by their hash
+	client := abc.NewClient(abcs[0].EncryptionKey())
+	cts := make([][]byte, 4)
+	for i := range cts {
+		c, err := client.Encrypt([]byte(fmt.Sprint("tx", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cts[i] = c
+		body, _ := json.Marshal(&TxRequest{Tx: c})
+		resp, err := http.Post(ts.URL+"/txs", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("Expected %d, got %d", http.StatusAccepted, resp.StatusCode)
+		}
+		for _, u := range abcs[1:] {
+			u.SubmitTx(c)
+		}
+	}
+
+	cfgs := make(map[int]*utils.RoundConfig)
+	for i := 0; i < maxRounds; i++ {
+		cfgs[i] = &utils.RoundConfig{
+			Ta:      0,
+			Ts:      0,
+			Crashed: map[int]bool{},
+		}
+	}
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		i := i
+		go func() {
+			defer wg.Done()
+			abcs[i].Run(maxRounds, cfgs, time.Now())
+		}()
+	}
+	wg.Wait()
+
+	for i, c := range cts {
+		h := sha256.Sum256(c)
+		resp, err := http.Get(ts.URL + "/txs/" + hex.EncodeToString(h[:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		status := new(TxStatus)
+		json.NewDecoder(resp.Body).Decode(status)
+		resp.Body.Close()
+		if status.Status != StatusIncluded || status.Round == nil {
+			t.Errorf("Got unexpected status of ciphertext %d %+v", i, status)
+			continue
+		}
+		block, ok := abcs[0].GetBlock(*status.Round)
+		if !ok || !containsTx(block.Txs, []byte(fmt.Sprint("tx", i))) {
+			t.Errorf("Block of round %d doesn't contain the transaction of ciphertext %d", *status.Round, i)
+		}
+	}
+}
+
+func containsTx(txs [][]byte, tx []byte) bool {
+	for _, t := range txs {
+		if bytes.Equal(t, tx) {
+			return true
+		}
+	}
+	return false
+}
+
+// setupNodes creates n nodes with client encryption that communicate over local channels.
+func setupNodes(t *testing.T, n, kappa int) []*abc.ABC {
+	committee := make(map[int]bool)
+	for i := 0; i < kappa; i++ {
+		committee[i] = true
+	}
+	keyShares, keyMeta, err := tcrsa.NewKey(512, uint16(n/2+1), uint16(n), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySharesC, keyMetaC, err := tcrsa.NewKey(512, uint16(kappa/2+1), uint16(kappa), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decShares, pk, err := tcpaillier.NewKey(512, 1, uint8(kappa), uint8(kappa/2+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	identities, err := utils.NewIdentities(n, 0, committee, keyShares, keyMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coin := aba.NewLocalCommonCoin(n, keyMeta, make(chan *utils.CoinRequest, 9999))
+	go coin.Run()
+	nodeChans := make(map[int]chan *utils.HandlerMessage)
+	for i := 0; i < n; i++ {
+		nodeChans[i] = make(chan *utils.HandlerMessage, 9999)
+	}
+	leaderFunc := func(r, n int) int {
+		return r % n
+	}
+
+	abcs := make([]*abc.ABC, n)
+	for i := 0; i < n; i++ {
+		handler := utils.NewLocalHandler(nodeChans, coin.RequestChan, i, n, kappa)
+		cfg := abc.NewABCConfig(n, i, 0, 0, kappa, 1, 10, 0, 8, committee, leaderFunc, handler.Funcs)
+		cfg.SetClientEncryption(true)
+		if committee[i] {
+			abcs[i] = abc.NewABC(cfg, abc.NewTcs(keyShares[i], keyMeta, keyMetaC, pk, identities[i], keySharesC[i], decShares[i]))
+		} else {
+			abcs[i] = abc.NewABC(cfg, abc.NewTcs(keyShares[i], keyMeta, keyMetaC, pk, identities[i], nil, nil))
+		}
+	}
+	return abcs
+}
+
+func TestStream(t *testing.T) {
+	cfg := abc.NewABCConfig(1, 0, 0, 0, 1, 1, 10, 0, 8, map[int]bool{0: true}, nil, nil)
+	u := abc.NewABC(cfg, nil)
+	blocks := make([]*utils.Block, 3)
+	var parent *utils.BlockHeader
+	store := abc.NewMemoryStore()
+	for r := range blocks {
+		blocks[r] = &utils.Block{Txs: [][]byte{[]byte(fmt.Sprint(r))}}
+		blocks[r].Header = utils.NewBlockHeader(r, parent, blocks[r].Txs, "acs", nil)
+		parent = blocks[r].Header
+		if r < 2 {
+			store.PutBlock(r, blocks[r])
+		}
+	}
+	if err := u.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(u, &Config{MaxSubscribers: 1})
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	// subscribe opens a stream and returns a function that reads the next block
+	subscribe := func(path string, lastEventId string) (*http.Response, func() *Block) {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if lastEventId != "" {
+			req.Header.Set("Last-Event-ID", lastEventId)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := bufio.NewReader(resp.Body)
+		next := func() *Block {
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					t.Fatalf("Stream ended: %s", err)
+				}
+				if strings.HasPrefix(line, "data: ") {
+					b := new(Block)
+					if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), b); err != nil {
+						t.Fatal(err)
+					}
+					return b
+				}
+			}
+		}
+		return resp, next
+	}
+
+	resp, next := subscribe("/stream?from=1", "")
+	if b := next(); b.Round != 1 || string(b.Txs[0]) != "1" {
+		t.Errorf("Expected block of round 1, got %+v", b)
+	}
+	// Only one subscriber is allowed
+	other, _ := subscribe("/stream", "")
+	if other.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d for too many subscribers, got %d", http.StatusServiceUnavailable, other.StatusCode)
+	}
+	other.Body.Close()
+
+	// New blocks are pushed as soon as they are finalized
+	store.PutBlock(2, blocks[2])
+	if err := u.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if b := next(); b.Round != 2 || string(b.Txs[0]) != "2" {
+		t.Errorf("Expected block of round 2, got %+v", b)
+	}
+	resp.Body.Close()
+
+	// A client resumes after the last block it received
+	var b *Block
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		resp, next = subscribe("/stream", "0")
+		if resp.StatusCode == http.StatusOK {
+			b = next()
+			break
+		}
+		// The previous stream isn't closed yet
+		resp.Body.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if b == nil || b.Round != 1 {
+		t.Errorf("Expected to resume at round 1, got %+v", b)
+	}
+	resp.Body.Close()
+}
@@ -2,10 +2,8 @@ package binaryagreement
 
 import (
 	"crypto"
-	"crypto/sha256"
 
 	// "log"
-	"strconv"
 	"sync"
 
 	"github.com/niclabs/tcrsa"
@@ -38,6 +36,7 @@ type AbaMessage struct {
 type ThresholdCrypto struct {
 	KeyShare *tcrsa.KeyShare
 	KeyMeta  *tcrsa.KeyMeta
+	Hash     crypto.Hash // Hash function of the signatures, utils.DefaultSigHash if 0
 }
 
 func NewBinaryAgreement(UROUND, n, nodeId, t, value, instance int, thresholdCrypto *ThresholdCrypto, handlerFuncs *utils.HandlerFuncs) *BinaryAgreement {
@@ -270,9 +269,13 @@ func (aba *BinaryAgreement) sendAUX(round, value, sender int) {
 
 // callCommonCoin calls the common coin and blocks until it returns a value.
 func (aba *BinaryAgreement) callCommonCoin() int {
-	h := sha256.Sum256([]byte(strconv.Itoa(aba.round)))
-	hash, _ := tcrsa.PrepareDocumentHash(aba.thresholdCrypto.KeyMeta.PublicKey.Size(), crypto.SHA256, h[:])
-	sig, err := aba.thresholdCrypto.KeyShare.Sign(hash, crypto.SHA256, aba.thresholdCrypto.KeyMeta)
+	h := utils.CoinHash(aba.UROUND, aba.round)
+	sigHash := aba.thresholdCrypto.Hash
+	if sigHash == 0 {
+		sigHash = utils.DefaultSigHash
+	}
+	hash, _ := utils.PrepareSigHash(aba.thresholdCrypto.KeyMeta, sigHash, h[:])
+	sig, err := aba.thresholdCrypto.KeyShare.Sign(hash, sigHash, aba.thresholdCrypto.KeyMeta)
 	if err != nil {
 		// log.Panicln(aba.nodeId, "failed to create signature on round", aba.round)
 	}
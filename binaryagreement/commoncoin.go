@@ -10,7 +10,6 @@ import (
 	"time"
 
 	"log"
-	"strconv"
 
 	"github.com/niclabs/tcrsa"
 	"github.com/sochsenreither/tardigrade/utils"
@@ -22,6 +21,7 @@ import (
 type CommonCoin struct {
 	N           int                     // Number of nodes
 	KeyMeta     *tcrsa.KeyMeta          // PKI
+	Hash        crypto.Hash             // Hash function of the signatures, utils.DefaultSigHash if 0
 	RequestChan chan *utils.CoinRequest // Channel to receive requests
 	Answer      func(req *utils.CoinRequest, val byte)
 	Listener    func(requestChan chan *utils.CoinRequest)
@@ -132,6 +132,10 @@ func (cc *CommonCoin) Run() {
 	received := make(map[int]map[int]map[int]map[int]*utils.CoinRequest)
 	alreadySent := make(map[int]map[int]map[int]bool)
 	coinVals := make(map[int]map[int]byte)
+	sigHash := cc.Hash
+	if sigHash == 0 {
+		sigHash = utils.DefaultSigHash
+	}
 
 	for request := range cc.RequestChan {
 		sender := request.Sender
@@ -162,8 +166,8 @@ func (cc *CommonCoin) Run() {
 		received[UROUND][round][instance][sender] = request
 
 		// Hash the round number
-		h := sha256.Sum256([]byte(strconv.Itoa(round)))
-		hash, err := tcrsa.PrepareDocumentHash(cc.KeyMeta.PublicKey.Size(), crypto.SHA256, h[:])
+		h := utils.CoinHash(UROUND, round)
+		hash, err := utils.PrepareSigHash(cc.KeyMeta, sigHash, h[:])
 		if err != nil {
 			log.Println("Common coin failed to create hash for round", round, err)
 		}
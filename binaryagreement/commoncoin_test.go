@@ -3,14 +3,12 @@ package binaryagreement
 import (
 	"bytes"
 	"crypto"
-	"crypto/sha256"
 	"encoding/gob"
 	"net"
 
 	//"io/ioutil"
 	"log"
 	//"os"
-	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -93,7 +91,7 @@ func TestNetworkCoin(t *testing.T) {
 			sigShares[round] = make(map[int]*tcrsa.SigShare)
 		}
 		// Call coin
-		h := sha256.Sum256([]byte(strconv.Itoa(round)))
+		h := utils.CoinHash(0, round)
 		hash, _ := tcrsa.PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, h[:])
 		for node := 0; node < n; node++ {
 			sigShares[round][node], _ = keyShares[node].Sign(hash, crypto.SHA256, keyMeta)
@@ -193,7 +191,7 @@ func repeatRunner(t testing.TB, round, n int, keyShares tcrsa.KeyShareList, keyM
 
 	// PKI setup
 	sigShares := make([]*tcrsa.SigShare, n)
-	h := sha256.Sum256([]byte(strconv.Itoa(round)))
+	h := utils.CoinHash(0, round)
 	hash, _ := tcrsa.PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, h[:])
 	for i := 0; i < n; i++ {
 		sigShares[i], _ = keyShares[i].Sign(hash, crypto.SHA256, keyMeta)
@@ -5,7 +5,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/niclabs/tcrsa"
 	"github.com/sochsenreither/tardigrade/utils"
 )
 
@@ -18,7 +17,7 @@ type BlockAgreement struct {
 	kappa                   int                    // Security parameter
 	blockShare              *utils.BlockShare      // Input pre-block of the node
 	commits                 []*CommitMessage       // List of commit messages received from GC
-	thresholdCrypto         *thresholdCrypto       // Struct containing the secret key and key meta
+	identity                *utils.Identity        // Identity key and membership certificate
 	out                     chan *utils.BlockShare // Output channel
 	gradedConsensusProtocol *gradedConsensus       // Underlying protocol
 	tickerChan              chan int               // Timer for synchronizing
@@ -32,7 +31,7 @@ type BlockAgreement struct {
 	sync.Mutex
 }
 
-func NewBlockAgreement(UROUND, n, nodeId, t, kappa int, blockShare *utils.BlockShare, keyShare *tcrsa.KeyShare, keyMeta *tcrsa.KeyMeta, leaderFunc func(round, n int) int, delta int, handlerFuncs *utils.HandlerFuncs) *BlockAgreement {
+func NewBlockAgreement(UROUND, n, nodeId, t, kappa int, blockShare *utils.BlockShare, identity *utils.Identity, leaderFunc func(round, n int) int, delta int, handlerFuncs *utils.HandlerFuncs) *BlockAgreement {
 	multicast := func(msg *utils.Message, round int, receiver ...int) {
 		if len(receiver) == 1 {
 			handlerFuncs.BLAmulticast(msg, UROUND, round, receiver[0])
@@ -51,10 +50,6 @@ func NewBlockAgreement(UROUND, n, nodeId, t, kappa int, blockShare *utils.BlockS
 		proposeChans[i] = make(chan *ProposeMessage, n*kappa)
 	}
 
-	tcs := &thresholdCrypto{
-		KeyShare: keyShare,
-		KeyMeta:  keyMeta,
-	}
 	tickerChan := make(chan int, 999)
 	ticker := func() {
 
@@ -77,7 +72,7 @@ func NewBlockAgreement(UROUND, n, nodeId, t, kappa int, blockShare *utils.BlockS
 		BlockShare: blockShare,
 		Commits:    nil,
 	}
-	gradedConsensus := NewGradedConsensus(n, nodeId, t, 0, tickerChan, vote, tcs, leaderFunc, multicast, notifyChans, commitChans, voteChans, proposeChans)
+	gradedConsensus := NewGradedConsensus(n, nodeId, t, 0, tickerChan, vote, identity, leaderFunc, multicast, notifyChans, commitChans, voteChans, proposeChans)
 
 	blockAgreement := &BlockAgreement{
 		UROUND:                  UROUND,
@@ -87,7 +82,7 @@ func NewBlockAgreement(UROUND, n, nodeId, t, kappa int, blockShare *utils.BlockS
 		round:                   0,
 		kappa:                   kappa,
 		blockShare:              blockShare,
-		thresholdCrypto:         tcs,
+		identity:                identity,
 		out:                     out,
 		gradedConsensusProtocol: gradedConsensus,
 		tickerChan:              tickerChan,
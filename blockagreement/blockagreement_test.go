@@ -1,8 +1,6 @@
 package blockagreement
 
 import (
-	"crypto"
-	"crypto/sha256"
 	"fmt"
 	"sync"
 	"testing"
@@ -13,30 +11,25 @@ import (
 )
 
 type testBlockAgreementInstance struct {
-	n               int
-	ts              int
-	nodeChans       map[int]chan *utils.HandlerMessage
-	bas             []*BlockAgreement
-	thresholdCrypto []*thresholdCrypto
-	delta           int
-	kappa           int
+	n         int
+	ts        int
+	nodeChans map[int]chan *utils.HandlerMessage
+	bas       []*BlockAgreement
+	delta     int
+	kappa     int
 }
 
 func newTestBlockAgreementInstanceWithSamePreBlock(n, ts, kappa int, delta int) *testBlockAgreementInstance {
 	ba := &testBlockAgreementInstance{
-		n:               n,
-		ts:              ts,
-		nodeChans:       make(map[int]chan *utils.HandlerMessage),
-		bas:             make([]*BlockAgreement, n),
-		thresholdCrypto: make([]*thresholdCrypto, n),
-		delta:           delta,
-		kappa:           kappa,
+		n:         n,
+		ts:        ts,
+		nodeChans: make(map[int]chan *utils.HandlerMessage),
+		bas:       make([]*BlockAgreement, n),
+		delta:     delta,
+		kappa:     kappa,
 	}
 
-	keyShares, keyMeta, err := tcrsa.NewKey(512, uint16(n/2+1), uint16(n), nil)
-	if err != nil {
-		panic(err)
-	}
+	identities := setupIdentities(n)
 
 	var handlers []*utils.LocalHandler
 	for i := 0; i < n; i++ {
@@ -47,15 +40,7 @@ func newTestBlockAgreementInstanceWithSamePreBlock(n, ts, kappa int, delta int)
 	pre := utils.NewPreBlock(n)
 	for i := 0; i < n; i++ {
 		// Create a test message with a corresponding signature by node i
-		message := []byte("test")
-		messageHash := sha256.Sum256(message)
-		messageHashPadded, _ := tcrsa.PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, messageHash[:])
-		sig, _ := keyShares[i].Sign(messageHashPadded, crypto.SHA256, keyMeta)
-
-		preMes := &utils.PreBlockMessage{
-			Message: message,
-			Sig:     sig,
-		}
+		preMes := utils.NewPreBlockMessage([]byte("test"), pre.Size, identities[i])
 		pre.AddMessage(i, preMes)
 	}
 
@@ -67,7 +52,7 @@ func newTestBlockAgreementInstanceWithSamePreBlock(n, ts, kappa int, delta int)
 	for i := 0; i < n; i++ {
 		// Create new handler
 		handlers = append(handlers, utils.NewLocalHandler(ba.nodeChans, nil, i, n, kappa))
-		ba.bas[i] = NewBlockAgreement(0, n, i, ts, ba.kappa, blockShare, keyShares[i], keyMeta, leader, ba.delta, handlers[i].Funcs)
+		ba.bas[i] = NewBlockAgreement(0, n, i, ts, ba.kappa, blockShare, identities[i], leader, ba.delta, handlers[i].Funcs)
 	}
 
 	return ba
@@ -79,19 +64,15 @@ func newTestBlockAgreementInstanceWithDifferentPreBlocks(n, ts, kappa int, delta
 	}
 	blockShares := make([]*utils.BlockShare, n)
 	ba := &testBlockAgreementInstance{
-		n:               n,
-		ts:              ts,
-		nodeChans:       make(map[int]chan *utils.HandlerMessage),
-		bas:             make([]*BlockAgreement, n),
-		thresholdCrypto: make([]*thresholdCrypto, n),
-		delta:           delta,
-		kappa:           kappa,
+		n:         n,
+		ts:        ts,
+		nodeChans: make(map[int]chan *utils.HandlerMessage),
+		bas:       make([]*BlockAgreement, n),
+		delta:     delta,
+		kappa:     kappa,
 	}
 
-	keyShares, keyMeta, err := tcrsa.NewKey(512, uint16(n/2+1), uint16(n), nil)
-	if err != nil {
-		panic(err)
-	}
+	identities := setupIdentities(n)
 
 	var handlers []*utils.LocalHandler
 	for i := 0; i < n; i++ {
@@ -101,30 +82,15 @@ func newTestBlockAgreementInstanceWithDifferentPreBlocks(n, ts, kappa int, delta
 	// Setup valid input
 	for i := 0; i < n; i++ {
 		pre := utils.NewPreBlock(n)
-		messageHash := sha256.Sum256(inputs[i])
-		messageHashPadded, _ := tcrsa.PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, messageHash[:])
-		sig, _ := keyShares[i].Sign(messageHashPadded, crypto.SHA256, keyMeta)
-
-		preMes := &utils.PreBlockMessage{
-			Message: inputs[i],
-			Sig:     sig,
-		}
+		preMes := utils.NewPreBlockMessage(inputs[i], pre.Size, identities[i])
 		pre.AddMessage(i, preMes)
 		// Fill pre-block with messages such that it becomes at least n-t-quality
 		for j := 0; j < n; j++ {
 			if i == j {
 				continue
 			}
-			// Create a test message with a corresponding signature by node i
-			message := []byte("test")
-			messageHash := sha256.Sum256(message)
-			messageHashPadded, _ := tcrsa.PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, messageHash[:])
-			sig, _ := keyShares[j].Sign(messageHashPadded, crypto.SHA256, keyMeta)
-
-			preMes := &utils.PreBlockMessage{
-				Message: message,
-				Sig:     sig,
-			}
+			// Create a test message with a corresponding signature by node j
+			preMes := utils.NewPreBlockMessage([]byte("test"), pre.Size, identities[j])
 			pre.AddMessage(j, preMes)
 		}
 		h := pre.Hash()
@@ -137,7 +103,7 @@ func newTestBlockAgreementInstanceWithDifferentPreBlocks(n, ts, kappa int, delta
 	for i := 0; i < n; i++ {
 		// Create new handler
 		handlers = append(handlers, utils.NewLocalHandler(ba.nodeChans, nil, i, n, kappa))
-		ba.bas[i] = NewBlockAgreement(0, n, i, ts, ba.kappa, nil, keyShares[i], keyMeta, leader, ba.delta, handlers[i].Funcs)
+		ba.bas[i] = NewBlockAgreement(0, n, i, ts, ba.kappa, nil, identities[i], leader, ba.delta, handlers[i].Funcs)
 		ba.bas[i].SetInput(blockShares[i])
 	}
 
@@ -213,6 +179,19 @@ func TestBAEveryoneOutputsSameBlockWithDifferentInput(t *testing.T) {
 	}
 }
 
+// setupIdentities creates identity keys and a membership certificate for n nodes.
+func setupIdentities(n int) []*utils.Identity {
+	keyShares, keyMeta, err := tcrsa.NewKey(512, uint16(n/2+1), uint16(n), nil)
+	if err != nil {
+		panic(err)
+	}
+	identities, err := utils.NewIdentities(n, 0, map[int]bool{}, keyShares, keyMeta)
+	if err != nil {
+		panic(err)
+	}
+	return identities
+}
+
 func leader(round, n int) int {
 	return round % n
 }
\ No newline at end of file
@@ -1,10 +1,8 @@
 package blockagreement
 
 import (
-	"crypto"
 	"log"
 
-	"github.com/niclabs/tcrsa"
 	"github.com/sochsenreither/tardigrade/utils"
 )
 
@@ -15,7 +13,7 @@ type gradedConsensus struct {
 	proposerId      int                                     // Proposer id
 	round           int                                     // Round number
 	vote            *Vote                                   // Input vote of the node
-	thresholdCrypto *thresholdCrypto                        // Struct containing the secret key and key meta
+	identity        *utils.Identity                         // Identity key and membership certificate
 	out             chan *GradedConsensusResult             // Output channel
 	proposeProtocol *proposeProtocol                        // Underlying sub-protocol
 	multicast       func(msg *utils.Message, params ...int) // Function for multicasting messages
@@ -25,9 +23,9 @@ type gradedConsensus struct {
 }
 
 // Returns a new graded consensus protocol instance
-func NewGradedConsensus(n, nodeId, t, round int, tickerChan chan int, vote *Vote, thresthresholdCrypto *thresholdCrypto, leaderFunc func(round, n int) int, multicastFunc func(msg *utils.Message, round int, receiver ...int), notifyChans map[int]chan *NotifyMessage, commitChans map[int]chan *CommitMessage, voteChans map[int]chan *VoteMessage, proposeChans map[int]chan *ProposeMessage) *gradedConsensus {
+func NewGradedConsensus(n, nodeId, t, round int, tickerChan chan int, vote *Vote, identity *utils.Identity, leaderFunc func(round, n int) int, multicastFunc func(msg *utils.Message, round int, receiver ...int), notifyChans map[int]chan *NotifyMessage, commitChans map[int]chan *CommitMessage, voteChans map[int]chan *VoteMessage, proposeChans map[int]chan *ProposeMessage) *gradedConsensus {
 	out := make(chan *GradedConsensusResult, 100)
-	propose := NewProposeProtocol(n, nodeId, t, -1, round, tickerChan, vote, thresthresholdCrypto, multicastFunc, voteChans, proposeChans)
+	propose := NewProposeProtocol(n, nodeId, t, -1, round, tickerChan, vote, identity, multicastFunc, voteChans, proposeChans)
 
 	gc := &gradedConsensus{
 		n:               n,
@@ -36,7 +34,7 @@ func NewGradedConsensus(n, nodeId, t, round int, tickerChan chan int, vote *Vote
 		proposerId:      -1,
 		round:           round,
 		vote:            vote,
-		thresholdCrypto: thresthresholdCrypto,
+		identity:        identity,
 		out:             out,
 		proposeProtocol: propose,
 		notifyChans:     notifyChans,
@@ -127,10 +125,7 @@ func (gc *gradedConsensus) run() {
 
 // Creates a commit message and multicasts it
 func (gc *gradedConsensus) multicastCommitMessage(bs *utils.BlockShare) {
-	commitMes, err := gc.newSignedCommitMessage(bs)
-	if err != nil {
-		return
-	}
+	commitMes := gc.newSignedCommitMessage(bs)
 
 	message := &utils.Message{
 		Sender:  gc.nodeId,
@@ -274,7 +269,7 @@ func (gc *gradedConsensus) isValidNotify(notify *NotifyMessage) bool {
 }
 
 // Returns a new signed commitMessage
-func (gc *gradedConsensus) newSignedCommitMessage(bs *utils.BlockShare) (*CommitMessage, error) {
+func (gc *gradedConsensus) newSignedCommitMessage(bs *utils.BlockShare) *CommitMessage {
 	// Create a new commitMessage
 	commitMes := &CommitMessage{
 		Sender:     gc.nodeId,
@@ -283,38 +278,18 @@ func (gc *gradedConsensus) newSignedCommitMessage(bs *utils.BlockShare) (*Commit
 		Sig:        nil,
 	}
 
-	// Create a hash of the sender, round and blockshare
-	hash := commitMes.HashWithoutSig()
-	hashPadded, err := tcrsa.PrepareDocumentHash(gc.thresholdCrypto.KeyMeta.PublicKey.Size(), crypto.SHA256, hash[:])
-	if err != nil {
-		// log.Println("--GC--", gc.nodeId, "was unanble to hash commitMessage:", err)
-		return nil, err
-	}
-
-	// Sign the hash
-	sigShare, err := gc.thresholdCrypto.KeyShare.Sign(hashPadded, crypto.SHA256, gc.thresholdCrypto.KeyMeta)
-	if err != nil {
-		// log.Println("--GC--", gc.nodeId, "was unable to sign commitMessage:", err)
-		return nil, err
-	}
-	commitMes.Sig = sigShare
+	// Sign the hash of the sender, round and blockshare
+	commitMes.Sig = gc.identity.Sign(commitMessageDomain, commitMes.HashWithoutSig())
 
-	return commitMes, nil
+	return commitMes
 }
 
 // Verifys a given commitMessage
 func (gc *gradedConsensus) verifyCommitMessage(cm *CommitMessage) bool {
-	hash := cm.HashWithoutSig()
-	hashPadded, err := tcrsa.PrepareDocumentHash(gc.thresholdCrypto.KeyMeta.PublicKey.Size(), crypto.SHA256, hash[:])
-	if err != nil {
-		// log.Println("--GC--", gc.nodeId, "was unanble to hash commitMessage while verifying:", err)
-		return false
-	}
-	if err = cm.Sig.Verify(hashPadded, gc.thresholdCrypto.KeyMeta); err != nil {
-		// log.Println("--GC--", gc.nodeId, "received invalid commitMessage signature from", cm.sender)
+	if cm.BlockShare == nil || cm.BlockShare.Block == nil || cm.BlockShare.Pointer == nil {
 		return false
 	}
-	return true
+	return gc.identity.Cert.VerifySig(cm.Sender, commitMessageDomain, cm.HashWithoutSig(), cm.Sig)
 }
 
 // GetValue returns the output of the protocol (blocking)
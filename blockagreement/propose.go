@@ -1,45 +1,41 @@
 package blockagreement
 
 import (
-	"crypto"
-	"crypto/sha256"
-
-	"github.com/niclabs/tcrsa"
 	"github.com/sochsenreither/tardigrade/utils"
 )
 
 type proposeProtocol struct {
-	n               int                                     // Number of nodes
-	nodeId          int                                     // Id of node
-	t               int                                     // Number of maximum faulty nodes
-	proposerId      int                                     // Proposer id
-	round           int                                     // Round number
-	time            int                                     // Current time
-	tickerChan      chan int                                // Ticker
-	vote            *Vote                                   // Vote of the current node
-	out             chan *utils.BlockShare                  // Output channel
-	thresholdCrypto *thresholdCrypto                        // Struct containing the secret key and key meta
-	multicast       func(msg *utils.Message, params ...int) // Function for multicasting messages
-	voteChans       map[int]chan *VoteMessage
-	proposeChans    map[int]chan *ProposeMessage
+	n            int                                     // Number of nodes
+	nodeId       int                                     // Id of node
+	t            int                                     // Number of maximum faulty nodes
+	proposerId   int                                     // Proposer id
+	round        int                                     // Round number
+	time         int                                     // Current time
+	tickerChan   chan int                                // Ticker
+	vote         *Vote                                   // Vote of the current node
+	out          chan *utils.BlockShare                  // Output channel
+	identity     *utils.Identity                         // Identity key and membership certificate
+	multicast    func(msg *utils.Message, params ...int) // Function for multicasting messages
+	voteChans    map[int]chan *VoteMessage
+	proposeChans map[int]chan *ProposeMessage
 }
 
 // Returns a new propose protocol instance
-func NewProposeProtocol(n, nodeId, t, proposerId, round int, ticker chan int, vote *Vote, thresthresholdCrypto *thresholdCrypto, multicastFunc func(msg *utils.Message, round int, receiver ...int), voteChans map[int]chan *VoteMessage, proposeChans map[int]chan *ProposeMessage) *proposeProtocol {
+func NewProposeProtocol(n, nodeId, t, proposerId, round int, ticker chan int, vote *Vote, identity *utils.Identity, multicastFunc func(msg *utils.Message, round int, receiver ...int), voteChans map[int]chan *VoteMessage, proposeChans map[int]chan *ProposeMessage) *proposeProtocol {
 	out := make(chan *utils.BlockShare, n)
 	p := &proposeProtocol{
-		n:               n,
-		nodeId:          nodeId,
-		t:               t,
-		proposerId:      proposerId,
-		round:           round,
-		time:            0,
-		tickerChan:      ticker,
-		vote:            vote,
-		out:             out,
-		thresholdCrypto: thresthresholdCrypto,
-		voteChans:       voteChans,
-		proposeChans:    proposeChans,
+		n:            n,
+		nodeId:       nodeId,
+		t:            t,
+		proposerId:   proposerId,
+		round:        round,
+		time:         0,
+		tickerChan:   ticker,
+		vote:         vote,
+		out:          out,
+		identity:     identity,
+		voteChans:    voteChans,
+		proposeChans: proposeChans,
 	}
 
 	multicast := func(msg *utils.Message, params ...int) {
@@ -79,10 +75,7 @@ func (p proposeProtocol) run() {
 
 // Sends vote to the proposer of the protocol.
 func (p *proposeProtocol) sendVotes() {
-	voteMes, err := p.newSignedVoteMessage()
-	if err != nil {
-		// log.Println("--P--", p.nodeId, "was unable to create vote message")
-	}
+	voteMes := p.newSignedVoteMessage()
 
 	// Wrap the vote message into a protocol message
 	message := &utils.Message{
@@ -123,10 +116,7 @@ func (p *proposeProtocol) propose(votes map[int]*VoteMessage) {
 		maxVote := findMaxVote(votes)
 
 		// Create new proposeMessage
-		proposal, err := p.newSignedProposeMessage(maxVote, votes)
-		if err != nil {
-			// log.Println("--P--", p.nodeId, "was unable to create propose message")
-		}
+		proposal := p.newSignedProposeMessage(maxVote, votes)
 
 		// Wrap proposeMessage
 		message := &utils.Message{
@@ -287,19 +277,19 @@ func (p *proposeProtocol) isValidProposal(proposal *ProposeMessage) bool {
 
 // Determines if a pre-block is valid
 func (p *proposeProtocol) isValidBlockShare(bs *utils.BlockShare) bool {
+	if bs == nil || bs.Block == nil || bs.Pointer == nil {
+		return false
+	}
 	if bs.Block.Quality() < (p.n - p.t) {
 		return false
 	}
 	for i, mes := range bs.Block.Vec {
-		// If the index is invalid the pre-block is invalid.
-		if i != int(mes.Sig.Id-1) {
-			return false
+		if mes == nil {
+			continue
 		}
-		// If the signature is invalid, the pre-block is invalid
-		h := sha256.Sum256(mes.Message)
-		hash, _ := tcrsa.PrepareDocumentHash(p.thresholdCrypto.KeyMeta.PublicKey.Size(), crypto.SHA256, h[:])
-		if err := mes.Sig.Verify(hash, p.thresholdCrypto.KeyMeta); err != nil {
-			// log.Println("--P--", "Signature for message index", i, "in pre-block couldn't be verified.", err)
+		// If the message wasn't signed by the node of its index, the pre-block is invalid
+		if !mes.Verify(i, bs.Block.Size, p.identity.Cert) {
+			// log.Println("--P--", "Signature for message index", i, "in pre-block couldn't be verified.")
 			return false
 		}
 	}
@@ -309,7 +299,7 @@ func (p *proposeProtocol) isValidBlockShare(bs *utils.BlockShare) bool {
 }
 
 // Returns a new signed voteMessage
-func (p *proposeProtocol) newSignedVoteMessage() (*VoteMessage, error) {
+func (p *proposeProtocol) newSignedVoteMessage() *VoteMessage {
 	// Create a new voteMessage
 	voteMes := &VoteMessage{
 		Sender: p.nodeId,
@@ -317,27 +307,14 @@ func (p *proposeProtocol) newSignedVoteMessage() (*VoteMessage, error) {
 		Vote:   p.vote,
 	}
 
-	// Create a hash of the sender and vote
-	hash := voteMes.HashWithoutSig()
-	hashPadded, err := tcrsa.PrepareDocumentHash(p.thresholdCrypto.KeyMeta.PublicKey.Size(), crypto.SHA256, hash[:])
-	if err != nil {
-		// log.Println("--P--", p.nodeId, "was unanble to hash vote:", err)
-		return nil, err
-	}
+	// Sign the hash of the sender and vote
+	voteMes.Sig = p.identity.Sign(voteMessageDomain, voteMes.HashWithoutSig())
 
-	// Sign the hash
-	sigShare, err := p.thresholdCrypto.KeyShare.Sign(hashPadded, crypto.SHA256, p.thresholdCrypto.KeyMeta)
-	if err != nil {
-		// log.Println("--P--", p.nodeId, "was unable to sign vote:", err)
-		return nil, err
-	}
-	voteMes.Sig = sigShare
-
-	return voteMes, nil
+	return voteMes
 }
 
 // Returns a new signed proposeMessage
-func (p *proposeProtocol) newSignedProposeMessage(vote *Vote, votes map[int]*VoteMessage) (*ProposeMessage, error) {
+func (p *proposeProtocol) newSignedProposeMessage(vote *Vote, votes map[int]*VoteMessage) *ProposeMessage {
 	// Create new proposeMessage
 	proposeMes := &ProposeMessage{
 		Sender:       p.nodeId,
@@ -346,53 +323,23 @@ func (p *proposeProtocol) newSignedProposeMessage(vote *Vote, votes map[int]*Vot
 		Sig:          nil,
 	}
 
-	// Create a hash of the sender, vote and voteMessages
-	hash := proposeMes.HashWithoutSig()
-	hashPadded, err := tcrsa.PrepareDocumentHash(p.thresholdCrypto.KeyMeta.PublicKey.Size(), crypto.SHA256, hash[:])
-	if err != nil {
-		// log.Println("--P--", p.nodeId, "was unanble to hash proposal:", err)
-		return nil, err
-	}
-
-	// Sign the hash
-	sigShare, err := p.thresholdCrypto.KeyShare.Sign(hashPadded, crypto.SHA256, p.thresholdCrypto.KeyMeta)
-	if err != nil {
-		// log.Println("--P--", p.nodeId, "was unable to sign proposal:", err)
-		return nil, err
-	}
-	proposeMes.Sig = sigShare
+	// Sign the hash of the sender, vote and voteMessages
+	proposeMes.Sig = p.identity.Sign(proposeMessageDomain, proposeMes.HashWithoutSig())
 
-	return proposeMes, nil
+	return proposeMes
 }
 
 // Verifys a given voteMessage
 func (p *proposeProtocol) verifyVoteMessage(vm *VoteMessage) bool {
-	hash := vm.HashWithoutSig()
-	hashPadded, err := tcrsa.PrepareDocumentHash(p.thresholdCrypto.KeyMeta.PublicKey.Size(), crypto.SHA256, hash[:])
-	if err != nil {
-		// log.Println("--P--", p.nodeId, "was unable to hash vote while verifying:", err)
+	if vm == nil || vm.Vote == nil {
 		return false
 	}
-	if err = vm.Sig.Verify(hashPadded, p.thresholdCrypto.KeyMeta); err != nil {
-		// log.Println("--P--", p.nodeId, "received invalid vote signature from", vm.sender)
-		return false
-	}
-	return true
+	return p.identity.Cert.VerifySig(vm.Sender, voteMessageDomain, vm.HashWithoutSig(), vm.Sig)
 }
 
 // Verifys a given proposeMessage
 func (p *proposeProtocol) verifyProposeMessage(pm *ProposeMessage) bool {
-	hash := pm.HashWithoutSig()
-	hashPadded, err := tcrsa.PrepareDocumentHash(p.thresholdCrypto.KeyMeta.PublicKey.Size(), crypto.SHA256, hash[:])
-	if err != nil {
-		// log.Println("--P--", p.nodeId, "was unanble to hash proposal while verifying:", err)
-		return false
-	}
-	if err = pm.Sig.Verify(hashPadded, p.thresholdCrypto.KeyMeta); err != nil {
-		// log.Println("--P--", p.nodeId, "received invalid proposal signature from", pm.sender)
-		return false
-	}
-	return true
+	return p.identity.Cert.VerifySig(pm.Sender, proposeMessageDomain, pm.HashWithoutSig(), pm.Sig)
 }
 
 // GetValue returns the output of the protocol (blocking)
@@ -1,30 +1,40 @@
 package blockagreement
 
 import (
-	"crypto/sha256"
 	"sort"
-	"strconv"
 
-	"github.com/niclabs/tcrsa"
 	"github.com/sochsenreither/tardigrade/utils"
 )
 
-type thresholdCrypto struct {
-	KeyShare *tcrsa.KeyShare
-	KeyMeta  *tcrsa.KeyMeta
-}
+// Domains of the signatures on the messages of block agreement
+const (
+	voteMessageDomain    = "bla-vote"
+	proposeMessageDomain = "bla-propose"
+	commitMessageDomain  = "bla-commit"
+)
+
+// Domains of the hashes of the messages of block agreement
+const (
+	voteHashDomain                 = "tardigrade/bla-vote"
+	voteMessageHashDomain          = "tardigrade/bla-vote-message"
+	signedVoteMessageHashDomain    = "tardigrade/bla-signed-vote-message"
+	proposeMessageHashDomain       = "tardigrade/bla-propose-message"
+	signedProposeMessageHashDomain = "tardigrade/bla-signed-propose-message"
+	commitMessageHashDomain        = "tardigrade/bla-commit-message"
+	signedCommitMessageHashDomain  = "tardigrade/bla-signed-commit-message"
+)
 
 type VoteMessage struct {
 	Sender int
 	Vote   *Vote
-	Sig    *tcrsa.SigShare // Signature on sender and vote
+	Sig    []byte // Signature on sender and vote
 }
 
 type ProposeMessage struct {
 	Sender       int
 	Vote         *Vote
 	VoteMessages map[int]*VoteMessage // nodeId -> voteMessage
-	Sig          *tcrsa.SigShare      // Signature on sender, vote and voteMessages
+	Sig          []byte               // Signature on sender, vote and voteMessages
 }
 type Vote struct {
 	Round      int
@@ -34,78 +44,48 @@ type Vote struct {
 
 // Hash returns a sha256 hash over all fields of the struct vote
 func (v *Vote) Hash() [32]byte {
-	roundHash := sha256.Sum256([]byte(strconv.Itoa(v.Round)))
-	blockShareHash := v.BlockShare.Hash()
-	commitsHash := make([]byte, 0)
+	e := utils.NewEncoder(voteHashDomain).Int(v.Round).Bool(v.BlockShare != nil)
+	if v.BlockShare != nil {
+		e.Hash(v.BlockShare.Hash())
+	}
+	e.Int(len(v.Commits))
 	for _, c := range v.Commits {
-		h := c.Hash()
-		commitsHash = append(commitsHash, h[:]...)
+		e.Hash(c.Hash())
 	}
-	l := make([]byte, 0)
-	l = append(l, roundHash[:]...)
-	l = append(l, blockShareHash[:]...)
-	l = append(l, commitsHash...)
-	return sha256.Sum256(l)
+	return e.Sum()
 }
 
 // Hash returns a sha256 hash over all the fields of the struct vote
 func (vm *VoteMessage) Hash() [32]byte {
-	h := vm.HashWithoutSig()
-	sigHash := sha256.Sum256(vm.Sig.Xi)
-	l := make([]byte, 0)
-	l = append(l, h[:]...)
-	l = append(l, sigHash[:]...)
-	return sha256.Sum256(l)
+	return utils.NewEncoder(signedVoteMessageHashDomain).Hash(vm.HashWithoutSig()).Bytes(vm.Sig).Sum()
 }
 
 // HashWithoutSig returns a sha256 hash over sender and vote
 func (vm *VoteMessage) HashWithoutSig() [32]byte {
-	senderHash := sha256.Sum256([]byte(strconv.Itoa(vm.Sender)))
-	voteHash := vm.Vote.Hash()
-	h := make([]byte, 0)
-	h = append(h, senderHash[:]...)
-	h = append(h, voteHash[:]...)
-	hash := sha256.Sum256(h)
-	return hash
+	return utils.NewEncoder(voteMessageHashDomain).Int(vm.Sender).Hash(vm.Vote.Hash()).Sum()
 }
 
 // Hash returns a sha256 hash over all the fields of the struct proposeMessage
 func (pm *ProposeMessage) Hash() [32]byte {
-	h := pm.HashWithoutSig()
-	s := sha256.Sum256(pm.Sig.Xi)
-	l := make([]byte, 0)
-	l = append(l, h[:]...)
-	l = append(l, s[:]...)
-	hash := sha256.Sum256(l)
-	return hash
+	return utils.NewEncoder(signedProposeMessageHashDomain).Hash(pm.HashWithoutSig()).Bytes(pm.Sig).Sum()
 }
 
-// HashWithoutSig returns a sha256 hash over sender, vote and voteMessages
+// HashWithoutSig returns a sha256 hash over sender, vote and voteMessages. The vote messages are
+// encoded with their node id in ascending order.
 func (pm *ProposeMessage) HashWithoutSig() [32]byte {
-	senderHash := sha256.Sum256([]byte(strconv.Itoa(pm.Sender)))
-	voteHash := pm.Vote.Hash()
-	vh := make([]byte, 0)
-	// We need to iterate in a deterministic manner over the map
-	// First collect all keys the iterate over the map with the sorted keys
-	keys := make([]int, len(pm.VoteMessages))
+	keys := make([]int, 0, len(pm.VoteMessages))
 	for k := range pm.VoteMessages {
 		keys = append(keys, k)
 	}
 	sort.Ints(keys)
+	e := utils.NewEncoder(proposeMessageHashDomain).Int(pm.Sender).Hash(pm.Vote.Hash()).Int(len(keys))
 	for _, k := range keys {
-		if pm.VoteMessages[k] == nil {
-			// TODO: bug? why can there be a vote == nil in here?
-			continue
+		e.Int(k).Bool(pm.VoteMessages[k] != nil)
+		if pm.VoteMessages[k] != nil {
+			e.Hash(pm.VoteMessages[k].Hash())
 		}
-		h := pm.VoteMessages[k].Hash()
-		vh = append(vh, h[:]...)
 	}
-	l := make([]byte, 0)
-	l = append(l, senderHash[:]...)
-	l = append(l, voteHash[:]...)
-	l = append(l, vh...)
-	hash := sha256.Sum256(l)
-	return hash
+	return e.Sum()
 }
 
 type GradedConsensusResult struct {
@@ -125,27 +105,19 @@ type CommitMessage struct {
 	Sender     int
 	Round      int
 	BlockShare *utils.BlockShare
-	Sig        *tcrsa.SigShare
+	Sig        []byte // Signature on sender, round and blockShare
 }
 
 // Hash returns a sha256 hash over all the fields of struct commitMessage
 func (c *CommitMessage) Hash() [32]byte {
-	h := c.HashWithoutSig()
-	s := sha256.Sum256(c.Sig.Xi)
-	l := make([]byte, 0)
-	l = append(l, h[:]...)
-	l = append(l, s[:]...)
-	return sha256.Sum256(l)
+	return utils.NewEncoder(signedCommitMessageHashDomain).Hash(c.HashWithoutSig()).Bytes(c.Sig).Sum()
 }
 
 // HashWithoutSig returns a sha256 hash over sender, round and blockShare
 func (c *CommitMessage) HashWithoutSig() [32]byte {
-	s := sha256.Sum256([]byte(strconv.Itoa(c.Sender)))
-	r := sha256.Sum256([]byte(strconv.Itoa(c.Round)))
-	bs := c.BlockShare.Hash()
-	l := make([]byte, 0)
-	l = append(l, bs[:]...)
-	l = append(l, s[:]...)
-	l = append(l, r[:]...)
-	return sha256.Sum256(l)
+	e := utils.NewEncoder(commitMessageHashDomain).Int(c.Sender).Int(c.Round).Bool(c.BlockShare != nil)
+	if c.BlockShare != nil {
+		e.Hash(c.BlockShare.Hash())
+	}
+	return e.Sum()
 }
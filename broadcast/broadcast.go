@@ -1,16 +1,19 @@
 package broadcast
 
 import (
-	"crypto"
 	"crypto/sha256"
 
 	// "log"
-	"strconv"
 
-	"github.com/niclabs/tcrsa"
 	"github.com/sochsenreither/tardigrade/utils"
 )
 
+// Domains of the signatures on committee messages and of their hashes
+const (
+	committeeMessageDomain     = "rbc-committee"
+	committeeMessageHashDomain = "tardigrade/rbc-committee-message"
+)
+
 type ReliableBroadcast struct {
 	UROUND    int
 	n         int                      // Number of nodes
@@ -21,16 +24,11 @@ type ReliableBroadcast struct {
 	committee map[int]bool             // List of committee members
 	value     *utils.BlockShare        // Input value of the sender
 	out       chan *utils.BlockShare   // Output channel
-	Sig       *Signature               // Personal signature and keymeta
+	identity  *utils.Identity          // Identity key and membership certificate
 	multicast func(msg *utils.Message) // Function for multicasting messages
 	receive   func() *utils.Message    // Blocking function for receiving messages
 }
 
-type Signature struct {
-	Proof *tcrsa.SigShare // Signature on node index signed by the dealer
-	KeyMeta  *tcrsa.KeyMeta  // Contains public keys to verify signatures
-}
-
 // Struct representing a message for Bracha's asynchronous reliable broadcast protocol
 type BMessage struct {
 	Sender int
@@ -43,7 +41,7 @@ type CMessage struct {
 	Sender int
 	Value  *utils.BlockShare
 	Hash   [32]byte
-	Proof  *tcrsa.SigShare // sigShare on the nodeId as proof that the sender is in the committee
+	Sig    []byte // Signature of the sender on the hash, instance and round
 }
 
 // Struct repesenting a value send from the sender to the committee
@@ -63,7 +61,7 @@ type ReliableBroadcastConfig struct {
 	Instance int
 }
 
-func NewReliableBroadcast(cfg *ReliableBroadcastConfig, committee map[int]bool, sig *Signature, handlerFuncs *utils.HandlerFuncs) *ReliableBroadcast {
+func NewReliableBroadcast(cfg *ReliableBroadcastConfig, committee map[int]bool, identity *utils.Identity, handlerFuncs *utils.HandlerFuncs) *ReliableBroadcast {
 	out := make(chan *utils.BlockShare, 100)
 	tk := (((1 - cfg.Epsilon) * cfg.Kappa * cfg.T) / cfg.N)
 	rbc := &ReliableBroadcast{
@@ -76,7 +74,7 @@ func NewReliableBroadcast(cfg *ReliableBroadcastConfig, committee map[int]bool,
 		committee: committee,
 		value:     nil,
 		out:       out,
-		Sig:       sig,
+		identity:  identity,
 	}
 	rbc.multicast = func(msg *utils.Message) {
 		handlerFuncs.RBCmulticast(msg, rbc.UROUND, cfg.Instance)
@@ -290,7 +288,7 @@ func (rbc *ReliableBroadcast) multicastCommitteeMessage(senderValue *utils.Block
 				Sender: rbc.nodeId,
 				Value:  senderValue,
 				Hash:   broadcastValue,
-				Proof:  rbc.Sig.Proof,
+				Sig:    rbc.identity.Sign(committeeMessageDomain, rbc.committeeMessageHash(broadcastValue)),
 			},
 		}
 		rbc.multicast(mes)
@@ -300,7 +298,10 @@ func (rbc *ReliableBroadcast) multicastCommitteeMessage(senderValue *utils.Block
 // isValidCommitteeMessage return wheter a message from a committee member is valid. The sender
 // must be in the committee, the hash must be correct and the signature must be valid.
 func (rbc *ReliableBroadcast) isValidCommitteeMessage(m *CMessage) bool {
-	if !rbc.committee[m.Sender] {
+	if !rbc.committee[m.Sender] || !rbc.identity.Cert.IsCommittee(m.Sender) {
+		return false
+	}
+	if m.Value == nil {
 		return false
 	}
 	hash := m.Value.Hash()
@@ -310,19 +311,15 @@ func (rbc *ReliableBroadcast) isValidCommitteeMessage(m *CMessage) bool {
 	return rbc.isValidSignature(m)
 }
 
-// isValidSignature returns whether a signature is valid.
+// isValidSignature returns whether the signature of the sender on the message is valid.
 func (rbc *ReliableBroadcast) isValidSignature(m *CMessage) bool {
-	hash := sha256.Sum256([]byte(strconv.Itoa(m.Sender)))
-	paddedHash, err := tcrsa.PrepareDocumentHash(rbc.Sig.KeyMeta.PublicKey.Size(), crypto.SHA256, hash[:])
-	if err != nil {
-		// log.Printf("%d failed to hash id of %d, err: %s", rbc.nodeId, m.sender, err)
-		return false
-	}
-	if err = m.Proof.Verify(paddedHash, rbc.Sig.KeyMeta); err != nil {
-		// log.Printf("%d received invalid signature from %d", rbc.nodeId, m.sender)
-		return false
-	}
-	return true
+	return rbc.identity.Cert.VerifySig(m.Sender, committeeMessageDomain, rbc.committeeMessageHash(m.Hash), m.Sig)
+}
+
+// committeeMessageHash returns a sha256 hash over the round, the instance and the hash of a value.
+// This prevents committee messages from being replayed in other instances.
+func (rbc *ReliableBroadcast) committeeMessageHash(hash [32]byte) [32]byte {
+	return utils.NewEncoder(committeeMessageHashDomain).Int(rbc.UROUND).Int(rbc.senderId).Hash(hash).Sum()
 }
 
 // GetValue returns the output of the protocol (blocking)
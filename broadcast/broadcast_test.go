@@ -2,10 +2,7 @@ package broadcast
 
 import (
 	"bytes"
-	"crypto"
-	"crypto/sha256"
 	"fmt"
-	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -22,9 +19,9 @@ func setupKeys(n int) (tcrsa.KeyShareList, *tcrsa.KeyMeta) {
 	return keyShares, keyMeta
 }
 
-func setupBlockShare(n, i int, mes []byte, keyShare *tcrsa.KeyShare, keyMeta *tcrsa.KeyMeta) *utils.BlockShare {
+func setupBlockShare(n, i int, mes []byte, identity *utils.Identity) *utils.BlockShare {
 	preBlock := utils.NewPreBlock(n)
-	preBlocKMessage, _ := utils.NewPreBlockMessage(mes, keyShare, keyMeta)
+	preBlocKMessage := utils.NewPreBlockMessage(mes, "small", identity)
 	preBlock.AddMessage(i, preBlocKMessage)
 	preBlockHash := preBlock.Hash()
 	// for now the signature isn't relevant, since this gets checked in the main protocol
@@ -55,23 +52,18 @@ func TestBroadcastParallelMultipleSendersOneRound(t *testing.T) {
 	committee := make(map[int]bool)
 	committee[0] = true
 	committee[1] = true
+
+	// Dealer creates identity keys
+	identities, err := utils.NewIdentities(n, 0, committee, keyShares, keyMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
 	var blockShares []*utils.BlockShare
 	for i := 0; i < n; i++ {
-		blockShares = append(blockShares, setupBlockShare(n, i, inputs[i], keyShares[i], keyMeta))
+		blockShares = append(blockShares, setupBlockShare(n, i, inputs[i], identities[i]))
 	}
 
-
-
 	for i := 0; i < n-ta; i++ {
-		// Dealer signs node id
-		hash := sha256.Sum256([]byte(strconv.Itoa(i)))
-		paddedHash, _ := tcrsa.PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, hash[:])
-		sig, _ := keyShares[len(keyShares)-1].Sign(paddedHash, crypto.SHA256, keyMeta)
-		signature := &Signature{
-			Proof: sig,
-			KeyMeta:  keyMeta,
-		}
-
 		// Create new handler
 		handlers = append(handlers, utils.NewLocalHandler(nodeChans, nil, i, n, kappa))
 
@@ -85,7 +77,7 @@ func TestBroadcastParallelMultipleSendersOneRound(t *testing.T) {
 				SenderId: j,
 				Instance: j,
 			}
-			broadcasts[i] = append(broadcasts[i], NewReliableBroadcast(config, committee, signature, handlers[i].Funcs))
+			broadcasts[i] = append(broadcasts[i], NewReliableBroadcast(config, committee, identities[i], handlers[i].Funcs))
 			if i == j {
 				broadcasts[i][j].SetValue(blockShares[j])
 			}
@@ -2,12 +2,8 @@ package commonsubset
 
 import (
 	"bytes"
-	"crypto"
-	"crypto/rsa"
-	"crypto/sha256"
 
 	// "log"
-	"strconv"
 	"sync"
 
 	"github.com/niclabs/tcrsa"
@@ -33,10 +29,17 @@ type CommonSubset struct {
 	sync.Mutex
 }
 
+// Domains of the signatures on committee messages and of the hashes
+const (
+	committeeMessageDomain     = "acs-committee"
+	committeeMessageHashDomain = "tardigrade/acs-committee-message"
+	valuesHashDomain           = "tardigrade/acs-values"
+)
+
 type ThresholdCrypto struct {
 	Sk       *tcrsa.KeyShare // Private signing key
 	KeyMeta  *tcrsa.KeyMeta  // Contains public keys to verify signatures
-	Proof    *tcrsa.SigShare // Signature on node index signed by the dealer
+	Identity *utils.Identity // Identity key and membership certificate
 	KeyMetaC *tcrsa.KeyMeta  // Contains public keys to verify signatures of committee members
 	SkC      *tcrsa.KeyShare // Private signing key for committee members
 }
@@ -52,7 +55,7 @@ type AcsCommitteeMessage struct {
 	Values   []*utils.BlockShare
 	Hash     [32]byte
 	SigShare *tcrsa.SigShare // sigShare on hash
-	Proof    *tcrsa.SigShare // sigShare on the nodeId as proof that the sender is in the committee
+	Sig      []byte          // Signature of the sender on the hash and round
 }
 
 type ACSConfig struct {
@@ -335,7 +338,7 @@ func (acs *CommonSubset) multicastCommit(values []*utils.BlockShare) {
 		Values:   values,
 		Hash:     hash,
 		SigShare: sig,
-		Proof:    acs.tc.Proof,
+		Sig:      acs.tc.Identity.Sign(committeeMessageDomain, acs.committeeMessageHash(hash)),
 	}
 	mes := &utils.Message{
 		Sender:  acs.nodeId,
@@ -348,30 +351,28 @@ func (acs *CommonSubset) multicastCommit(values []*utils.BlockShare) {
 
 // hashValues returns the hash of a slice of byte slices
 func (acs *CommonSubset) hashValues(values []*utils.BlockShare) [32]byte {
-	var data []byte
+	e := utils.NewEncoder(valuesHashDomain).Int(len(values))
 	for _, v := range values {
-		h := v.Hash()
-		data = append(data, h[:]...)
+		e.Hash(v.Hash())
 	}
-	hash := sha256.Sum256(data)
-	return hash
+	return e.Sum()
 }
 
 // signHash signs a given hash. Only committee member will call this.
 func (acs *CommonSubset) signHash(hash [32]byte) (*tcrsa.SigShare, error) {
-	paddedHash, err := tcrsa.PrepareDocumentHash(acs.tc.KeyMetaC.PublicKey.Size(), crypto.SHA256, hash[:])
+	paddedHash, err := utils.PrepareSigHash(acs.tc.KeyMetaC, acs.tc.Identity.Cert.SignatureHash(), hash[:])
 	if err != nil {
 		//// log.Printf("Node %d UROUND %d failed to create padded hash", acs.nodeId, acs.UROUND)
 		return nil, err
 	}
-	sig, err := acs.tc.SkC.Sign(paddedHash, crypto.SHA256, acs.tc.KeyMetaC)
+	sig, err := acs.tc.SkC.Sign(paddedHash, acs.tc.Identity.Cert.SignatureHash(), acs.tc.KeyMetaC)
 	return sig, err
 }
 
 // handleCommit checks if a received commit message is valid and checks if enough are received on
 // the same value and then forms a signature and multicasts it.
 func (acs *CommonSubset) handleCommit(m *AcsCommitteeMessage, sharesReceived map[[32]byte]map[int]*tcrsa.SigShare) ([]byte, tcrsa.Signature) {
-	if !acs.committee[m.Sender] {
+	if !acs.committee[m.Sender] || !acs.tc.Identity.Cert.IsCommittee(m.Sender) {
 		return nil, nil
 	}
 	if !acs.isValidSignature(m) {
@@ -388,7 +389,7 @@ func (acs *CommonSubset) handleCommit(m *AcsCommitteeMessage, sharesReceived map
 		for _, sig := range sharesReceived[m.Hash] {
 			sigShares = append(sigShares, sig)
 		}
-		paddedHash, err := tcrsa.PrepareDocumentHash(acs.tc.KeyMetaC.PublicKey.Size(), crypto.SHA256, m.Hash[:])
+		paddedHash, err := utils.PrepareSigHash(acs.tc.KeyMetaC, acs.tc.Identity.Cert.SignatureHash(), m.Hash[:])
 		if err != nil {
 			// log.Printf("Node %d failed to create padded hash", acs.nodeId)
 			return nil, nil
@@ -415,7 +416,7 @@ func (acs *CommonSubset) handleCommit(m *AcsCommitteeMessage, sharesReceived map
 
 // handleSignatureMessage verifies a combined signature and if it is valid multicasts it.
 func (acs *CommonSubset) handleSignatureMessage(m *AcsSignatureMessage) ([]byte, tcrsa.Signature) {
-	err := rsa.VerifyPKCS1v15(acs.tc.KeyMetaC.PublicKey, crypto.SHA256, m.Hash[:], *m.Sig)
+	err := utils.VerifyThresholdSig(acs.tc.KeyMetaC, acs.tc.Identity.Cert.SignatureHash(), m.Hash[:], *m.Sig)
 	if err != nil {
 		// log.Printf("Node %d received signature message with invalid signature", acs.nodeId)
 		return nil, nil
@@ -433,14 +434,18 @@ func (acs *CommonSubset) handleSignatureMessage(m *AcsSignatureMessage) ([]byte,
 	return m.Hash[:], *m.Sig
 }
 
-// isValidSignature returns whether a signature for a hash and a proof on the nodeId is valid.
+// isValidSignature returns whether the signature share on the hash and the signature of the sender
+// are valid.
 func (acs *CommonSubset) isValidSignature(m *AcsCommitteeMessage) bool {
+	if m.SigShare == nil {
+		return false
+	}
 	hash := acs.hashValues(m.Values)
 	if hash != m.Hash {
 		// log.Printf("Node %d received message with invalid hash", acs.nodeId)
 		return false
 	}
-	paddedHash, err := tcrsa.PrepareDocumentHash(acs.tc.KeyMetaC.PublicKey.Size(), crypto.SHA256, hash[:])
+	paddedHash, err := utils.PrepareSigHash(acs.tc.KeyMetaC, acs.tc.Identity.Cert.SignatureHash(), hash[:])
 	if err != nil {
 		// log.Printf("Node %d failed to create padded hash", acs.nodeId)
 		return false
@@ -450,18 +455,13 @@ func (acs *CommonSubset) isValidSignature(m *AcsCommitteeMessage) bool {
 		return false
 	}
 
-	// Verify nodeId
-	hash = sha256.Sum256([]byte(strconv.Itoa(m.Sender)))
-	paddedHash, err = tcrsa.PrepareDocumentHash(acs.tc.KeyMeta.PublicKey.Size(), crypto.SHA256, hash[:])
-	if err != nil {
-		// log.Printf("%d failed to hash id of %d, err: %s", acs.nodeId, m.sender, err)
-		return false
-	}
-	if err = m.Proof.Verify(paddedHash, acs.tc.KeyMeta); err != nil {
-		// log.Printf("%d received invalid signature from %d", acs.nodeId, m.sender)
-		return false
-	}
-	return true
+	// Verify that the message was sent by the committee member
+	return acs.tc.Identity.Cert.VerifySig(m.Sender, committeeMessageDomain, acs.committeeMessageHash(hash), m.Sig)
+}
+
+// committeeMessageHash returns a sha256 hash over the round and the hash of the values.
+func (acs *CommonSubset) committeeMessageHash(hash [32]byte) [32]byte {
+	return utils.NewEncoder(committeeMessageHashDomain).Int(acs.UROUND).Hash(hash).Sum()
 }
 
 // canTerminate returns whether the termination conditions are met.
@@ -2,10 +2,7 @@ package commonsubset
 
 import (
 	"bytes"
-	"crypto"
-	"crypto/sha256"
 	"fmt"
-	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -26,10 +23,14 @@ func TestACSSameValue(t *testing.T) {
 	committee[0] = true
 	committee[1] = true
 	keyShares, keyMeta, coin, keySharesC, keyMetaC := setupKeys(n, committee)
+	identities, err := utils.NewIdentities(n, 0, committee, keyShares, keyMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
 	input := []byte("zero")
 	var blockShares []*utils.BlockShare
 	for i := 0; i < n-ta; i++ {
-		blockShares = append(blockShares, setupBlockShare(n, i, input, keyShares[0], keyMeta))
+		blockShares = append(blockShares, setupBlockShare(n, 0, input, identities[0]))
 	}
 
 	nodeChans := make(map[int]chan *utils.HandlerMessage)
@@ -42,7 +43,7 @@ func TestACSSameValue(t *testing.T) {
 	}
 
 	abas := setupAba(n, ta, keyShares, keyMeta, coin, handlers)
-	rbcs := setupRbc(n, ta, keyShares, keyMeta, coin, blockShares, committee, handlers)
+	rbcs := setupRbc(n, ta, identities, blockShares, committee, handlers)
 
 	acs := make(map[int]*CommonSubset)
 
@@ -50,7 +51,7 @@ func TestACSSameValue(t *testing.T) {
 		tc := &ThresholdCrypto{
 			Sk:       keyShares[i],
 			KeyMeta:  keyMeta,
-			Proof: rbcs[i][0].Sig.Proof,
+			Identity: identities[i],
 			KeyMetaC: keyMetaC,
 		}
 		if committee[i] {
@@ -97,10 +98,14 @@ func TestACSDifferentValues(t *testing.T) {
 	committee[0] = true
 	committee[1] = true
 	keyShares, keyMeta, coin, keySharesC, keyMetaC := setupKeys(n, committee)
+	identities, err := utils.NewIdentities(n, 0, committee, keyShares, keyMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
 	inputs := [7][]byte{[]byte("zero"), []byte("one"), []byte("two"), []byte("three"), []byte("four"), []byte("five"), []byte("six")}
 	var blockShares []*utils.BlockShare
 	for i := 0; i < n; i++ {
-		blockShares = append(blockShares, setupBlockShare(n, i, inputs[i], keyShares[i], keyMeta))
+		blockShares = append(blockShares, setupBlockShare(n, i, inputs[i], identities[i]))
 	}
 
 	nodeChans := make(map[int]chan *utils.HandlerMessage)
@@ -113,7 +118,7 @@ func TestACSDifferentValues(t *testing.T) {
 	}
 
 	abas := setupAba(n, ta, keyShares, keyMeta, coin, handlers)
-	rbcs := setupRbc(n, ta, keyShares, keyMeta, coin, blockShares, committee, handlers)
+	rbcs := setupRbc(n, ta, identities, blockShares, committee, handlers)
 
 	acs := make(map[int]*CommonSubset)
 
@@ -121,7 +126,7 @@ func TestACSDifferentValues(t *testing.T) {
 		tc := &ThresholdCrypto{
 			Sk:       keyShares[i],
 			KeyMeta:  keyMeta,
-			Proof: rbcs[i][0].Sig.Proof,
+			Identity: identities[i],
 			KeyMetaC: keyMetaC,
 		}
 		if committee[i] {
@@ -180,18 +185,10 @@ func setupAba(n, ta int, keyShares tcrsa.KeyShareList, keyMeta *tcrsa.KeyMeta, c
 	return abas
 }
 
-func setupRbc(n, ta int, keyShares tcrsa.KeyShareList, keyMeta *tcrsa.KeyMeta, coin *aba.CommonCoin, inputs []*utils.BlockShare, committee map[int]bool, handlers []*utils.LocalHandler) map[int][]*rbc.ReliableBroadcast {
+func setupRbc(n, ta int, identities []*utils.Identity, inputs []*utils.BlockShare, committee map[int]bool, handlers []*utils.LocalHandler) map[int][]*rbc.ReliableBroadcast {
 	broadcasts := make(map[int][]*rbc.ReliableBroadcast)
 
 	for i := 0; i < n-ta; i++ {
-		// Dealer signs node id
-		hash := sha256.Sum256([]byte(strconv.Itoa(i)))
-		paddedHash, _ := tcrsa.PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, hash[:])
-		sig, _ := keyShares[len(keyShares)-1].Sign(paddedHash, crypto.SHA256, keyMeta)
-		signature := &rbc.Signature{
-			Proof: sig,
-			KeyMeta:  keyMeta,
-		}
 		for j := 0; j < n; j++ {
 			config := &rbc.ReliableBroadcastConfig{
 				N:        n,
@@ -203,7 +200,7 @@ func setupRbc(n, ta int, keyShares tcrsa.KeyShareList, keyMeta *tcrsa.KeyMeta, c
 				Instance: j,
 				UROUND:   0,
 			}
-			broadcasts[i] = append(broadcasts[i], rbc.NewReliableBroadcast(config, committee, signature, handlers[i].Funcs))
+			broadcasts[i] = append(broadcasts[i], rbc.NewReliableBroadcast(config, committee, identities[i], handlers[i].Funcs))
 			if i == j {
 				broadcasts[i][j].SetValue(inputs[j])
 			}
@@ -230,9 +227,9 @@ func setupKeys(n int, committee map[int]bool) (tcrsa.KeyShareList, *tcrsa.KeyMet
 	return keyShares, keyMeta, commonCoin, keySharesC, keyMetaC
 }
 
-func setupBlockShare(n, i int, mes []byte, keyShare *tcrsa.KeyShare, keyMeta *tcrsa.KeyMeta) *utils.BlockShare {
+func setupBlockShare(n, i int, mes []byte, identity *utils.Identity) *utils.BlockShare {
 	preBlock := utils.NewPreBlock(n)
-	preBlocKMessage, _ := utils.NewPreBlockMessage(mes, keyShare, keyMeta)
+	preBlocKMessage := utils.NewPreBlockMessage(mes, "small", identity)
 	preBlock.AddMessage(i, preBlocKMessage)
 	preBlockHash := preBlock.Hash()
 	// for now the signature isn't relevant, since this gets checked in the main protocol
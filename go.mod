@@ -1,10 +1,14 @@
 module github.com/sochsenreither/tardigrade
 
-go 1.17
+go 1.19
 
 require github.com/niclabs/tcrsa v0.0.5
 
 require (
-	github.com/niclabs/tcpaillier v0.0.7 // indirect
+	github.com/niclabs/tcpaillier v0.0.7
+	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
+	golang.org/x/term v0.10.0
 	golang.org/x/text v0.3.7
 )
+
+require golang.org/x/sys v0.10.0 // indirect
@@ -0,0 +1,72 @@
+package kvstore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Client submits commands to the nodes of the key-value store and reads from them.
+type Client struct {
+	id    uint64  // Unique id of the client
+	seq   uint64  // Sequence number of the next command
+	nodes []*Node // Nodes the commands are submitted to. Reads are served by the first node
+	sync.Mutex
+}
+
+func NewClient(id uint64, nodes []*Node) *Client {
+	return &Client{
+		id:    id,
+		nodes: nodes,
+	}
+}
+
+// Put sets key to value.
+func (c *Client) Put(key string, value []byte) (CommandID, error) {
+	return c.submit(&Command{Op: OpPut, Key: key, Value: value})
+}
+
+// Delete removes key.
+func (c *Client) Delete(key string) (CommandID, error) {
+	return c.submit(&Command{Op: OpDelete, Key: key})
+}
+
+// CompareAndSwap sets key to value if its current value is expected.
+func (c *Client) CompareAndSwap(key string, expected, value []byte) (CommandID, error) {
+	return c.submit(&Command{Op: OpCompareAndSwap, Key: key, Expected: expected, Value: value})
+}
+
+// Get returns the value of key as seen by the first node.
+func (c *Client) Get(key string) ([]byte, bool) {
+	return c.nodes[0].Store.Get(key)
+}
+
+// Wait waits until the command is committed at the first node and returns its result.
+func (c *Client) Wait(id CommandID, timeout time.Duration) (*Result, error) {
+	select {
+	case <-c.nodes[0].Store.committed(id):
+		res, _ := c.nodes[0].Store.Result(id)
+		return res, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("command %s wasn't committed within %s", id, timeout)
+	}
+}
+
+// submit assigns the next id to the command and submits it to all nodes, so that it gets proposed
+// even if some nodes are faulty.
+func (c *Client) submit(cmd *Command) (CommandID, error) {
+	c.Lock()
+	cmd.ID = CommandID{Client: c.id, Seq: c.seq}
+	tx, err := cmd.Encode()
+	if err != nil {
+		c.Unlock()
+		return CommandID{}, err
+	}
+	c.seq++
+	c.Unlock()
+
+	for _, node := range c.nodes {
+		node.Submit(tx)
+	}
+	return cmd.ID, nil
+}
@@ -0,0 +1,138 @@
+package kvstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Operations of a command. The values are never zero, so the first byte of an encoded command
+// survives the conversion to a plaintext of the encryption scheme.
+const (
+	OpPut            byte = 'P' // Sets the value of a key
+	OpDelete         byte = 'D' // Removes a key
+	OpCompareAndSwap byte = 'C' // Sets the value of a key if it has the expected value
+)
+
+// MaxCommandSize is the maximum size of an encoded command. Commands have to fit into the
+// plaintext space of a 512 bit encryption key.
+const MaxCommandSize = 60
+
+// CommandID identifies a command. Every client numbers its commands consecutively.
+type CommandID struct {
+	Client uint64
+	Seq    uint64
+}
+
+func (id CommandID) String() string {
+	return fmt.Sprintf("%d/%d", id.Client, id.Seq)
+}
+
+// Command is a transaction of the key-value store.
+type Command struct {
+	ID       CommandID
+	Op       byte
+	Key      string
+	Value    []byte // New value for put and compare-and-swap
+	Expected []byte // Expected value for compare-and-swap. A missing key has an empty value
+}
+
+// Encode returns the encoding of the command that is submitted as transaction.
+func (cmd *Command) Encode() ([]byte, error) {
+	buf := []byte{cmd.Op}
+	buf = appendUvarint(buf, cmd.ID.Client)
+	buf = appendUvarint(buf, cmd.ID.Seq)
+	buf = appendField(buf, []byte(cmd.Key))
+	switch cmd.Op {
+	case OpPut:
+		buf = appendField(buf, cmd.Value)
+	case OpDelete:
+	case OpCompareAndSwap:
+		buf = appendField(buf, cmd.Expected)
+		buf = appendField(buf, cmd.Value)
+	default:
+		return nil, fmt.Errorf("unknown operation %q", cmd.Op)
+	}
+	if len(buf) > MaxCommandSize {
+		return nil, fmt.Errorf("command has %d bytes, at most %d are allowed", len(buf), MaxCommandSize)
+	}
+	return buf, nil
+}
+
+// DecodeCommand decodes a command and returns an error if tx isn't a valid command.
+func DecodeCommand(tx []byte) (*Command, error) {
+	if len(tx) == 0 || len(tx) > MaxCommandSize {
+		return nil, errors.New("invalid command size")
+	}
+	d := &decoder{buf: tx[1:]}
+	cmd := &Command{
+		Op: tx[0],
+	}
+	cmd.ID.Client = d.uvarint()
+	cmd.ID.Seq = d.uvarint()
+	cmd.Key = string(d.field())
+	switch cmd.Op {
+	case OpPut:
+		cmd.Value = d.field()
+	case OpDelete:
+	case OpCompareAndSwap:
+		cmd.Expected = d.field()
+		cmd.Value = d.field()
+	default:
+		return nil, fmt.Errorf("unknown operation %q", cmd.Op)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(d.buf) != 0 {
+		return nil, errors.New("trailing bytes after command")
+	}
+	return cmd, nil
+}
+
+// appendUvarint appends the varint encoding of v.
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	return append(buf, b[:n]...)
+}
+
+// appendField appends b prefixed with its length.
+func appendField(buf, b []byte) []byte {
+	buf = appendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// decoder reads the fields of a command. After the first error all reads return zero values.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errors.New("invalid integer")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) field() []byte {
+	l := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if l > uint64(len(d.buf)) {
+		d.err = errors.New("field exceeds command")
+		return nil
+	}
+	b := make([]byte, l)
+	copy(b, d.buf)
+	d.buf = d.buf[l:]
+	return b
+}
@@ -0,0 +1,162 @@
+// Package kvstore is an example application of the ABC: a replicated key-value store. Clients
+// submit put, delete and compare-and-swap commands as transactions. Every node applies the
+// finalized blocks in commit order, so all nodes end up with the same state and serve reads
+// locally.
+package kvstore
+
+import (
+	"bytes"
+	"log"
+	"sort"
+	"sync"
+
+	abc "github.com/sochsenreither/tardigrade/tardigrade"
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+// Domain of the hash of the state
+const stateHashDomain = "tardigrade/kvstore-state"
+
+// Result is the outcome of a committed command.
+type Result struct {
+	Round   int  // Round in which the command was committed
+	Applied bool // False if the expected value of a compare-and-swap didn't match
+}
+
+// KVStore is the state machine of the key-value store. It implements abc.Application.
+type KVStore struct {
+	data    map[string][]byte             // Maps key -> value
+	results map[CommandID]*Result         // Results of all committed commands
+	height  int                           // Number of rounds that were applied
+	waiting map[CommandID][]chan struct{} // Closed when the command is committed
+	sync.Mutex
+}
+
+func NewKVStore() *KVStore {
+	return &KVStore{
+		data:    make(map[string][]byte),
+		results: make(map[CommandID]*Result),
+		waiting: make(map[CommandID][]chan struct{}),
+	}
+}
+
+// CheckTx only admits valid commands to the buffer.
+func (s *KVStore) CheckTx(tx []byte) error {
+	_, err := DecodeCommand(tx)
+	return err
+}
+
+// DeliverBlock applies all commands of the block in order. Invalid transactions and commands that
+// were already committed in an earlier block are skipped, so every node applies the same commands.
+func (s *KVStore) DeliverBlock(c *abc.Commit) {
+	s.Lock()
+	defer s.Unlock()
+	for _, tx := range c.Block.Txs {
+		cmd, err := DecodeCommand(tx)
+		if err != nil {
+			log.Printf("KV store round %d: skipping invalid command: %s", c.Round, err)
+			continue
+		}
+		if _, ok := s.results[cmd.ID]; ok {
+			continue
+		}
+		s.results[cmd.ID] = &Result{
+			Round:   c.Round,
+			Applied: s.apply(cmd),
+		}
+		for _, ch := range s.waiting[cmd.ID] {
+			close(ch)
+		}
+		delete(s.waiting, cmd.ID)
+	}
+	s.height = c.Round + 1
+}
+
+// apply executes a command and returns whether it changed the state.
+func (s *KVStore) apply(cmd *Command) bool {
+	switch cmd.Op {
+	case OpPut:
+		s.data[cmd.Key] = cmd.Value
+	case OpDelete:
+		delete(s.data, cmd.Key)
+	case OpCompareAndSwap:
+		if !bytes.Equal(s.data[cmd.Key], cmd.Expected) {
+			return false
+		}
+		s.data[cmd.Key] = cmd.Value
+	}
+	return true
+}
+
+// Commit returns a hash over all keys and values in ascending order of the keys.
+func (s *KVStore) Commit() [32]byte {
+	s.Lock()
+	defer s.Unlock()
+	keys := make([]string, 0, len(s.data))
+	for k := range s.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	e := utils.NewEncoder(stateHashDomain).Int(len(keys))
+	for _, k := range keys {
+		e.String(k).Bytes(s.data[k])
+	}
+	return e.Sum()
+}
+
+// Get returns the value of a key.
+func (s *KVStore) Get(key string) ([]byte, bool) {
+	s.Lock()
+	defer s.Unlock()
+	v, ok := s.data[key]
+	return v, ok
+}
+
+// Result returns the result of a command if it was committed.
+func (s *KVStore) Result(id CommandID) (*Result, bool) {
+	s.Lock()
+	defer s.Unlock()
+	res, ok := s.results[id]
+	return res, ok
+}
+
+// Height returns the number of rounds that were applied.
+func (s *KVStore) Height() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.height
+}
+
+// committed returns a channel that is closed when the command is committed.
+func (s *KVStore) committed(id CommandID) <-chan struct{} {
+	s.Lock()
+	defer s.Unlock()
+	ch := make(chan struct{})
+	if _, ok := s.results[id]; ok {
+		close(ch)
+		return ch
+	}
+	s.waiting[id] = append(s.waiting[id], ch)
+	return ch
+}
+
+// Node is a replica of the key-value store running on top of an ABC instance.
+type Node struct {
+	abc   *abc.ABC
+	Store *KVStore
+}
+
+// NewNode sets up a replica on u. It must be called before u is run.
+func NewNode(u *abc.ABC) *Node {
+	store := NewKVStore()
+	u.SetApplication(store)
+	return &Node{
+		abc:   u,
+		Store: store,
+	}
+}
+
+// Submit adds an encoded command to the transaction buffer of the node.
+func (node *Node) Submit(tx []byte) {
+	node.abc.FillBuffer([][]byte{tx})
+}
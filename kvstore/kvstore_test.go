@@ -0,0 +1,228 @@
+package kvstore
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/niclabs/tcpaillier"
+	"github.com/niclabs/tcrsa"
+	aba "github.com/sochsenreither/tardigrade/binaryagreement"
+	abc "github.com/sochsenreither/tardigrade/tardigrade"
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+func TestCommand(t *testing.T) {
+	cmd := &Command{
+		ID:       CommandID{Client: 1, Seq: 300},
+		Op:       OpCompareAndSwap,
+		Key:      "foo",
+		Expected: []byte("bar"),
+		Value:    []byte("baz"),
+	}
+	tx, err := cmd.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeCommand(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != cmd.ID || got.Op != cmd.Op || got.Key != cmd.Key || !bytes.Equal(got.Expected, cmd.Expected) || !bytes.Equal(got.Value, cmd.Value) {
+		t.Errorf("Expected %+v, got %+v", cmd, got)
+	}
+
+	for _, tx := range [][]byte{nil, []byte("X"), tx[:len(tx)-1], append(tx, 0)} {
+		if _, err := DecodeCommand(tx); err == nil {
+			t.Errorf("Invalid command %x got decoded", tx)
+		}
+	}
+	large := &Command{Op: OpPut, Key: "foo", Value: make([]byte, MaxCommandSize)}
+	if _, err := large.Encode(); err == nil {
+		t.Errorf("Command exceeding the maximum size got encoded")
+	}
+}
+
+func TestKVStore(t *testing.T) {
+	encode := func(cmd *Command) []byte {
+		tx, err := cmd.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	cmds := []*Command{
+		{ID: CommandID{0, 0}, Op: OpPut, Key: "foo", Value: []byte("1")},
+		{ID: CommandID{0, 1}, Op: OpCompareAndSwap, Key: "foo", Expected: []byte("1"), Value: []byte("2")},
+		{ID: CommandID{0, 2}, Op: OpCompareAndSwap, Key: "foo", Expected: []byte("1"), Value: []byte("3")},
+		{ID: CommandID{0, 3}, Op: OpPut, Key: "bar", Value: []byte("1")},
+		{ID: CommandID{0, 4}, Op: OpDelete, Key: "bar"},
+	}
+	block := &utils.Block{}
+	for _, cmd := range cmds {
+		block.Txs = append(block.Txs, encode(cmd))
+	}
+	// Garbage and a command that gets committed twice
+	block.Txs = append(block.Txs, []byte("garbage"), encode(cmds[0]))
+
+	s := NewKVStore()
+	s.DeliverBlock(&abc.Commit{Round: 0, Block: block})
+	if v, _ := s.Get("foo"); string(v) != "2" {
+		t.Errorf("Expected value %q, got %q", "2", v)
+	}
+	if _, ok := s.Get("bar"); ok {
+		t.Errorf("Deleted key still exists")
+	}
+	for i, applied := range []bool{true, true, false, true, true} {
+		if res, ok := s.Result(cmds[i].ID); !ok || res.Applied != applied {
+			t.Errorf("Expected command %s to be applied: %t, got %v", cmds[i].ID, applied, res)
+		}
+	}
+	if s.Height() != 1 {
+		t.Errorf("Expected height %d, got %d", 1, s.Height())
+	}
+}
+
+func TestReplicatedKVStore(t *testing.T) {
+	n := 4
+	kappa := 2
+	maxRounds := 4
+	nodes, abcs := setupNodes(t, n, kappa)
+
+	// Every node needs enough transactions in its buffer to propose in every round
+	client := NewClient(1, nodes)
+	ids := make([]CommandID, 0)
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key%d", i%10)
+		var id CommandID
+		var err error
+		switch i % 5 {
+		case 3:
+			id, err = client.CompareAndSwap(key, []byte(fmt.Sprint(i-3)), []byte(fmt.Sprint(i)))
+		case 4:
+			id, err = client.Delete(key)
+		default:
+			id, err = client.Put(key, []byte(fmt.Sprint(i)))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	cfgs := make(map[int]*utils.RoundConfig)
+	for i := 0; i < maxRounds; i++ {
+		cfgs[i] = &utils.RoundConfig{
+			Ta:      0,
+			Ts:      0,
+			Crashed: map[int]bool{},
+		}
+	}
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		i := i
+		go func() {
+			defer wg.Done()
+			abcs[i].Run(maxRounds, cfgs, time.Now())
+		}()
+	}
+	wg.Wait()
+
+	// Wait until all nodes applied all rounds
+	deadline := time.Now().Add(5 * time.Second)
+	for _, node := range nodes {
+		for node.Store.Height() < maxRounds && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if node.Store.Height() != maxRounds {
+			t.Fatalf("Expected height %d, got %d", maxRounds, node.Store.Height())
+		}
+	}
+
+	committed := 0
+	for _, id := range ids {
+		res, ok := nodes[0].Store.Result(id)
+		if ok {
+			committed++
+			if _, err := client.Wait(id, time.Second); err != nil {
+				t.Errorf("Waiting for committed command failed: %s", err)
+			}
+		}
+		for i := 1; i < n; i++ {
+			other, otherOk := nodes[i].Store.Result(id)
+			if ok != otherOk || (ok && *res != *other) {
+				t.Errorf("Node %d has result %v for command %s, node 0 has %v", i, other, id, res)
+			}
+		}
+	}
+	if committed == 0 {
+		t.Errorf("No command got committed")
+	}
+	hash := nodes[0].Store.Commit()
+	for i := 1; i < n; i++ {
+		if nodes[i].Store.Commit() != hash {
+			t.Errorf("State of node %d differs from the state of node 0", i)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		v, ok := client.Get(key)
+		for j := 1; j < n; j++ {
+			other, otherOk := nodes[j].Store.Get(key)
+			if ok != otherOk || !bytes.Equal(v, other) {
+				t.Errorf("Node %d has value %q for %s, node 0 has %q", j, other, key, v)
+			}
+		}
+	}
+}
+
+// setupNodes creates n key-value store nodes that communicate over local channels.
+func setupNodes(t *testing.T, n, kappa int) ([]*Node, []*abc.ABC) {
+	committee := make(map[int]bool)
+	for i := 0; i < kappa; i++ {
+		committee[i] = true
+	}
+	keyShares, keyMeta, err := tcrsa.NewKey(512, uint16(n/2+1), uint16(n), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySharesC, keyMetaC, err := tcrsa.NewKey(512, uint16(kappa/2+1), uint16(kappa), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decShares, pk, err := tcpaillier.NewKey(512, 1, uint8(kappa), uint8(kappa/2+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	identities, err := utils.NewIdentities(n, 0, committee, keyShares, keyMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coin := aba.NewLocalCommonCoin(n, keyMeta, make(chan *utils.CoinRequest, 9999))
+	go coin.Run()
+	nodeChans := make(map[int]chan *utils.HandlerMessage)
+	for i := 0; i < n; i++ {
+		nodeChans[i] = make(chan *utils.HandlerMessage, 9999)
+	}
+	leaderFunc := func(r, n int) int {
+		return r % n
+	}
+
+	nodes := make([]*Node, n)
+	abcs := make([]*abc.ABC, n)
+	for i := 0; i < n; i++ {
+		handler := utils.NewLocalHandler(nodeChans, coin.RequestChan, i, n, kappa)
+		cfg := abc.NewABCConfig(n, i, 0, 0, kappa, 1, 10, 0, MaxCommandSize, committee, leaderFunc, handler.Funcs)
+		if committee[i] {
+			abcs[i] = abc.NewABC(cfg, abc.NewTcs(keyShares[i], keyMeta, keyMetaC, pk, identities[i], keySharesC[i], decShares[i]))
+		} else {
+			abcs[i] = abc.NewABC(cfg, abc.NewTcs(keyShares[i], keyMeta, keyMetaC, pk, identities[i], nil, nil))
+		}
+		nodes[i] = NewNode(abcs[i])
+	}
+	return nodes, abcs
+}
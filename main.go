@@ -22,8 +22,25 @@ import (
 
 func main() {
 	args := os.Args
+	if len(args) == 2 && args[1] == "bench" {
+		simulation.RunKeySizeBenchmark()
+		return
+	}
+	if len(args) == 2 && args[1] == "bench-proposal" {
+		simulation.RunProposalBenchmark()
+		return
+	}
+	if len(args) == 2 && args[1] == "bench-plaintext" {
+		simulation.RunEncryptionBenchmark()
+		return
+	}
 	if len(args) != 5 {
-		fmt.Printf("Arg 1: Start time at provided Second. Arg 2: Starting id. Arg 3: Ending id.\n")
+		fmt.Printf("Arg 1: Start time at provided Second. Arg 2: Starting id. Arg 3: Ending id. Arg 4: Delta.\n")
+		fmt.Printf("Or run \"bench\" to measure the round latency for different key sizes.\n")
+		fmt.Printf("Or run \"bench-proposal\" to measure the share of duplicate transactions for every proposal strategy.\n")
+		fmt.Printf("Or run \"bench-plaintext\" to compare the round latency with and without threshold encryption.\n")
+		fmt.Printf("Set TARDIGRADE_API_PORT to serve the client API of node i on localhost at that port plus i.\n")
+		fmt.Printf("Node key files are unlocked with the passphrase in TARDIGRADE_PASSPHRASE, read from the file descriptor in TARDIGRADE_PASSPHRASE_FD or entered at the prompt.\n")
 		os.Exit(1)
 	}
 	startTime, err := strconv.Atoi(args[1])
@@ -65,6 +82,12 @@ func main() {
 	gob.Register(&abc.PointerMessage{})
 	gob.Register(&abc.PreBlockMessage{})
 	gob.Register(&abc.PbDecryptionShareMessage{})
+	gob.Register(&abc.SyncRequest{})
+	gob.Register(&abc.SyncResponse{})
+	gob.Register(&abc.Checkpoint{})
+	gob.Register(&abc.TxAnnounce{})
+	gob.Register(&abc.TxRequest{})
+	gob.Register(&abc.TxResponse{})
 
 	// Delete old log
 	n := 4
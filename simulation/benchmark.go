@@ -0,0 +1,167 @@
+package simulation
+
+import (
+	"fmt"
+	"time"
+
+	abc "github.com/sochsenreither/tardigrade/tardigrade"
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+// Key configurations used by the key size benchmark
+var benchmarkKeyConfigs = []*KeyConfig{
+	{SigKeySize: 512, EncKeySize: 128, Hash: "SHA-256"},
+	{SigKeySize: 1024, EncKeySize: 256, Hash: "SHA-256"},
+	{SigKeySize: 1024, EncKeySize: 256, Hash: "SHA-512"},
+	{SigKeySize: 1024, EncKeySize: 512, Hash: "SHA-256"},
+	{SigKeySize: 2048, EncKeySize: 1024, Hash: "SHA-256"},
+}
+
+func RunKeySizeBenchmark() {
+	keySizeBenchmark(4, 0, 50, 2000, 2, 8, 5, benchmarkKeyConfigs)
+}
+
+func RunProposalBenchmark() {
+	proposalBenchmark(4, 0, 50, 1000, 2, 8, 5, benchmarkKeyConfigs[0])
+}
+
+func RunEncryptionBenchmark() {
+	encryptionBenchmark(4, 0, 50, 2000, 2, 8, 5, benchmarkKeyConfigs[2])
+}
+
+// keySizeBenchmark runs a local simulation for every key configuration and prints the average
+// runtime of a round. Keys are generated in memory and not written to file.
+func keySizeBenchmark(n, t, delta, lambda, kappa, txSize, rounds int, cfgs []*KeyConfig) {
+	fmt.Printf("Parameters: nodes: %d delta: %d lambda: %d kappa: %d txSize: %d rounds: %d\n", n, delta, lambda, kappa, txSize, rounds)
+	for _, cfg := range cfgs {
+		if err := cfg.Validate(); err != nil {
+			panic(err)
+		}
+		if err := cfg.ValidateTxSize(txSize); err != nil {
+			panic(err)
+		}
+
+		start := time.Now()
+		keys := generateKeys(n, kappa, cfg)
+		keyTime := time.Since(start)
+
+		abcs := newLocalABCs(n, t, delta, lambda, kappa, txSize, keys)
+		simCfg := utils.CrashCfg(n, t, rounds, false)
+		done := make(chan struct{}, n)
+		startTime := time.Now()
+		for i := 0; i < n; i++ {
+			abcs[i].FillBuffer(randomTransactions(n, txSize, 10*rounds))
+			go func(node *abc.ABC) {
+				node.Run(simCfg.Rounds, simCfg.RoundCfgs, startTime)
+				done <- struct{}{}
+			}(abcs[i])
+		}
+		for i := 0; i < n; i++ {
+			<-done
+		}
+
+		runtime := time.Duration(0)
+		finished := 0
+		for _, node := range abcs {
+			runtime += node.RuntimeTotal
+			finished += node.FinishedRounds
+		}
+		avg := time.Duration(0)
+		if finished > 0 {
+			avg = runtime / time.Duration(finished)
+		}
+		fmt.Printf("mode: %s rsa: %d paillier: %d hash: %s key setup: %s finished rounds: %d avg round latency: %s\n", abcs[0].Cfg.EncryptionMode(), cfg.SigKeySize, cfg.EncKeySize, cfg.Hash, keyTime, finished, avg)
+		printProposerStats(abcs[0])
+	}
+}
+
+// proposalBenchmark runs a local simulation for every proposal strategy and prints the share of
+// decided transactions that were dropped as duplicates. Every node gets the same transactions, like with
+// clients that submit their transactions to all nodes.
+func proposalBenchmark(n, t, delta, lambda, kappa, txSize, rounds int, keyCfg *KeyConfig) {
+	fmt.Printf("Parameters: nodes: %d delta: %d lambda: %d kappa: %d txSize: %d rounds: %d\n", n, delta, lambda, kappa, txSize, rounds)
+	keys := generateKeys(n, kappa, keyCfg)
+	for _, strategy := range []abc.ProposalStrategy{abc.ProposeRandom, abc.ProposeByHash} {
+		abcs := newLocalABCs(n, t, delta, lambda, kappa, txSize, keys)
+		simCfg := utils.CrashCfg(n, t, rounds, false)
+		txs := randomTransactions(n, txSize, 10*rounds)
+		done := make(chan struct{}, n)
+		startTime := time.Now()
+		for i := 0; i < n; i++ {
+			abcs[i].Cfg.SetProposalStrategy(strategy)
+			abcs[i].FillBuffer(txs)
+			go func(node *abc.ABC) {
+				node.Run(simCfg.Rounds, simCfg.RoundCfgs, startTime)
+				done <- struct{}{}
+			}(abcs[i])
+		}
+		for i := 0; i < n; i++ {
+			<-done
+		}
+
+		// Duplicates are dropped from the blocks when they are finalized
+		unique := 0
+		for _, block := range abcs[0].GetBlocks() {
+			unique += block.TxsCount
+		}
+		abcs[0].Lock()
+		total := unique + abcs[0].DupTxsInBlock + abcs[0].DupTxsInLedger
+		abcs[0].Unlock()
+		rate := 0.0
+		if total > 0 {
+			rate = float64(total-unique) / float64(total)
+		}
+		fmt.Printf("strategy: %s txs: %d unique txs: %d duplication rate: %.2f\n", strategy, total, unique, rate)
+		printProposerStats(abcs[0])
+	}
+}
+
+// encryptionBenchmark runs a local simulation with and without threshold encryption and prints the
+// average runtime of a round and the throughput for both modes.
+func encryptionBenchmark(n, t, delta, lambda, kappa, txSize, rounds int, keyCfg *KeyConfig) {
+	fmt.Printf("Parameters: nodes: %d delta: %d lambda: %d kappa: %d txSize: %d rounds: %d\n", n, delta, lambda, kappa, txSize, rounds)
+	keys := generateKeys(n, kappa, keyCfg)
+	for _, plaintext := range []bool{false, true} {
+		abcs := newLocalABCs(n, t, delta, lambda, kappa, txSize, keys)
+		simCfg := utils.CrashCfg(n, t, rounds, false)
+		done := make(chan struct{}, n)
+		startTime := time.Now()
+		for i := 0; i < n; i++ {
+			abcs[i].Cfg.SetPlaintextMode(plaintext)
+			abcs[i].FillBuffer(randomTransactions(n, txSize, 10*rounds))
+			go func(node *abc.ABC) {
+				node.Run(simCfg.Rounds, simCfg.RoundCfgs, startTime)
+				done <- struct{}{}
+			}(abcs[i])
+		}
+		for i := 0; i < n; i++ {
+			<-done
+		}
+		executionTime := time.Since(startTime)
+
+		runtime := time.Duration(0)
+		finished := 0
+		for _, node := range abcs {
+			runtime += node.RuntimeTotal
+			finished += node.FinishedRounds
+		}
+		avg := time.Duration(0)
+		if finished > 0 {
+			avg = runtime / time.Duration(finished)
+		}
+		txs := 0
+		for _, block := range abcs[0].GetBlocks() {
+			txs += block.TxsCount
+		}
+		fmt.Printf("mode: %s paillier: %d finished rounds: %d avg round latency: %s txs: %d txs per second: %.2f\n", abcs[0].Cfg.EncryptionMode(), keyCfg.EncKeySize, finished, avg, txs, float64(txs)/executionTime.Seconds())
+		printProposerStats(abcs[0])
+	}
+}
+
+// printProposerStats prints how many slots and transactions of every proposer were included in the
+// blocks of a node and flags proposers that were left out.
+func printProposerStats(node *abc.ABC) {
+	for i, st := range node.ProposerStats() {
+		fmt.Printf("  proposer: %d slots bla: %d slots acs: %d txs: %d avg wait: %s missed rounds: %d flagged: %t\n", i, st.SlotsBLA, st.SlotsACS, st.Txs, st.AvgWait, st.Missed, st.Flagged)
+	}
+}
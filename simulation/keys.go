@@ -0,0 +1,207 @@
+package simulation
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/niclabs/tcpaillier"
+	"github.com/niclabs/tcrsa"
+	abc "github.com/sochsenreither/tardigrade/tardigrade"
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+// Version of the key file format
+const keyFileVersion = 5
+
+// Key sizes below these values are only suitable for testing
+const (
+	minSecureSigKeySize = 2048
+	minSecureEncKeySize = 2048
+)
+
+type Keys struct {
+	KeyShares         tcrsa.KeyShareList
+	KeyMeta           *tcrsa.KeyMeta
+	KeySharesCommitte tcrsa.KeyShareList
+	KeyMetaCommittee  *tcrsa.KeyMeta
+	Pk                *tcpaillier.PubKey
+	DecryptionShares  []*tcpaillier.KeyShare
+	Identities        []*utils.Identity
+}
+
+// KeyConfig contains the security parameters used for generating keys.
+type KeyConfig struct {
+	SigKeySize int    // Bit size of the threshold RSA modulus
+	EncKeySize int    // Bit size of the threshold Paillier modulus
+	Hash       string // Hash function used for signing
+}
+
+// keyFileHeader is written in front of the keys and describes how they were generated.
+type keyFileHeader struct {
+	Version int
+	N       int
+	Kappa   int
+	Cfg     KeyConfig
+}
+
+// Hash functions that can be used for signing
+var supportedHashes = map[string]crypto.Hash{
+	"SHA-256": crypto.SHA256,
+	"SHA-512": crypto.SHA512,
+}
+
+// DefaultKeyConfig returns the key configuration used for demos.
+func DefaultKeyConfig() *KeyConfig {
+	return &KeyConfig{
+		SigKeySize: 512,
+		EncKeySize: 128,
+		Hash:       "SHA-256",
+	}
+}
+
+// Validate returns an error if the key configuration can't be used.
+func (cfg *KeyConfig) Validate() error {
+	if cfg.SigKeySize < 64 || cfg.SigKeySize%2 != 0 {
+		return fmt.Errorf("invalid signature key size %d", cfg.SigKeySize)
+	}
+	if cfg.EncKeySize < 64 || cfg.EncKeySize%2 != 0 {
+		return fmt.Errorf("invalid encryption key size %d", cfg.EncKeySize)
+	}
+	h, ok := supportedHashes[cfg.Hash]
+	if !ok {
+		return fmt.Errorf("unsupported hash function %q", cfg.Hash)
+	}
+	// The padded digest has to fit into the signature key
+	if _, err := tcrsa.PrepareDocumentHash(cfg.SigKeySize/8, h, make([]byte, h.Size())); err != nil {
+		return fmt.Errorf("signature key size %d is too small for %s", cfg.SigKeySize, cfg.Hash)
+	}
+	return nil
+}
+
+// SigHash returns the hash function used for signing. The configuration has to be valid.
+func (cfg *KeyConfig) SigHash() crypto.Hash {
+	return supportedHashes[cfg.Hash]
+}
+
+// ValidateTxSize returns an error if transactions of up to txSize bytes can't be encrypted with the
+// configured encryption key.
+func (cfg *KeyConfig) ValidateTxSize(txSize int) error {
+	if abc.FrameSize(txSize)*8 >= cfg.EncKeySize {
+		return fmt.Errorf("transactions of %dB don't fit into the %d bit encryption key", txSize, cfg.EncKeySize)
+	}
+	return nil
+}
+
+// GetKeyConfig reads the key configuration from file. If the file doesn't exist it is created
+// with the default configuration.
+func GetKeyConfig() *KeyConfig {
+	filename := "simulation/keys/config.json"
+	if fileExists(filename) {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			panic(err)
+		}
+		cfg := new(KeyConfig)
+		err = json.Unmarshal(content, cfg)
+		if err != nil {
+			panic(err)
+		}
+		if err = cfg.Validate(); err != nil {
+			panic(fmt.Errorf("invalid key configuration in %s: %s", filename, err))
+		}
+		return cfg
+	}
+	cfg := DefaultKeyConfig()
+	content, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	err = ioutil.WriteFile(filename, content, 0644)
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// KeySetup deals the keys for n nodes and a committee of size kappa, unless they were already
+// dealt. Every node gets its own key file that is encrypted with the passphrase.
+func KeySetup(n, kappa int) {
+	if err := ensureNodeKeys(n, kappa, GetKeyConfig()); err != nil {
+		panic(err)
+	}
+}
+
+// setupKeys generates the keys for n nodes and a committee of size kappa in memory. It is used by
+// simulations that run all nodes in one process, the keys are never written to file.
+func setupKeys(n, kappa int, cfg *KeyConfig) *Keys {
+	if err := cfg.Validate(); err != nil {
+		panic(err)
+	}
+	if cfg.SigKeySize < minSecureSigKeySize || cfg.EncKeySize < minSecureEncKeySize {
+		log.Printf("Warning: key sizes %d/%d are only suitable for testing", cfg.SigKeySize, cfg.EncKeySize)
+	}
+	return generateKeys(n, kappa, cfg)
+}
+
+// check returns an error if the header doesn't match the expected parameters.
+func (h *keyFileHeader) check(n, kappa int, cfg *KeyConfig) error {
+	if h.Version != keyFileVersion {
+		return fmt.Errorf("unsupported key file version %d", h.Version)
+	}
+	if h.N != n || h.Kappa != kappa {
+		return fmt.Errorf("keys are for %d nodes and a committee of %d, expected %d and %d", h.N, h.Kappa, n, kappa)
+	}
+	if h.Cfg != *cfg {
+		return fmt.Errorf("keys were generated with %+v, expected %+v", h.Cfg, *cfg)
+	}
+	return nil
+}
+
+// matchesKeySize returns true if a modulus of bitLen bits was generated with the given key size.
+// Generated moduli can be a few bits shorter than the key size, so only the size in bytes is compared.
+func matchesKeySize(bitLen, keySize int) bool {
+	return (bitLen+7)/8 == (keySize+7)/8
+}
+
+// generateKeys generates new keys for n nodes and a committee of size kappa.
+func generateKeys(n, kappa int, cfg *KeyConfig) *Keys {
+	// Setup signature scheme
+	keyShares, keyMeta, err := tcrsa.NewKey(cfg.SigKeySize, uint16(n/2+1), uint16(n), nil)
+	if err != nil {
+		panic(err)
+	}
+
+	keySharesCommittee, keyMetaCommittee, err := tcrsa.NewKey(cfg.SigKeySize, uint16(kappa/2+1), uint16(kappa), nil)
+	if err != nil {
+		panic(err)
+	}
+
+	// Setup encryption scheme
+	decryptionShares, pk, err := tcpaillier.NewKey(cfg.EncKeySize, 1, uint8(kappa), uint8(kappa/2+1))
+	if err != nil {
+		panic(err)
+	}
+
+	// Setup identity keys and the membership certificate. The first kappa nodes form the committee.
+	committee := make(map[int]bool)
+	for i := 0; i < kappa; i++ {
+		committee[i] = true
+	}
+	identities, err := utils.NewIdentitiesWithHash(n, 0, committee, cfg.SigHash(), keyShares, keyMeta)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Keys{
+		KeyShares:         keyShares,
+		KeyMeta:           keyMeta,
+		KeySharesCommitte: keySharesCommittee,
+		KeyMetaCommittee:  keyMetaCommittee,
+		Pk:                pk,
+		DecryptionShares:  decryptionShares,
+		Identities:        identities,
+	}
+}
@@ -0,0 +1,68 @@
+package simulation
+
+import (
+	"crypto"
+	"sync"
+	"testing"
+	"time"
+
+	abc "github.com/sochsenreither/tardigrade/tardigrade"
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+func TestKeyConfigValidate(t *testing.T) {
+	if err := DefaultKeyConfig().Validate(); err != nil {
+		t.Errorf("Expected default configuration to be valid, got: %s", err)
+	}
+	if err := (&KeyConfig{SigKeySize: 1024, EncKeySize: 128, Hash: "SHA-512"}).Validate(); err != nil {
+		t.Errorf("Expected SHA-512 configuration to be valid, got: %s", err)
+	}
+	invalid := []*KeyConfig{
+		{SigKeySize: 0, EncKeySize: 128, Hash: "SHA-256"},
+		{SigKeySize: 512, EncKeySize: 127, Hash: "SHA-256"},
+		{SigKeySize: 512, EncKeySize: 128, Hash: "MD5"},
+		{SigKeySize: 512, EncKeySize: 128},
+		// The padded SHA-512 digest doesn't fit into a 512 bit key
+		{SigKeySize: 512, EncKeySize: 128, Hash: "SHA-512"},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", *cfg)
+		}
+	}
+}
+
+func TestSigHash(t *testing.T) {
+	n, kappa, txSize, rounds := 4, 2, 8, 2
+	cfg := &KeyConfig{SigKeySize: 1024, EncKeySize: 256, Hash: "SHA-512"}
+	keys := generateKeys(n, kappa, cfg)
+	if h := keys.Identities[0].Cert.SignatureHash(); h != crypto.SHA512 {
+		t.Fatalf("Expected keys to sign with SHA-512, got %s", h)
+	}
+
+	abcs := newLocalABCs(n, 0, 1, 10, kappa, txSize, keys)
+	simCfg := utils.CrashCfg(n, 0, rounds, false)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		abcs[i].FillBuffer(randomTransactions(n, txSize, 10*rounds))
+		go func(node *abc.ABC) {
+			defer wg.Done()
+			node.Run(simCfg.Rounds, simCfg.RoundCfgs, start)
+		}(abcs[i])
+	}
+	wg.Wait()
+
+	for r := 0; r < rounds; r++ {
+		block := abcs[0].GetBlocks()[r]
+		if block == nil || block.TxsCount == 0 {
+			t.Fatalf("Expected transactions in round %d", r)
+		}
+		for i := 1; i < n; i++ {
+			if b := abcs[i].GetBlocks()[r]; b == nil || b.Hash() != block.Hash() {
+				t.Errorf("Block of node %d in round %d differs from the block of node 0", i, r)
+			}
+		}
+	}
+}
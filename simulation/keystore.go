@@ -0,0 +1,419 @@
+package simulation
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/niclabs/tcpaillier"
+	"github.com/niclabs/tcrsa"
+	"github.com/sochsenreither/tardigrade/utils"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// Environment variables that can be used to unlock node key files
+const (
+	passphraseEnv   = "TARDIGRADE_PASSPHRASE"    // Passphrase
+	passphraseFdEnv = "TARDIGRADE_PASSPHRASE_FD" // File descriptor from which the passphrase is read
+)
+
+// Parameters for deriving the encryption key from a passphrase
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltSize     = 16
+)
+
+// ErrWrongPassphrase is returned if a node key file can't be decrypted with the given passphrase.
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted key file")
+
+// NodeKeys contains the keys of a single node.
+type NodeKeys struct {
+	NodeId            int
+	KeyShare          *tcrsa.KeyShare      // Signature key share
+	KeyMeta           *tcrsa.KeyMeta       // Key meta for signatures of all nodes
+	KeyShareCommittee *tcrsa.KeyShare      // Signature key share for the committee, nil if not in the committee
+	KeyMetaCommittee  *tcrsa.KeyMeta       // Key meta for signatures of the committee
+	Pk                *tcpaillier.PubKey   // Public encryption key
+	DecryptionShare   *tcpaillier.KeyShare // Decryption key share, nil if not in the committee
+	Identity          *utils.Identity      // Identity key and membership certificate
+}
+
+// encryptedKeyFile is the on-disk format of a node key file. Only the header is stored in plain.
+type encryptedKeyFile struct {
+	Header     keyFileHeader
+	NodeId     int
+	Salt       []byte // Salt for scrypt
+	N, R, P    int    // Parameters for scrypt
+	Nonce      []byte // Nonce for AES-GCM
+	Ciphertext []byte // Encrypted NodeKeys
+}
+
+// PublicKeys contains the public keys of all nodes. They are stored in plain next to the node key
+// files, so that they can be read without a passphrase.
+type PublicKeys struct {
+	Header           keyFileHeader
+	KeyMeta          *tcrsa.KeyMeta     // Key meta for signatures of all nodes
+	KeyMetaCommittee *tcrsa.KeyMeta     // Key meta for signatures of the committee
+	Pk               *tcpaillier.PubKey // Public encryption key
+}
+
+// nodeKeys returns the keys of node id. Committee keys are only included if the membership
+// certificate lists the node as committee member. They are handed out in the order of the
+// committee members, see utils.CommitteeIndex.
+func (keys *Keys) nodeKeys(id int) *NodeKeys {
+	nk := &NodeKeys{
+		NodeId:           id,
+		KeyShare:         keys.KeyShares[id],
+		KeyMeta:          keys.KeyMeta,
+		KeyMetaCommittee: keys.KeyMetaCommittee,
+		Pk:               keys.Pk,
+		Identity:         keys.Identities[id],
+	}
+	if index, ok := utils.CommitteeIndex(keys.Identities[id].Cert.Committee(), id); ok {
+		nk.KeyShareCommittee = keys.KeySharesCommitte[index]
+		nk.DecryptionShare = keys.DecryptionShares[index]
+	}
+	return nk
+}
+
+// keyDir returns the directory that contains the key files for n nodes and a committee of size
+// kappa.
+func keyDir(n, kappa int) string {
+	return fmt.Sprintf("simulation/keys/node-%d-%d", n, kappa)
+}
+
+// nodeKeyFilename returns the name of the key file of node id.
+func nodeKeyFilename(dir string, id int) string {
+	return filepath.Join(dir, strconv.Itoa(id))
+}
+
+// publicKeyFilename returns the name of the file containing the public keys.
+func publicKeyFilename(dir string) string {
+	return filepath.Join(dir, "public")
+}
+
+// ensureNodeKeys deals the keys for n nodes and a committee of size kappa if they weren't dealt
+// yet.
+func ensureNodeKeys(n, kappa int, cfg *KeyConfig) error {
+	dir := keyDir(n, kappa)
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	passphrase, err := getPassphrase(true)
+	if err != nil {
+		return err
+	}
+	return dealNodeKeys(dir, n, kappa, cfg, passphrase)
+}
+
+// dealNodeKeys generates keys for n nodes and a committee of size kappa and writes an encrypted key
+// file for every node and a file with the public keys to dir. The files are written to a temporary
+// directory that is renamed to dir at the end, so nodes never see a partially written set of keys.
+// If another dealer created dir first, its keys are kept. The keys of all nodes are never written
+// to file in plain.
+func dealNodeKeys(dir string, n, kappa int, cfg *KeyConfig, passphrase []byte) error {
+	keys := setupKeys(n, kappa, cfg)
+	header := keyFileHeader{
+		Version: keyFileVersion,
+		N:       n,
+		Kappa:   kappa,
+		Cfg:     *cfg,
+	}
+
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), ".deal-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	for id := 0; id < n; id++ {
+		if err = writeNodeKeys(nodeKeyFilename(tmp, id), header, keys.nodeKeys(id), passphrase); err != nil {
+			return err
+		}
+	}
+	pub := &PublicKeys{
+		Header:           header,
+		KeyMeta:          keys.KeyMeta,
+		KeyMetaCommittee: keys.KeyMetaCommittee,
+		Pk:               keys.Pk,
+	}
+	if err = writePublicKeys(publicKeyFilename(tmp), pub); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, dir); err != nil {
+		if _, statErr := os.Stat(dir); statErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// unlockNodeKeys reads and decrypts the key file of node id. If the keys weren't dealt yet, the
+// key files of all nodes are created first.
+func unlockNodeKeys(id, n, kappa int, cfg *KeyConfig) (*NodeKeys, error) {
+	if err := ensureNodeKeys(n, kappa, cfg); err != nil {
+		return nil, err
+	}
+	passphrase, err := getPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	filename := nodeKeyFilename(keyDir(n, kappa), id)
+	keys, err := readNodeKeys(filename, id, n, kappa, cfg, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unlock %s: %w", filename, err)
+	}
+	return keys, nil
+}
+
+// loadPublicKeys reads the public keys for n nodes and a committee of size kappa. If the keys
+// weren't dealt yet, the key files of all nodes are created first.
+func loadPublicKeys(n, kappa int, cfg *KeyConfig) (*PublicKeys, error) {
+	if err := ensureNodeKeys(n, kappa, cfg); err != nil {
+		return nil, err
+	}
+	return readPublicKeys(publicKeyFilename(keyDir(n, kappa)), n, kappa, cfg)
+}
+
+// writePublicKeys writes the public keys to file.
+func writePublicKeys(filename string, pub *PublicKeys) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gob.NewEncoder(f).Encode(pub)
+}
+
+// readPublicKeys reads the public keys from file and returns an error if they don't match the
+// expected parameters.
+func readPublicKeys(filename string, n, kappa int, cfg *KeyConfig) (*PublicKeys, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pub := new(PublicKeys)
+	if err = gob.NewDecoder(f).Decode(pub); err != nil {
+		return nil, fmt.Errorf("malformed public key file: %w", err)
+	}
+	if err = pub.Header.check(n, kappa, cfg); err != nil {
+		return nil, err
+	}
+	if pub.KeyMeta == nil || pub.KeyMetaCommittee == nil || pub.Pk == nil {
+		return nil, fmt.Errorf("incomplete keys")
+	}
+	if err = validateKeySizes(pub.KeyMeta, pub.KeyMetaCommittee, pub.Pk, cfg); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+// validateKeySizes returns an error if the public keys weren't generated with the key sizes of cfg.
+func validateKeySizes(keyMeta, keyMetaCommittee *tcrsa.KeyMeta, pk *tcpaillier.PubKey, cfg *KeyConfig) error {
+	if l := keyMeta.PublicKey.N.BitLen(); !matchesKeySize(l, cfg.SigKeySize) {
+		return fmt.Errorf("signature key has %d bits, expected %d", l, cfg.SigKeySize)
+	}
+	if l := keyMetaCommittee.PublicKey.N.BitLen(); !matchesKeySize(l, cfg.SigKeySize) {
+		return fmt.Errorf("committee signature key has %d bits, expected %d", l, cfg.SigKeySize)
+	}
+	if l := pk.N.BitLen(); !matchesKeySize(l, cfg.EncKeySize) {
+		return fmt.Errorf("encryption key has %d bits, expected %d", l, cfg.EncKeySize)
+	}
+	return nil
+}
+
+// writeNodeKeys encrypts the keys with a key derived from passphrase and writes them to file.
+func writeNodeKeys(filename string, header keyFileHeader, keys *NodeKeys, passphrase []byte) error {
+	var plain bytes.Buffer
+	if err := gob.NewEncoder(&plain).Encode(keys); err != nil {
+		return err
+	}
+
+	ekf := &encryptedKeyFile{
+		Header: header,
+		NodeId: keys.NodeId,
+		Salt:   make([]byte, saltSize),
+		N:      scryptN,
+		R:      scryptR,
+		P:      scryptP,
+	}
+	if _, err := rand.Read(ekf.Salt); err != nil {
+		return err
+	}
+	aead, err := newKeyFileCipher(passphrase, ekf)
+	if err != nil {
+		return err
+	}
+	ekf.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(ekf.Nonce); err != nil {
+		return err
+	}
+	ekf.Ciphertext = aead.Seal(nil, ekf.Nonce, plain.Bytes(), ekf.additionalData())
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gob.NewEncoder(f).Encode(ekf)
+}
+
+// readNodeKeys reads the key file of node id and decrypts it with a key derived from passphrase.
+func readNodeKeys(filename string, id, n, kappa int, cfg *KeyConfig, passphrase []byte) (*NodeKeys, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ekf := new(encryptedKeyFile)
+	if err = gob.NewDecoder(f).Decode(ekf); err != nil {
+		return nil, fmt.Errorf("malformed key file: %w", err)
+	}
+	if err = ekf.Header.check(n, kappa, cfg); err != nil {
+		return nil, err
+	}
+	if ekf.NodeId != id {
+		return nil, fmt.Errorf("keys are for node %d, expected node %d", ekf.NodeId, id)
+	}
+
+	aead, err := newKeyFileCipher(passphrase, ekf)
+	if err != nil {
+		return nil, err
+	}
+	if len(ekf.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("malformed key file: invalid nonce")
+	}
+	plain, err := aead.Open(nil, ekf.Nonce, ekf.Ciphertext, ekf.additionalData())
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	keys := new(NodeKeys)
+	if err = gob.NewDecoder(bytes.NewReader(plain)).Decode(keys); err != nil {
+		return nil, fmt.Errorf("malformed key file: %w", err)
+	}
+	if keys.KeyShare == nil || keys.KeyMeta == nil || keys.KeyMetaCommittee == nil || keys.Pk == nil || keys.Identity == nil || keys.Identity.Cert == nil {
+		return nil, fmt.Errorf("incomplete keys")
+	}
+	if keys.Identity.NodeId != keys.NodeId {
+		return nil, fmt.Errorf("identity of node %d in key file of node %d", keys.Identity.NodeId, keys.NodeId)
+	}
+	if err = keys.Identity.Cert.Verify(keys.KeyMeta); err != nil {
+		return nil, err
+	}
+	if h := keys.Identity.Cert.SignatureHash(); h != cfg.SigHash() {
+		return nil, fmt.Errorf("keys sign with %s, expected %s", h, cfg.Hash)
+	}
+	if err = validateKeySizes(keys.KeyMeta, keys.KeyMetaCommittee, keys.Pk, cfg); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// newKeyFileCipher derives a key from the passphrase and returns an AES-GCM cipher using that key.
+func newKeyFileCipher(passphrase []byte, ekf *encryptedKeyFile) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, ekf.Salt, ekf.N, ekf.R, ekf.P, scryptKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key derivation parameters: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData binds the plain parts of the key file to the ciphertext.
+func (ekf *encryptedKeyFile) additionalData() []byte {
+	return []byte(fmt.Sprintf("tardigrade-key-file:%d:%d:%d:%d:%+v", ekf.Header.Version, ekf.Header.N, ekf.Header.Kappa, ekf.NodeId, ekf.Header.Cfg))
+}
+
+var (
+	passphraseOnce   sync.Once
+	cachedPassphrase []byte
+	passphraseErr    error
+)
+
+// getPassphrase returns the passphrase for the node key files. It is read once from the
+// environment, a file descriptor or an interactive prompt. If confirm is set the prompt asks
+// twice.
+func getPassphrase(confirm bool) ([]byte, error) {
+	passphraseOnce.Do(func() {
+		cachedPassphrase, passphraseErr = readPassphrase(confirm)
+	})
+	return cachedPassphrase, passphraseErr
+}
+
+func readPassphrase(confirm bool) ([]byte, error) {
+	if p, ok := os.LookupEnv(passphraseEnv); ok {
+		if p == "" {
+			return nil, fmt.Errorf("%s is empty", passphraseEnv)
+		}
+		return []byte(p), nil
+	}
+
+	if fdStr, ok := os.LookupEnv(passphraseFdEnv); ok {
+		fd, err := strconv.Atoi(fdStr)
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("%s is not a valid file descriptor: %q", passphraseFdEnv, fdStr)
+		}
+		f := os.NewFile(uintptr(fd), "passphrase")
+		if f == nil {
+			return nil, fmt.Errorf("invalid file descriptor %d", fd)
+		}
+		defer f.Close()
+		content, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read passphrase from file descriptor %d: %w", fd, err)
+		}
+		p := strings.TrimRight(string(content), "\r\n")
+		if p == "" {
+			return nil, fmt.Errorf("passphrase read from file descriptor %d is empty", fd)
+		}
+		return []byte(p), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("no passphrase provided. Set %s or %s, or run interactively", passphraseEnv, passphraseFdEnv)
+	}
+	fmt.Fprint(os.Stderr, "Key file passphrase: ")
+	p, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat passphrase: ")
+		p2, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(p, p2) {
+			return nil, fmt.Errorf("passphrases don't match")
+		}
+	}
+	return p, nil
+}
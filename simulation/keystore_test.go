@@ -0,0 +1,210 @@
+package simulation
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func newTestHeader(n, kappa int, cfg *KeyConfig) keyFileHeader {
+	return keyFileHeader{
+		Version: keyFileVersion,
+		N:       n,
+		Kappa:   kappa,
+		Cfg:     *cfg,
+	}
+}
+
+func TestNodeKeysRoundTrip(t *testing.T) {
+	n, kappa := 4, 2
+	cfg := DefaultKeyConfig()
+	keys := setupKeys(n, kappa, cfg)
+	passphrase := []byte("correct horse battery staple")
+	filename := filepath.Join(t.TempDir(), "0")
+
+	if err := writeNodeKeys(filename, newTestHeader(n, kappa, cfg), keys.nodeKeys(0), passphrase); err != nil {
+		t.Fatal(err)
+	}
+	nk, err := readNodeKeys(filename, 0, n, kappa, cfg, passphrase)
+	if err != nil {
+		t.Fatalf("Expected keys to be unlocked, got: %s", err)
+	}
+	if nk.NodeId != 0 || nk.KeyShare.Id != keys.KeyShares[0].Id || !bytes.Equal(nk.KeyShare.Si, keys.KeyShares[0].Si) {
+		t.Errorf("Unlocked signature key share doesn't match the written one")
+	}
+	if nk.KeyShareCommittee == nil || nk.DecryptionShare == nil {
+		t.Errorf("Expected committee keys for committee member 0")
+	}
+	if nk.Pk.N.Cmp(keys.Pk.N) != 0 || nk.KeyMeta.PublicKey.N.Cmp(keys.KeyMeta.PublicKey.N) != 0 {
+		t.Errorf("Unlocked public keys don't match the written ones")
+	}
+
+	// The key share must not be stored in plain
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(content, keys.KeyShares[0].Si) {
+		t.Errorf("Key file contains the key share in plain")
+	}
+
+	// Nodes outside of the committee don't get committee keys
+	filename = filepath.Join(t.TempDir(), "3")
+	if err := writeNodeKeys(filename, newTestHeader(n, kappa, cfg), keys.nodeKeys(3), passphrase); err != nil {
+		t.Fatal(err)
+	}
+	nk, err = readNodeKeys(filename, 3, n, kappa, cfg, passphrase)
+	if err != nil {
+		t.Fatalf("Expected keys to be unlocked, got: %s", err)
+	}
+	if nk.KeyShareCommittee != nil || nk.DecryptionShare != nil {
+		t.Errorf("Expected no committee keys for node 3")
+	}
+}
+
+func TestNodeKeysWrongPassphrase(t *testing.T) {
+	n, kappa := 4, 2
+	cfg := DefaultKeyConfig()
+	keys := setupKeys(n, kappa, cfg)
+	filename := filepath.Join(t.TempDir(), "0")
+
+	if err := writeNodeKeys(filename, newTestHeader(n, kappa, cfg), keys.nodeKeys(0), []byte("right")); err != nil {
+		t.Fatal(err)
+	}
+	_, err := readNodeKeys(filename, 0, n, kappa, cfg, []byte("wrong"))
+	if !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected %q, got: %v", ErrWrongPassphrase, err)
+	}
+}
+
+func TestNodeKeysRefuseMismatch(t *testing.T) {
+	n, kappa := 4, 2
+	cfg := DefaultKeyConfig()
+	otherCfg := &KeyConfig{SigKeySize: 1024, EncKeySize: 128, Hash: "SHA-256"}
+	otherHash := &KeyConfig{SigKeySize: 512, EncKeySize: 128, Hash: "SHA-512"}
+	keys := setupKeys(n, kappa, cfg)
+	passphrase := []byte("passphrase")
+	dir := t.TempDir()
+
+	filename := filepath.Join(dir, "0")
+	if err := writeNodeKeys(filename, newTestHeader(n, kappa, cfg), keys.nodeKeys(0), passphrase); err != nil {
+		t.Fatal(err)
+	}
+	mismatches := map[string]func() error{
+		"nodes": func() error {
+			_, err := readNodeKeys(filename, 0, n+1, kappa, cfg, passphrase)
+			return err
+		},
+		"committee": func() error {
+			_, err := readNodeKeys(filename, 0, n, kappa+1, cfg, passphrase)
+			return err
+		},
+		"key config": func() error {
+			_, err := readNodeKeys(filename, 0, n, kappa, otherCfg, passphrase)
+			return err
+		},
+		"hash": func() error {
+			_, err := readNodeKeys(filename, 0, n, kappa, otherHash, passphrase)
+			return err
+		},
+		"node id": func() error {
+			_, err := readNodeKeys(filename, 1, n, kappa, cfg, passphrase)
+			return err
+		},
+	}
+	for name, read := range mismatches {
+		if err := read(); err == nil {
+			t.Errorf("Expected keys with mismatched %s to be refused", name)
+		}
+	}
+
+	// Header of another version
+	header := newTestHeader(n, kappa, cfg)
+	header.Version = keyFileVersion - 1
+	filename = filepath.Join(dir, "version")
+	if err := writeNodeKeys(filename, header, keys.nodeKeys(0), passphrase); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readNodeKeys(filename, 0, n, kappa, cfg, passphrase); err == nil {
+		t.Errorf("Expected keys with version %d to be refused", header.Version)
+	}
+
+	// Header that doesn't match the keys
+	filename = filepath.Join(dir, "sizes")
+	if err := writeNodeKeys(filename, newTestHeader(n, kappa, otherCfg), keys.nodeKeys(0), passphrase); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readNodeKeys(filename, 0, n, kappa, otherCfg, passphrase); err == nil {
+		t.Errorf("Expected keys that don't match the header to be refused")
+	}
+
+	// Header with the hash of the configuration, but keys signing with another hash
+	filename = filepath.Join(dir, "hash")
+	if err := writeNodeKeys(filename, newTestHeader(n, kappa, otherHash), keys.nodeKeys(0), passphrase); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readNodeKeys(filename, 0, n, kappa, otherHash, passphrase); err == nil {
+		t.Errorf("Expected keys signing with another hash to be refused")
+	}
+
+	// File without header
+	filename = filepath.Join(dir, "garbage")
+	if err := ioutil.WriteFile(filename, []byte("no header"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readNodeKeys(filename, 0, n, kappa, cfg, passphrase); err == nil {
+		t.Errorf("Expected a file without header to be refused")
+	}
+}
+
+func TestDealNodeKeys(t *testing.T) {
+	n, kappa := 4, 2
+	cfg := DefaultKeyConfig()
+	passphrase := []byte("passphrase")
+	dir := filepath.Join(t.TempDir(), "node-4-2")
+
+	if err := dealNodeKeys(dir, n, kappa, cfg, passphrase); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != n+1 {
+		t.Errorf("Expected %d node key files and a public key file, got %d files", n, len(files))
+	}
+
+	pub, err := readPublicKeys(publicKeyFilename(dir), n, kappa, cfg)
+	if err != nil {
+		t.Fatalf("Expected public keys to be read, got: %s", err)
+	}
+	for id := 0; id < n; id++ {
+		nk, err := readNodeKeys(nodeKeyFilename(dir, id), id, n, kappa, cfg, passphrase)
+		if err != nil {
+			t.Fatalf("Expected keys of node %d to be unlocked, got: %s", id, err)
+		}
+		if nk.KeyMeta.PublicKey.N.Cmp(pub.KeyMeta.PublicKey.N) != 0 {
+			t.Errorf("Keys of node %d don't match the public keys", id)
+		}
+		if (nk.DecryptionShare != nil) != (id < kappa) {
+			t.Errorf("Node %d got committee keys: %t", id, nk.DecryptionShare != nil)
+		}
+	}
+
+	// Keys that were already dealt are kept
+	if err := dealNodeKeys(dir, n, kappa, cfg, passphrase); err != nil {
+		t.Fatal(err)
+	}
+	pub2, err := readPublicKeys(publicKeyFilename(dir), n, kappa, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub2.KeyMeta.PublicKey.N.Cmp(pub.KeyMeta.PublicKey.N) != 0 {
+		t.Errorf("Dealing again replaced the existing keys")
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Dir(dir)); len(entries) != 1 {
+		t.Errorf("Expected temporary directories to be removed, got %d entries", len(entries))
+	}
+}
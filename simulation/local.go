@@ -52,7 +52,7 @@ func local(n, t, delta, lambda, kappa, txSize int) {
 			for _, block := range blocks {
 				totalTxs += block.TxsCount
 			}
-			uniqueTransactions(blocks, txs, txSize)
+			uniqueTransactions(blocks, txs)
 			fmt.Printf(" -------------------- %d seconds ---------------------\n", ticks*5)
 			fmt.Printf("| Total transactions: %d, txs/s: %d\n", totalTxs, totalTxs/(ticks*5))
 			fmt.Printf("| Unique transactions: %d, Unique txs/s: %d\n", len(txs), len(txs)/(ticks*5))
@@ -74,9 +74,14 @@ func local(n, t, delta, lambda, kappa, txSize int) {
 func setupLocalSimulation(n, t, delta, lambda, kappa, txSize int) []*abc.ABC {
 	// Setup keys
 	start := time.Now()
-	keys := setupKeys(n, kappa)
+	keys := setupKeys(n, kappa, GetKeyConfig())
 	fmt.Println("Key setup took", time.Since(start))
 
+	return newLocalABCs(n, t, delta, lambda, kappa, txSize, keys)
+}
+
+// newLocalABCs creates n nodes that communicate over local channels.
+func newLocalABCs(n, t, delta, lambda, kappa, txSize int, keys *Keys) []*abc.ABC {
 	// Setup committee
 	// TODO: random num of byzantine nodes. committee corruption?
 	committee := make(map[int]bool)
@@ -87,6 +92,7 @@ func setupLocalSimulation(n, t, delta, lambda, kappa, txSize int) []*abc.ABC {
 	// Create common coin
 	req := make(chan *utils.CoinRequest, 9999)
 	coin := aba.NewLocalCommonCoin(n, keys.KeyMeta, req)
+	coin.Hash = keys.Identities[0].Cert.SignatureHash()
 	go coin.Run()
 
 	// Setup message handler
@@ -107,9 +113,9 @@ func setupLocalSimulation(n, t, delta, lambda, kappa, txSize int) []*abc.ABC {
 	for i := 0; i < n; i++ {
 		cfg := abc.NewABCConfig(n, i, t, t, kappa, delta, lambda, 0, txSize, committee, leaderFunc, handlers[i].Funcs)
 		if committee[i] {
-			abcs[i] = abc.NewABC(cfg, abc.NewTcs(keys.KeyShares[i], keys.KeyMeta, keys.KeyMetaCommittee, keys.Pk, keys.Proofs[i], keys.KeySharesCommitte[i], keys.DecryptionShares[i]))
+			abcs[i] = abc.NewABC(cfg, abc.NewTcs(keys.KeyShares[i], keys.KeyMeta, keys.KeyMetaCommittee, keys.Pk, keys.Identities[i], keys.KeySharesCommitte[i], keys.DecryptionShares[i]))
 		} else {
-			abcs[i] = abc.NewABC(cfg, abc.NewTcs(keys.KeyShares[i], keys.KeyMeta, keys.KeyMetaCommittee, keys.Pk, keys.Proofs[i], nil, nil))
+			abcs[i] = abc.NewABC(cfg, abc.NewTcs(keys.KeyShares[i], keys.KeyMeta, keys.KeyMetaCommittee, keys.Pk, keys.Identities[i], nil, nil))
 		}
 	}
 	return abcs
@@ -3,14 +3,22 @@ package simulation
 import (
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"strconv"
 	"time"
 
+	"github.com/sochsenreither/tardigrade/api"
 	abc "github.com/sochsenreither/tardigrade/tardigrade"
 	"github.com/sochsenreither/tardigrade/utils"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 )
 
+// If this environment variable is set, node i serves the client API on localhost at the given port
+// plus i
+const apiPortEnv = "TARDIGRADE_API_PORT"
+
 func RunNodes(startId, endId, n, t, delta, lambda, kappa, txSize int, startTime time.Time, cfg *utils.SimulationConfig) {
 	if startId == endId && startId == -1 {
 		runCoin(n, kappa)
@@ -30,6 +38,23 @@ func RunNodes(startId, endId, n, t, delta, lambda, kappa, txSize int, startTime
 
 	runningNodes := len(nodes)
 
+	if port := os.Getenv(apiPortEnv); port != "" {
+		base, err := strconv.Atoi(port)
+		if err != nil {
+			panic(fmt.Errorf("invalid %s: %s", apiPortEnv, err))
+		}
+		for i, node := range nodes {
+			addr := fmt.Sprintf("127.0.0.1:%d", base+startId+i)
+			server := api.NewServer(node, api.DefaultConfig())
+			go func() {
+				log.Printf("Serving API on %s", addr)
+				if err := http.ListenAndServe(addr, server); err != nil {
+					log.Printf("API on %s stopped: %s", addr, err)
+				}
+			}()
+		}
+	}
+
 	for _, node := range nodes {
 		node.FillBuffer(randomTransactions(n, txSize, 5))
 	}
@@ -65,7 +90,7 @@ func RunNodes(startId, endId, n, t, delta, lambda, kappa, txSize int, startTime
 			for _, block := range blocks {
 				totalTxs += block.TxsCount
 			}
-			uniqueTransactions(blocks, txs, txSize)
+			uniqueTransactions(blocks, txs)
 			txps := float64(totalTxs) / float64(runtime.Seconds())
 			uTxps := float64(len(txs)) / float64(runtime.Seconds())
 			fmt.Printf("Simulation ran for %s\n", runtime)
@@ -91,7 +116,7 @@ func RunNodes(startId, endId, n, t, delta, lambda, kappa, txSize int, startTime
 			// for _, block := range blocks {
 			// 	totalTxs += block.TxsCount
 			// }
-			// uniqueTransactions(blocks, txs, txSize)
+			// uniqueTransactions(blocks, txs)
 			// fmt.Printf(" -------------------- %d seconds ---------------------\n", ticks*5)
 			// fmt.Printf("| Total transactions: %d, txs/s: %d\n", totalTxs, totalTxs/(ticks*5))
 			// fmt.Printf("| Unique transactions: %d, Unique txs/s: %d\n", len(txs), len(txs)/(ticks*5))
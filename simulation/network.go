@@ -56,7 +56,7 @@ func networkSimulation(n, delta, lambda, kappa, txSize int, cfg *utils.Simulatio
 			for _, block := range blocks {
 				totalTxs += block.TxsCount
 			}
-			uniqueTransactions(blocks, txs, txSize)
+			uniqueTransactions(blocks, txs)
 			txps := float64(totalTxs) / float64(runtime.Seconds())
 			uTxps := float64(len(txs)) / float64(runtime.Seconds())
 			fmt.Printf("Simulation ran for %s\n", runtime)
@@ -81,7 +81,7 @@ func networkSimulation(n, delta, lambda, kappa, txSize int, cfg *utils.Simulatio
 			// for _, block := range blocks {
 			// 	totalTxs += block.TxsCount
 			// }
-			// uniqueTransactions(blocks, txs, txSize)
+			// uniqueTransactions(blocks, txs)
 			// fmt.Printf(" -------------------- %d seconds ---------------------\n", ticks*5)
 			// fmt.Printf("| Total transactions: %d, txs/s: %d. Latency: %s\n", totalTxs, totalTxs/(ticks*3), abcs[0].LatencyTotal/time.Duration(abcs[0].FinishedRounds))
 			// fmt.Printf("| Unique transactions: %d, Unique txs/s: %d\n", len(txs), len(txs)/(ticks*3))
@@ -45,7 +45,7 @@ func RunNode(id, n, t, delta, lambda, kappa, txSize int, startTime time.Time, cf
 			for _, block := range blocks {
 				totalTxs += block.TxsCount
 			}
-			uniqueTransactions(blocks, txs, txSize)
+			uniqueTransactions(blocks, txs)
 			txps := float64(totalTxs) / float64(runtime.Seconds())
 			uTxps := float64(len(txs)) / float64(runtime.Seconds())
 			log.Printf("Simulation ran for %s\n", runtime)
@@ -60,7 +60,7 @@ func RunNode(id, n, t, delta, lambda, kappa, txSize int, startTime time.Time, cf
 			for _, block := range blocks {
 				totalTxs += block.TxsCount
 			}
-			uniqueTransactions(blocks, txs, txSize)
+			uniqueTransactions(blocks, txs)
 			fmt.Printf(" -------------------- %d seconds ---------------------\n", ticks*5)
 			fmt.Printf("| Total transactions: %d, txs/s: %d\n", totalTxs, totalTxs/(ticks*5))
 			fmt.Printf("| Unique transactions: %d, Unique txs/s: %d\n", len(txs), len(txs)/(ticks*5))
@@ -1,9 +1,7 @@
 package simulation
 
 import (
-	"crypto"
 	"crypto/sha256"
-	"encoding/gob"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -12,24 +10,11 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/niclabs/tcpaillier"
-	"github.com/niclabs/tcrsa"
 	aba "github.com/sochsenreither/tardigrade/binaryagreement"
 	abc "github.com/sochsenreither/tardigrade/tardigrade"
 	"github.com/sochsenreither/tardigrade/utils"
 )
 
-
-type Keys struct {
-	KeyShares         tcrsa.KeyShareList
-	KeyMeta           *tcrsa.KeyMeta
-	KeySharesCommitte tcrsa.KeyShareList
-	KeyMetaCommittee  *tcrsa.KeyMeta
-	Pk                *tcpaillier.PubKey
-	DecryptionShares  []*tcpaillier.KeyShare
-	Proofs            []*tcrsa.SigShare
-}
-
 func GetIPs(n int) map[int]string {
 	// Read from file. If file doesn't exists create a new one
 	filename := fmt.Sprintf("simulation/addresses/addresses-%d.json", n)
@@ -109,14 +94,27 @@ func GetCommittee(kappa int) map[int]bool {
 }
 
 func SetupNode(id, n, t, delta, lambda, kappa, txSize int, rcfgs utils.RoundConfigs) (*abc.ABC, *utils.NetworkHandler) {
-	// Read keys from file
-	keys := setupKeys(n, kappa)
+	// Unlock the key file of the node. Refuse to start if the keys don't match the configured
+	// parameters
+	keyCfg := GetKeyConfig()
+	if err := keyCfg.ValidateTxSize(txSize); err != nil {
+		panic(err)
+	}
+	keys, err := unlockNodeKeys(id, n, kappa, keyCfg)
+	if err != nil {
+		panic(err)
+	}
 
 	// Read ips from file
 	ips := GetIPs(n)
 
 	// Read committee members from file
 	committee := GetCommittee(kappa)
+	for i := 0; i < n; i++ {
+		if committee[i] != keys.Identity.Cert.IsCommittee(i) {
+			panic(fmt.Errorf("committee doesn't match the membership certificate for node %d", i))
+		}
+	}
 
 	// Create handler
 	handler := utils.NewNetworkHandler(ips, id, n, kappa, rcfgs)
@@ -128,26 +126,36 @@ func SetupNode(id, n, t, delta, lambda, kappa, txSize int, rcfgs utils.RoundConf
 
 	// Create abc
 	cfg := abc.NewABCConfig(n, id, t, t, kappa, delta, lambda, 0, txSize, committee, leaderFunc, handler.Funcs)
-	if committee[id] {
-		tcs := abc.NewTcs(keys.KeyShares[id], keys.KeyMeta, keys.KeyMetaCommittee, keys.Pk, keys.Proofs[id], keys.KeySharesCommitte[id], keys.DecryptionShares[id])
-		return abc.NewABC(cfg, tcs), handler
-	} else {
-		tcs := abc.NewTcs(keys.KeyShares[id], keys.KeyMeta, keys.KeyMetaCommittee, keys.Pk, keys.Proofs[id], nil, nil)
-		return abc.NewABC(cfg, tcs), handler
+	tcs := abc.NewTcs(keys.KeyShare, keys.KeyMeta, keys.KeyMetaCommittee, keys.Pk, keys.Identity, keys.KeyShareCommittee, keys.DecryptionShare)
+	node := abc.NewABC(cfg, tcs)
+
+	// Blocks of the node are kept on disk, so that they survive a restart
+	store, err := abc.NewFileStore(fmt.Sprintf("simulation/data/node-%d", id))
+	if err != nil {
+		panic(err)
 	}
+	if err = node.SetStore(store); err != nil {
+		panic(err)
+	}
+	return node, handler
 }
 
 func runCoin(n, kappa int) {
-	keys := setupKeys(n, kappa)
+	cfg := GetKeyConfig()
+	keys, err := loadPublicKeys(n, kappa, cfg)
+	if err != nil {
+		panic(err)
+	}
 	ips := GetIPs(n)
 	coin := aba.NewNetworkCommonCoin(n, keys.KeyMeta, ips)
+	coin.Hash = cfg.SigHash()
 	coin.Run()
 }
 
 func setupNetworkSimulation(n, delta, lambda, kappa, txSize int, rcfgs utils.RoundConfigs) ([]*abc.ABC, *Keys, map[int]string, *aba.CommonCoin, map[int]bool, []*utils.NetworkHandler) {
 	// Setup keys
 	start := time.Now()
-	keys := setupKeys(n, kappa)
+	keys := setupKeys(n, kappa, GetKeyConfig())
 	fmt.Println("Key setup took", time.Since(start))
 
 	// Setup committee
@@ -166,6 +174,7 @@ func setupNetworkSimulation(n, delta, lambda, kappa, txSize int, rcfgs utils.Rou
 	// Create common coin
 	ips[-1] = "127.0.0.1:4321"
 	coin := aba.NewNetworkCommonCoin(n, keys.KeyMeta, ips)
+	coin.Hash = keys.Identities[0].Cert.SignatureHash()
 
 	// Setup handlers
 	handlers := make([]*utils.NetworkHandler, n)
@@ -183,90 +192,20 @@ func setupNetworkSimulation(n, delta, lambda, kappa, txSize int, rcfgs utils.Rou
 	for i := 0; i < n; i++ {
 		cfg := abc.NewABCConfig(n, i, 0, 0, kappa, delta, lambda, 0, txSize, committee, leaderFunc, handlers[i].Funcs)
 		if committee[i] {
-			abcs[i] = abc.NewABC(cfg, abc.NewTcs(keys.KeyShares[i], keys.KeyMeta, keys.KeyMetaCommittee, keys.Pk, keys.Proofs[i], keys.KeySharesCommitte[i], keys.DecryptionShares[i]))
+			abcs[i] = abc.NewABC(cfg, abc.NewTcs(keys.KeyShares[i], keys.KeyMeta, keys.KeyMetaCommittee, keys.Pk, keys.Identities[i], keys.KeySharesCommitte[i], keys.DecryptionShares[i]))
 		} else {
-			abcs[i] = abc.NewABC(cfg, abc.NewTcs(keys.KeyShares[i], keys.KeyMeta, keys.KeyMetaCommittee, keys.Pk, keys.Proofs[i], nil, nil))
+			abcs[i] = abc.NewABC(cfg, abc.NewTcs(keys.KeyShares[i], keys.KeyMeta, keys.KeyMetaCommittee, keys.Pk, keys.Identities[i], nil, nil))
 		}
 	}
 	return abcs, keys, ips, coin, committee, handlers
 }
 
-func KeySetup(n, kappa int) {
-	setupKeys(n, kappa)
-}
-
-func setupKeys(n, kappa int) *Keys {
-	// If a file containing keys exists use that file
-	filename := fmt.Sprintf("simulation/keys/keys-%d-%d", n, kappa)
-	if fileExists(filename) {
-		f, err := os.Open(filename)
-		if err != nil {
-			panic(err)
-		}
-		keys := new(Keys)
-		dec := gob.NewDecoder(f)
-		dec.Decode(keys)
-		f.Close()
-		return keys
-	}
-	// Setup signature scheme
-	keyShares, keyMeta, err := tcrsa.NewKey(512, uint16(n/2+1), uint16(n), nil)
-	if err != nil {
-		panic(err)
-	}
-
-	keySharesCommittee, keyMetaCommittee, err := tcrsa.NewKey(512, uint16(kappa/2+1), uint16(kappa), nil)
-	if err != nil {
-		panic(err)
-	}
-
-	keySize := 128
-
-	// Setup encryption scheme
-	decryptionShares, pk, err := tcpaillier.NewKey(keySize, 1, uint8(kappa), uint8(kappa/2+1))
-	if err != nil {
-		panic(err)
-	}
-
-	// Setup proofs on nodeId (Dealer is node 0)
-	proofs := make([]*tcrsa.SigShare, n)
-	for i := 0; i < n; i++ {
-		hash := sha256.Sum256([]byte(strconv.Itoa(i)))
-		paddedHash, _ := tcrsa.PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, hash[:])
-		sig, err := keyShares[0].Sign(paddedHash, crypto.SHA256, keyMeta)
-		if err != nil {
-			panic(err)
-		}
-		proofs[i] = sig
-	}
-
-	keys := &Keys{
-		KeyShares:         keyShares,
-		KeyMeta:           keyMeta,
-		KeySharesCommitte: keySharesCommittee,
-		KeyMetaCommittee:  keyMetaCommittee,
-		Pk:                pk,
-		DecryptionShares:  decryptionShares,
-		Proofs:            proofs,
-	}
-
-	// Write keys to file
-	f, err := os.Create(filename)
-	if err != nil {
-		panic(err)
-	}
-	enc := gob.NewEncoder(f)
-	enc.Encode(keys)
-	f.Close()
-
-	return keys
-}
-
+// randomTransactions returns n*scale random transactions of 1 to txSize bytes.
 func randomTransactions(n, txSize, scale int) [][]byte {
 	bufsize := n * scale
 	buf := make([][]byte, bufsize)
 	for i := 0; i < bufsize; i++ {
-		token := make([]byte, txSize)
+		token := make([]byte, rand.Intn(txSize)+1)
 		rand.Read(token)
 		// fmt.Printf("Generated tx: %x\n", token)
 		buf[i] = token
@@ -282,26 +221,10 @@ func fileExists(filename string) bool {
 	return !info.IsDir()
 }
 
-func uniqueTransactions(blocks map[int]*utils.Block, txs map[[32]byte]int, txSize int) {
+func uniqueTransactions(blocks map[int]*utils.Block, txs map[[32]byte]int) {
 	for _, block := range blocks {
-		for _, transactions := range block.Txs {
-			//fmt.Printf("TX: %x\n", transactions)
-			var tx [][]byte
-			for i := 0; i < len(transactions); i += txSize {
-				end := i + txSize
-
-				if end > len(transactions) {
-					end = len(transactions)
-				}
-				tx = append(tx, transactions[i:end])
-			}
-			for _, t := range tx {
-				h := sha256.Sum256(t)
-				txs[h]++
-				if txs[h] > 1 {
-					//fmt.Printf("Multiple tx: %x - %d\n", t, txs[h])
-				}
-			}
+		for _, tx := range block.Txs {
+			txs[sha256.Sum256(tx)]++
 		}
 	}
 }
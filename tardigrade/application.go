@@ -0,0 +1,173 @@
+package tardigrade
+
+import (
+	"log"
+
+	utils "github.com/sochsenreither/tardigrade/utils"
+)
+
+// Application is a replicated state machine that processes the transactions ordered by ABC.
+// CheckTx can be called concurrently with DeliverBlock and Commit.
+type Application interface {
+	// CheckTx is called before a transaction is added to the buffer. Transactions encrypted by a
+	// client are checked after they were decrypted instead, so for these CheckTx must decide the
+	// same on every node. Transactions for which an error is returned are dropped.
+	CheckTx(tx []byte) error
+	// DeliverBlock is called for every finalized round in commit order.
+	DeliverBlock(c *Commit)
+	// Commit is called after every DeliverBlock and returns the hash of the application state.
+	Commit() [32]byte
+}
+
+// ExternalValidity decides if a decrypted transaction may be included in a block. It must be
+// deterministic and only depend on the transaction, since every node checks the transactions of a
+// block on its own. Transactions for which an error is returned are dropped.
+type ExternalValidity func(tx []byte) error
+
+// Number of rounds between two checkpoints of the application state
+const checkpointInterval = 10
+
+// Domains of the signatures on checkpoints and of their hashes
+const (
+	checkpointDomain     = "abc-checkpoint"
+	checkpointHashDomain = "tardigrade/abc-checkpoint"
+)
+
+// Checkpoint announces the hash of the application state of the sender after a round. Nodes
+// compare checkpoints to detect diverging application states.
+type Checkpoint struct {
+	Sender  int
+	Round   int
+	AppHash [32]byte
+	Sig     []byte // Signature of the sender on the round and the app hash
+}
+
+// SetApplication sets the application that processes the finalized blocks. It must be called
+// before Run. The application is replayed from the first round on, including blocks recovered from
+// the store.
+func (abc *ABC) SetApplication(app Application) {
+	abc.Lock()
+	defer abc.Unlock()
+	abc.app = app
+}
+
+// SetExternalValidity sets the validity check of transactions. It is applied when a transaction is
+// admitted to the mempool and again after it was decrypted. It must be called before Run.
+func (abc *ABC) SetExternalValidity(f ExternalValidity) {
+	abc.Lock()
+	defer abc.Unlock()
+	abc.validity = f
+}
+
+// AppHash returns the hash of the application state after round r, if the round was committed
+// and is a checkpoint.
+func (abc *ABC) AppHash(r int) ([32]byte, bool) {
+	abc.Lock()
+	defer abc.Unlock()
+	h, ok := abc.appHashes[r]
+	return h, ok
+}
+
+// runApplication delivers all finalized rounds to the application in commit order and sends a
+// checkpoint every checkpointInterval rounds.
+func (abc *ABC) runApplication() {
+	for c := range abc.Commits(0, nil) {
+		abc.app.DeliverBlock(c)
+		h := abc.app.Commit()
+		if c.Round%checkpointInterval == checkpointInterval-1 {
+			abc.sendCheckpoint(c.Round, h)
+		}
+	}
+}
+
+// sendCheckpoint multicasts the app hash of round r and compares it with the checkpoints that
+// were already received.
+func (abc *ABC) sendCheckpoint(r int, h [32]byte) {
+	abc.Lock()
+	abc.appHashes[r] = h
+	abc.Unlock()
+	mes := &utils.Message{
+		Sender: abc.Cfg.NodeId,
+		Payload: &Checkpoint{
+			Sender:  abc.Cfg.NodeId,
+			Round:   r,
+			AppHash: h,
+			Sig:     abc.tcs.identity.Sign(checkpointDomain, checkpointHash(r, h)),
+		},
+	}
+	abc.multicast(mes, syncRound)
+
+	abc.Lock()
+	senders := make([]int, 0, len(abc.checkpoints[r]))
+	for sender := range abc.checkpoints[r] {
+		senders = append(senders, sender)
+	}
+	abc.Unlock()
+	abc.compareCheckpoints(r, senders...)
+}
+
+// handleCheckpoint stores a valid checkpoint of another node.
+func (abc *ABC) handleCheckpoint(m *Checkpoint) {
+	if m.Sender < 0 || m.Sender >= abc.Cfg.n || m.Sender == abc.Cfg.NodeId {
+		return
+	}
+	if !abc.tcs.identity.Cert.VerifySig(m.Sender, checkpointDomain, checkpointHash(m.Round, m.AppHash), m.Sig) {
+		log.Printf("Node %d round %d: received checkpoint with invalid signature from %d", abc.Cfg.NodeId, m.Round, m.Sender)
+		return
+	}
+	abc.Lock()
+	if abc.checkpoints[m.Round] == nil {
+		abc.checkpoints[m.Round] = make(map[int][32]byte)
+	}
+	if _, ok := abc.checkpoints[m.Round][m.Sender]; ok {
+		abc.Unlock()
+		return
+	}
+	abc.checkpoints[m.Round][m.Sender] = m.AppHash
+	abc.Unlock()
+	abc.compareCheckpoints(m.Round, m.Sender)
+}
+
+// compareCheckpoints compares the app hash of round r with the checkpoints of senders. Nodes with a
+// different app hash are reported. If ta+1 nodes agree on a different app hash, at least one honest
+// node disagrees with this node and the local application state diverged.
+func (abc *ABC) compareCheckpoints(r int, senders ...int) {
+	abc.Lock()
+	own, ok := abc.appHashes[r]
+	if !ok {
+		abc.Unlock()
+		return
+	}
+	differing := make([]int, 0)
+	diverged := make(map[[32]byte]bool)
+	for _, sender := range senders {
+		h := abc.checkpoints[r][sender]
+		if h == own {
+			continue
+		}
+		differing = append(differing, sender)
+		count := 0
+		for _, other := range abc.checkpoints[r] {
+			if other == h {
+				count++
+			}
+		}
+		// Only the checkpoint that reaches the threshold logs the divergence
+		if count == abc.Cfg.ta+1 {
+			diverged[h] = true
+		}
+	}
+	abc.Unlock()
+
+	for _, sender := range differing {
+		abc.reportEvidence(r, sender, "app hash in checkpoint differs from the local app hash")
+	}
+	for h := range diverged {
+		log.Printf("Node %d round %d: application state diverged, %d nodes have app hash %x", abc.Cfg.NodeId, r, abc.Cfg.ta+1, h)
+	}
+}
+
+// checkpointHash returns a sha256 hash over the round and the app hash of a checkpoint.
+func checkpointHash(r int, h [32]byte) [32]byte {
+	return utils.NewEncoder(checkpointHashDomain).Int(r).Hash(h).Sum()
+}
@@ -0,0 +1,135 @@
+package tardigrade
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/niclabs/tcrsa"
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+// testApp keeps a running hash over all delivered transactions.
+type testApp struct {
+	state  [32]byte
+	rounds []int // Delivered rounds in order
+	sync.Mutex
+}
+
+func (app *testApp) CheckTx(tx []byte) error {
+	if bytes.HasPrefix(tx, []byte("invalid")) {
+		return errors.New("invalid transaction")
+	}
+	return nil
+}
+
+func (app *testApp) DeliverBlock(c *Commit) {
+	app.Lock()
+	defer app.Unlock()
+	app.rounds = append(app.rounds, c.Round)
+	for _, tx := range c.Block.Txs {
+		app.state = sha256.Sum256(append(app.state[:], tx...))
+	}
+}
+
+func (app *testApp) Commit() [32]byte {
+	app.Lock()
+	defer app.Unlock()
+	return app.state
+}
+
+func TestApplication(t *testing.T) {
+	t.Run("Drops transactions rejected by CheckTx", func(t *testing.T) {
+		u := NewABC(&ABCConfig{n: 1}, nil)
+		u.SetApplication(new(testApp))
+		u.FillBuffer([][]byte{[]byte("foo"), []byte("invalid"), []byte("bar")})
+		txs := u.proposeTxs(3, 3)
+		if len(txs) != 2 || !u.mempool.Has(sha256.Sum256([]byte("foo"))) || !u.mempool.Has(sha256.Sum256([]byte("bar"))) {
+			t.Errorf("Got unexpected mempool %q", txs)
+		}
+	})
+
+	t.Run("Detects diverging app hashes", func(t *testing.T) {
+		// Scenario: Node 3 applies the blocks differently than the other nodes
+		n := 4
+		keyShares, keyMeta, err := tcrsa.NewKey(512, uint16(n/2+1), uint16(n), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		identities, err := utils.NewIdentities(n, 0, map[int]bool{0: true, 1: true}, keyShares, keyMeta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodeChans := make(map[int]chan *utils.HandlerMessage)
+		for i := 0; i < n; i++ {
+			nodeChans[i] = make(chan *utils.HandlerMessage, 9999)
+		}
+		txs := make([]string, checkpointInterval)
+		for i := range txs {
+			txs[i] = fmt.Sprintf("tx%d", i)
+		}
+		chain := newTestChain(txs...)
+
+		abcs := make([]*ABC, n)
+		apps := make([]*testApp, n)
+		for i := 0; i < n; i++ {
+			handler := utils.NewLocalHandler(nodeChans, nil, i, n, 1)
+			cfg := NewABCConfig(n, i, 1, 1, 1, 1, 10, 0, 8, map[int]bool{0: true, 1: true}, nil, handler.Funcs)
+			abcs[i] = NewABC(cfg, &tcs{identity: identities[i]})
+			store := NewMemoryStore()
+			for r, block := range chain {
+				store.PutBlock(r, block)
+			}
+			if err := abcs[i].SetStore(store); err != nil {
+				t.Fatal(err)
+			}
+			apps[i] = new(testApp)
+			if i == 3 {
+				apps[i].state[0] = 1
+			}
+			abcs[i].SetApplication(apps[i])
+			go handler.Funcs.Receiver()
+			go abcs[i].serveSync()
+			go abcs[i].runApplication()
+		}
+
+		done := func() bool {
+			for i := 0; i < 3; i++ {
+				if len(abcs[i].GetEvidence()) == 0 {
+					return false
+				}
+			}
+			return len(abcs[3].GetEvidence()) >= 3
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) && !done() {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		apps[0].Lock()
+		for r, delivered := range apps[0].rounds {
+			if r != delivered {
+				t.Errorf("Round %d got delivered at position %d", delivered, r)
+			}
+		}
+		apps[0].Unlock()
+		h0, ok0 := abcs[0].AppHash(checkpointInterval - 1)
+		h1, ok1 := abcs[1].AppHash(checkpointInterval - 1)
+		if !ok0 || !ok1 || h0 != h1 {
+			t.Errorf("Expected nodes 0 and 1 to have the same app hash")
+		}
+		for i := 0; i < 3; i++ {
+			evidence := abcs[i].GetEvidence()
+			if len(evidence) != 1 || evidence[0].Node != 3 {
+				t.Errorf("Expected evidence of node %d against node 3, got %v", i, evidence)
+			}
+		}
+		if evidence := abcs[3].GetEvidence(); len(evidence) != 3 {
+			t.Errorf("Expected node 3 to report 3 differing app hashes, got %d", len(evidence))
+		}
+	})
+}
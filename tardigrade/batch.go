@@ -0,0 +1,79 @@
+package tardigrade
+
+import (
+	"fmt"
+	"log"
+
+	utils "github.com/sochsenreither/tardigrade/utils"
+)
+
+// checkBlockLimits returns an error if the message of a pre-block of the given size ("small" or
+// "large") carries more transactions or bytes than allowed. A small message carries one
+// transaction, a large message up to batchSize transactions and blockBytes bytes.
+func (abc *ABC) checkBlockLimits(size string, msg []byte) error {
+	if size == "large" {
+		if abc.Cfg.blockBytes > 0 && len(msg) > abc.Cfg.blockBytes {
+			return fmt.Errorf("message has %d bytes, allowed are %d", len(msg), abc.Cfg.blockBytes)
+		}
+		if txs := abc.countTxs(msg); abc.Cfg.batchSize > 0 && txs > abc.Cfg.batchSize {
+			return fmt.Errorf("message has %d transactions, allowed are %d", txs, abc.Cfg.batchSize)
+		}
+		return nil
+	}
+	if max := abc.maxFrameSize(); max > 0 && len(msg) > max {
+		return fmt.Errorf("message has %d bytes, allowed are %d", len(msg), max)
+	}
+	return nil
+}
+
+// countTxs returns the number of transactions in the message of a large pre-block. Without an
+// encryption key the ciphertexts can't be counted and 0 is returned.
+func (abc *ABC) countTxs(msg []byte) int {
+	if abc.Cfg.plaintext {
+		txs, _ := splitFrames(msg)
+		return len(txs)
+	}
+	size := abc.maxFrameSize()
+	if size == 0 {
+		return 0
+	}
+	return (len(msg) + size - 1) / size
+}
+
+// maxFrameSize returns the maximum size of the encrypted or, in plaintext mode, unencrypted frame
+// of a transaction. It returns 0 if the size isn't limited.
+func (abc *ABC) maxFrameSize() int {
+	if !abc.Cfg.plaintext {
+		if abc.tcs == nil || abc.tcs.encPk.N == nil {
+			return 0
+		}
+		return CiphertextSize(&abc.tcs.encPk)
+	}
+	if abc.Cfg.maxTxSize > 0 {
+		return FrameSize(abc.Cfg.maxTxSize)
+	}
+	return 0
+}
+
+// limitPreBlocks returns copies of the pre-blocks b without the messages that exceed the limits.
+// The pre-blocks were agreed on, so every node drops the same messages.
+func (abc *ABC) limitPreBlocks(r int, b []*utils.PreBlock) []*utils.PreBlock {
+	limited := make([]*utils.PreBlock, len(b))
+	for i, pb := range b {
+		limited[i] = &utils.PreBlock{
+			Vec:  make([]*utils.PreBlockMessage, len(pb.Vec)),
+			Size: pb.Size,
+		}
+		for j, v := range pb.Vec {
+			if v == nil {
+				continue
+			}
+			if err := abc.checkBlockLimits(pb.Size, v.Message); err != nil {
+				log.Printf("Node %d round %d: dropping %s block message of node %d. %s", abc.Cfg.NodeId, r, pb.Size, j, err)
+				continue
+			}
+			limited[i].Vec[j] = v
+		}
+	}
+	return limited
+}
@@ -0,0 +1,86 @@
+package tardigrade
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/niclabs/tcpaillier"
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+func TestBlockLimits(t *testing.T) {
+	t.Run("Limits encrypted messages", func(t *testing.T) {
+		_, pk, err := tcpaillier.NewKey(512, 1, 2, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := &ABCConfig{n: 4, kappa: 1}
+		cfg.SetBatchLimits(2, 0, 0)
+		u := NewABC(cfg, &tcs{encPk: *pk})
+		c, err := u.encryptTx([]byte("foo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := u.checkBlockLimits("large", bytes.Repeat(c, 2)); err != nil {
+			t.Errorf("Message within the limits was rejected: %s", err)
+		}
+		if err := u.checkBlockLimits("large", bytes.Repeat(c, 3)); err == nil {
+			t.Errorf("Message with too many transactions was accepted")
+		}
+		if err := u.checkBlockLimits("small", append(c, 0)); err == nil {
+			t.Errorf("Small message larger than a ciphertext was accepted")
+		}
+		if cfg.window != 4*4*1 {
+			t.Errorf("Expected default window of %d, got %d", 16, cfg.window)
+		}
+	})
+
+	t.Run("Limits unencrypted messages", func(t *testing.T) {
+		cfg := &ABCConfig{n: 4, maxTxSize: 3}
+		cfg.SetPlaintextMode(true)
+		cfg.SetBatchLimits(0, 0, 2*FrameSize(3))
+		u := NewABC(cfg, nil)
+		if cfg.batchSize != 4 {
+			t.Errorf("Expected default batch size of %d, got %d", 4, cfg.batchSize)
+		}
+		large := bytes.Join([][]byte{encodeFrame([]byte("foo")), encodeFrame([]byte("bar"))}, nil)
+		if err := u.checkBlockLimits("large", large); err != nil {
+			t.Errorf("Message within the limits was rejected: %s", err)
+		}
+		if err := u.checkBlockLimits("large", append(large, encodeFrame(nil)...)); err == nil {
+			t.Errorf("Message with too many bytes was accepted")
+		}
+		if err := u.checkBlockLimits("small", encodeFrame([]byte("quux"))); err == nil {
+			t.Errorf("Small message with a too large transaction was accepted")
+		}
+
+		pb := utils.NewPreBlock(2)
+		pb.Size = "large"
+		pb.AddMessage(0, &utils.PreBlockMessage{Message: large})
+		pb.AddMessage(1, &utils.PreBlockMessage{Message: append(large, encodeFrame(nil)...)})
+		block, _ := u.constructBlock(0, []*utils.PreBlock{pb}, nil, nil)
+		if got := string(bytes.Join(block.Txs, []byte(","))); got != "foo,bar" {
+			t.Errorf("Got unexpected transactions %q", got)
+		}
+		if pb.Vec[1] == nil {
+			t.Errorf("The agreed pre-block was changed")
+		}
+	})
+
+	t.Run("Proposes fewer transactions from a short mempool", func(t *testing.T) {
+		cfg := &ABCConfig{n: 4}
+		u := NewABC(cfg, nil)
+		for i := 0; i < 5; i++ {
+			u.mempool.Add([]byte(strconv.Itoa(i)))
+		}
+		v, w := u.proposeBatches(4, 8, 100)
+		if len(v) != 4 || len(w) != 5 {
+			t.Errorf("Expected %d and %d transactions, got %d and %d", 4, 5, len(v), len(w))
+		}
+		v, w = u.proposeBatches(2, 3, 3)
+		if len(v) != 2 || len(w) != 3 {
+			t.Errorf("Expected %d and %d transactions, got %d and %d", 2, 3, len(v), len(w))
+		}
+	})
+}
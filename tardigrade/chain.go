@@ -0,0 +1,87 @@
+package tardigrade
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	utils "github.com/sochsenreither/tardigrade/utils"
+)
+
+// waitForParent returns the header of the block of the round before r, nil for the first round. A
+// round can't be finished without its parent, so it waits until the block is finalized. While it is
+// missing, the node tries to catch up on it every decTimeout, since the other nodes may still be
+// decrypting it.
+func (abc *ABC) waitForParent(r int) *utils.BlockHeader {
+	if r == 0 {
+		return nil
+	}
+	finalized := abc.finalizedChan(r - 1)
+	select {
+	case <-finalized:
+	default:
+		stopCatchUps := abc.startCatchUps(r, abc.Cfg.decTimeout)
+		<-finalized
+		stopCatchUps()
+	}
+	abc.Lock()
+	defer abc.Unlock()
+	return abc.blocks[r-1].Header
+}
+
+// startCatchUps tries to catch up on the rounds before round to after every interval until the
+// returned function is called.
+func (abc *ABC) startCatchUps(to int, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				log.Printf("Node %d round %d: still waiting, catching up on the block", abc.Cfg.NodeId, to-1)
+				abc.runCatchUp(to)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+// finalizedChan returns a channel that is closed when the block of round r is finalized.
+func (abc *ABC) finalizedChan(r int) <-chan struct{} {
+	abc.Lock()
+	defer abc.Unlock()
+	ch, ok := abc.finalized[r]
+	if !ok {
+		ch = make(chan struct{})
+		if _, ok := abc.blocks[r]; ok {
+			close(ch)
+			return ch
+		}
+		abc.finalized[r] = ch
+	}
+	return ch
+}
+
+// verifyBlock returns an error if the block of round r doesn't match its header or doesn't follow
+// the block of the previous round. If the previous block is unknown only the header is checked.
+func verifyBlock(blocks map[int]*utils.Block, r int) error {
+	block := blocks[r]
+	if block.Header == nil || block.Header.Round != r {
+		return errors.New("missing or wrong header")
+	}
+	if r == 0 {
+		return block.Verify(nil)
+	}
+	if parent, ok := blocks[r-1]; ok && parent.Header != nil {
+		return block.Verify(parent.Header)
+	}
+	if block.Header.TxRoot != utils.MerkleRoot(block.Txs) {
+		return errors.New("transactions don't match the header")
+	}
+	return nil
+}
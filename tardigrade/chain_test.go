@@ -0,0 +1,92 @@
+package tardigrade
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+func TestWaitForParentMissing(t *testing.T) {
+	// Scenario: Rounds 3 to 5 wait for their parents, but no node answers sync requests.
+	var mu sync.Mutex
+	requests := 0
+	funcs := &utils.HandlerFuncs{
+		ABCmulticast: func(msg *utils.Message, UROUND int, receiver int) {
+			if _, ok := msg.Payload.(*SyncRequest); ok {
+				mu.Lock()
+				requests++
+				mu.Unlock()
+			}
+		},
+	}
+	lambda := 5
+	cfg := NewABCConfig(4, 0, 1, 1, 1, 1, lambda, 0, 8, map[int]bool{0: true}, nil, funcs)
+	cfg.SetDecryptionTimeout(50 * time.Millisecond)
+	u := NewABC(cfg, &tcs{})
+
+	var wg sync.WaitGroup
+	parents := make(map[int]*utils.BlockHeader)
+	for r := 3; r <= 5; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			parent := u.waitForParent(r)
+			mu.Lock()
+			parents[r] = parent
+			mu.Unlock()
+		}(r)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	start := time.Now()
+	select {
+	case <-done:
+		t.Fatalf("Stopped waiting for a missing parent")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// Catch-ups are retried, but only one runs at a time
+	mu.Lock()
+	sent := requests
+	mu.Unlock()
+	max := int(time.Since(start)/(time.Duration(lambda)*time.Millisecond)) + maxSyncAttempts
+	if sent == 0 || sent > max {
+		t.Errorf("Expected between 1 and %d sync requests, got %d", max, sent)
+	}
+
+	// The rounds finish once their parents arrive
+	chain := newTestChain("a", "b", "c", "d", "e")
+	for r, block := range chain {
+		u.setBlock(r, block)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Rounds didn't finish after their parents arrived")
+	}
+	for r := 3; r <= 5; r++ {
+		if parents[r] != chain[r-1].Header {
+			t.Errorf("Expected header of round %d as parent of round %d", r-1, r)
+		}
+	}
+}
+
+func TestWaitForParent(t *testing.T) {
+	chain := newTestChain("foo", "bar")
+	u := NewABC(NewABCConfig(1, 0, 0, 0, 1, 1, 5, 0, 8, map[int]bool{0: true}, nil, &utils.HandlerFuncs{}), &tcs{})
+	if parent := u.waitForParent(0); parent != nil {
+		t.Errorf("Expected no parent for round 0, got %v", parent)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		u.setBlock(0, chain[0])
+	}()
+	if parent := u.waitForParent(1); parent != chain[0].Header {
+		t.Errorf("Expected header of round 0, got %v", parent)
+	}
+}
@@ -0,0 +1,135 @@
+package tardigrade
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/niclabs/tcpaillier"
+	utils "github.com/sochsenreither/tardigrade/utils"
+)
+
+// ErrInvalidCiphertext is returned when a transaction submitted by a client isn't a ciphertext
+// under the public encryption key of the committee.
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// ErrTxRejected is reported for a ciphertext whose transaction was decrypted, but dropped from the
+// block as a duplicate or a replayed envelope.
+var ErrTxRejected = errors.New("transaction was dropped from the block after decryption")
+
+// Client encrypts transactions under the public encryption key of the committee before they are
+// submitted to a node. Only the committee can decrypt them together after the order of the round
+// was agreed on, so the node that receives a transaction can't censor it based on its content.
+type Client struct {
+	pk *tcpaillier.PubKey // Public encryption key of the committee
+}
+
+// NewClient returns a client that encrypts transactions under the public key pk.
+func NewClient(pk *tcpaillier.PubKey) *Client {
+	return &Client{
+		pk: pk,
+	}
+}
+
+// Encrypt returns the ciphertext of a transaction. Nodes that require client encryption only
+// accept transactions encrypted this way.
+func (c *Client) Encrypt(tx []byte) ([]byte, error) {
+	return encryptFrame(c.pk, tx)
+}
+
+// EncryptEnvelope signs a payload with the private key sk of the client and returns the
+// ciphertext of the envelope.
+func (c *Client) EncryptEnvelope(sk ed25519.PrivateKey, nonce uint64, payload []byte) ([]byte, error) {
+	return c.Encrypt(NewEnvelope(sk, nonce, payload).Encode())
+}
+
+// CiphertextSize returns the size in bytes of a ciphertext under the public key pk.
+func CiphertextSize(pk *tcpaillier.PubKey) int {
+	return pk.N.BitLen() / 4
+}
+
+// encryptFrame encrypts the frame of a transaction. The ciphertext is padded with leading zeros to
+// CiphertextSize, so ciphertexts can be concatenated in a large pre-block.
+func encryptFrame(pk *tcpaillier.PubKey, tx []byte) ([]byte, error) {
+	frame := encodeFrame(tx)
+	if 8*len(frame) >= pk.N.BitLen() {
+		return nil, fmt.Errorf("%w: transaction of %d bytes doesn't fit into the encryption key", ErrTxSize, len(tx))
+	}
+	c, _, err := pk.Encrypt(new(big.Int).SetBytes(frame))
+	if err != nil {
+		return nil, err
+	}
+	size := CiphertextSize(pk)
+	if len(c.Bytes()) > size {
+		return nil, fmt.Errorf("ciphertext has %d bytes, expected at most %d", len(c.Bytes()), size)
+	}
+	return c.FillBytes(make([]byte, size)), nil
+}
+
+// EncryptionKey returns the public encryption key of the committee for creating clients.
+func (abc *ABC) EncryptionKey() *tcpaillier.PubKey {
+	return &abc.tcs.encPk
+}
+
+// encryptTx returns the ciphertext of a proposed transaction. Transactions that were encrypted by
+// a client already are proposed as they are, in plaintext mode only the frame is proposed.
+func (abc *ABC) encryptTx(tx []byte) ([]byte, error) {
+	if abc.Cfg.plaintext {
+		return encodeFrame(tx), nil
+	}
+	if abc.Cfg.clientEnc {
+		return tx, nil
+	}
+	return encryptFrame(&abc.tcs.encPk, tx)
+}
+
+// checkCiphertext returns ErrInvalidCiphertext if tx isn't a ciphertext of CiphertextSize bytes
+// under the public encryption key. The plaintext is only checked after the decryption.
+func (abc *ABC) checkCiphertext(tx []byte) error {
+	pk := &abc.tcs.encPk
+	if len(tx) != CiphertextSize(pk) {
+		return fmt.Errorf("%w: has %d bytes, expected %d", ErrInvalidCiphertext, len(tx), CiphertextSize(pk))
+	}
+	c := new(big.Int).SetBytes(tx)
+	nSquared := new(big.Int).Mul(pk.N, pk.N)
+	if c.Sign() <= 0 || c.Cmp(nSquared) >= 0 || new(big.Int).GCD(nil, nil, c, pk.N).Cmp(big.NewInt(1)) != 0 {
+		return fmt.Errorf("%w: not in the ciphertext space", ErrInvalidCiphertext)
+	}
+	return nil
+}
+
+// SetIncludeHandler sets a function that is called with the hash of every ciphertext submitted by
+// a client whose transaction is included in the block of round r. Blocks a node only catches up on
+// aren't decrypted by it, so their ciphertexts aren't reported.
+func (abc *ABC) SetIncludeHandler(f func(h [32]byte, r int)) {
+	abc.Lock()
+	defer abc.Unlock()
+	abc.onInclude = f
+}
+
+// reportCiphertexts reports the ciphertexts that were decrypted for the block of round r. A
+// ciphertext is included if its transaction is in the block. It is rejected if the transaction was
+// dropped from the block afterwards and the ciphertext is still in the mempool, so a ciphertext that
+// is proposed again after it was included isn't rejected. It has to be called before the
+// ciphertexts are removed from the mempool.
+func (abc *ABC) reportCiphertexts(r int, block *utils.Block, sources *blockSources) {
+	abc.Lock()
+	onInclude, onDrop := abc.onInclude, abc.onDrop
+	abc.Unlock()
+	included := make(map[[32]byte]bool, len(block.Txs))
+	for _, tx := range block.Txs {
+		included[sources.mempoolKey(sha256.Sum256(tx))] = true
+	}
+	for _, c := range sources.ciphertexts {
+		h := sha256.Sum256(c)
+		if included[h] {
+			if onInclude != nil {
+				onInclude(h, r)
+			}
+		} else if onDrop != nil && abc.mempool.Has(h) {
+			onDrop(h, ErrTxRejected)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package tardigrade
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/niclabs/tcpaillier"
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+func TestClientEncryption(t *testing.T) {
+	shares, pk, err := tcpaillier.NewKey(512, 1, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ABCConfig{
+		n:         2,
+		NodeId:    0,
+		committee: map[int]bool{0: true, 1: true},
+		maxTxSize: 8,
+	}
+	cfg.SetClientEncryption(true)
+	cfg.SetBatchLimits(4, 0, 0)
+	u := NewABC(cfg, &tcs{encPk: *pk})
+	u.SetExternalValidity(func(tx []byte) error {
+		if string(tx) == "baz" {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+	u.SetApplication(&testApp{})
+	client := NewClient(u.EncryptionKey())
+
+	t.Run("Admits ciphertexts", func(t *testing.T) {
+		c, err := client.Encrypt([]byte("foo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(c) != CiphertextSize(pk) {
+			t.Errorf("Expected ciphertext of %d bytes, got %d", CiphertextSize(pk), len(c))
+		}
+		if err := u.SubmitTx(c); err != nil {
+			t.Errorf("Ciphertext was rejected: %s", err)
+		}
+		if u.PendingTxs() != 1 {
+			t.Errorf("Expected %d pending transaction, got %d", 1, u.PendingTxs())
+		}
+	})
+
+	t.Run("Rejects plaintexts", func(t *testing.T) {
+		for _, tx := range [][]byte{[]byte("foo"), make([]byte, CiphertextSize(pk))} {
+			if err := u.SubmitTx(tx); !errors.Is(err, ErrInvalidCiphertext) {
+				t.Errorf("Expected %v, got %v", ErrInvalidCiphertext, err)
+			}
+		}
+	})
+
+	t.Run("Checks transactions after decryption", func(t *testing.T) {
+		valid, _ := client.Encrypt([]byte("bar"))
+		invalid, _ := client.Encrypt([]byte("baz"))
+		large, _ := client.Encrypt([]byte("too large"))
+		rejected, _ := client.Encrypt([]byte("invalid"))
+		cts := [][]byte{valid, invalid, large, rejected}
+		pb := utils.NewPreBlock(2)
+		pb.Size = "large"
+		pb.AddMessage(1, &utils.PreBlockMessage{Message: bytes.Join(cts, nil)})
+		decChan := make(chan *PbDecryptionShareMessage, len(shares))
+		for node, share := range shares {
+			m := &PbDecryptionShareMessage{
+				Sender:    node,
+				DecShares: [][]*tcpaillier.DecryptionShare{nil, make([]*tcpaillier.DecryptionShare, len(cts))},
+				Proofs:    [][]*tcpaillier.DecryptShareZK{nil, make([]*tcpaillier.DecryptShareZK, len(cts))},
+			}
+			for j, c := range cts {
+				ds, zk, err := share.PartialDecryptWithProof(new(big.Int).SetBytes(c))
+				if err != nil {
+					t.Fatal(err)
+				}
+				m.DecShares[1][j] = ds
+				m.Proofs[1][j] = zk
+			}
+			decChan <- m
+		}
+		block, src := u.constructBlock(0, []*utils.PreBlock{pb}, decChan, newDeadline(5*time.Second))
+		if len(block.Txs) != 1 {
+			t.Fatalf("Expected %d transaction, got %d", 1, len(block.Txs))
+		}
+		if string(block.Txs[0]) != "bar" {
+			t.Errorf("Got unexpected transaction %q", block.Txs[0])
+		}
+		if len(src.ciphertexts) != 1 || !bytes.Equal(src.ciphertexts[0], valid) {
+			t.Errorf("Expected the ciphertext of the transaction in the block")
+		}
+	})
+
+	t.Run("Reports ciphertexts by their hash", func(t *testing.T) {
+		first, _ := client.Encrypt([]byte("foo"))
+		second, _ := client.Encrypt([]byte("foo"))
+		replayed, _ := client.Encrypt([]byte("bar"))
+		src := newBlockSources(2, nil)
+		src.addCiphertext([]byte("foo"), first)
+		src.addCiphertext([]byte("foo"), second)
+		src.addCiphertext([]byte("bar"), replayed)
+		for _, c := range [][]byte{first, second, replayed} {
+			u.SubmitTx(c)
+		}
+		included := make(map[[32]byte]int)
+		dropped := make(map[[32]byte]error)
+		u.SetIncludeHandler(func(h [32]byte, r int) {
+			included[h] = r
+		})
+		u.SetDropHandler(func(h [32]byte, reason error) {
+			dropped[h] = reason
+		})
+		defer u.SetIncludeHandler(nil)
+		defer u.SetDropHandler(nil)
+
+		// The duplicate and the replayed transaction were dropped from the block
+		u.reportCiphertexts(3, &utils.Block{Txs: [][]byte{[]byte("foo")}}, src)
+		if r, ok := included[sha256.Sum256(first)]; len(included) != 1 || !ok || r != 3 {
+			t.Errorf("Expected only the first ciphertext to be included in round %d, got %v", 3, included)
+		}
+		if len(dropped) != 2 || dropped[sha256.Sum256(second)] != ErrTxRejected || dropped[sha256.Sum256(replayed)] != ErrTxRejected {
+			t.Errorf("Got unexpected dropped ciphertexts %v", dropped)
+		}
+
+		// Ciphertexts that left the mempool aren't rejected when they are proposed again
+		u.mempool.Remove([][]byte{first, second, replayed})
+		dropped = make(map[[32]byte]error)
+		u.reportCiphertexts(4, &utils.Block{}, src)
+		if len(dropped) != 0 {
+			t.Errorf("Expected no dropped ciphertexts, got %v", dropped)
+		}
+	})
+
+	t.Run("Proposes ciphertexts as they are", func(t *testing.T) {
+		c, _ := client.Encrypt([]byte("qux"))
+		proposed, err := u.encryptTx(c)
+		if err != nil || !bytes.Equal(proposed, c) {
+			t.Errorf("Ciphertext was changed before proposing it")
+		}
+		if u.mempool.Has(sha256.Sum256(proposed)) {
+			t.Errorf("Ciphertext wasn't submitted, but is in the mempool")
+		}
+	})
+}
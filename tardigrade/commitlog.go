@@ -0,0 +1,75 @@
+package tardigrade
+
+import (
+	"log"
+
+	utils "github.com/sochsenreither/tardigrade/utils"
+)
+
+// Size of the buffer of a commit channel
+const commitBufferSize = 16
+
+// Commit is a finalized round as it is delivered to consumers of the commit log.
+type Commit struct {
+	Round   int
+	Block   *utils.Block
+	Empty   bool // The block contains no transactions
+	Crashed bool // The node didn't take part in the round and received the block from its peers
+}
+
+// Commits returns a channel on which all finalized rounds from round from on are delivered in
+// round order. A round is only delivered after all rounds before it are finalized, even if rounds
+// finish out of order. Rounds that were finalized before they are delivered are replayed from the
+// store. Every subscriber has its own goroutine, so a slow subscriber only delays its own channel
+// and never the protocol. The channel is closed when done is closed.
+func (abc *ABC) Commits(from int, done <-chan struct{}) <-chan *Commit {
+	ch := make(chan *Commit, commitBufferSize)
+	go func() {
+		defer close(ch)
+		for r := from; ; r++ {
+			replay := true
+			select {
+			case <-abc.finalizedChan(r):
+			default:
+				replay = false
+				select {
+				case <-abc.finalizedChan(r):
+				case <-done:
+					return
+				}
+			}
+			select {
+			case ch <- abc.commit(r, replay):
+			case <-done:
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// commit returns the commit of the finalized round r. If replay is set the block is read from the
+// store.
+func (abc *ABC) commit(r int, replay bool) *Commit {
+	var block *utils.Block
+	if replay {
+		var ok bool
+		var err error
+		block, ok, err = abc.store.Block(r)
+		if err != nil || !ok {
+			log.Printf("Node %d round %d: failed to replay block from store, using block in memory", abc.Cfg.NodeId, r)
+			block = nil
+		}
+	}
+	abc.Lock()
+	defer abc.Unlock()
+	if block == nil {
+		block = abc.blocks[r]
+	}
+	return &Commit{
+		Round:   r,
+		Block:   block,
+		Empty:   len(block.Txs) == 0,
+		Crashed: abc.synced[r],
+	}
+}
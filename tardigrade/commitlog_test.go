@@ -0,0 +1,48 @@
+package tardigrade
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommits(t *testing.T) {
+	chain := newTestChain("foo", "bar", "baz")
+	chain[2].Txs = chain[2].Txs[:0]
+	u := NewABC(&ABCConfig{n: 1}, nil)
+	done := make(chan struct{})
+	defer close(done)
+	commits := u.Commits(0, done)
+
+	// Rounds finish out of order
+	u.setBlock(2, chain[2])
+	select {
+	case c := <-commits:
+		t.Fatalf("Round %d got delivered before round 0", c.Round)
+	case <-time.After(50 * time.Millisecond):
+	}
+	u.setBlock(0, chain[0])
+	u.Lock()
+	u.synced[1] = true
+	u.Unlock()
+	u.setBlock(1, chain[1])
+
+	for r := 0; r < len(chain); r++ {
+		select {
+		case c := <-commits:
+			if c.Round != r || c.Block != chain[r] {
+				t.Fatalf("Expected round %d, got round %d", r, c.Round)
+			}
+			if c.Crashed != (r == 1) || c.Empty != (r == 2) {
+				t.Errorf("Round %d is marked as crashed: %t, empty: %t", r, c.Crashed, c.Empty)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Round %d wasn't delivered", r)
+		}
+	}
+
+	// A later subscriber gets the finalized rounds right away
+	late := u.Commits(1, done)
+	if c := <-late; c.Round != 1 {
+		t.Errorf("Expected round 1, got round %d", c.Round)
+	}
+}
@@ -0,0 +1,120 @@
+package tardigrade
+
+import (
+	"crypto/sha256"
+	"sync"
+
+	utils "github.com/sochsenreither/tardigrade/utils"
+)
+
+// Number of rounds before a round whose transactions are dropped from its block
+const dedupWindow = 64
+
+// txIndex is a bounded index of the hashes of the transactions in the blocks of recent rounds.
+type txIndex struct {
+	rounds map[int][][32]byte // Maps round -> hashes of the transactions of its block
+	hashes map[[32]byte][]int // Maps h(tx) -> rounds whose block contains the transaction
+	sync.Mutex
+}
+
+func newTxIndex() *txIndex {
+	return &txIndex{
+		rounds: make(map[int][][32]byte),
+		hashes: make(map[[32]byte][]int),
+	}
+}
+
+// add indexes the transactions of the block of round r. Adding a round twice is a no-op.
+func (idx *txIndex) add(r int, txs [][]byte) {
+	idx.Lock()
+	defer idx.Unlock()
+	if _, ok := idx.rounds[r]; ok {
+		return
+	}
+	hashes := make([][32]byte, len(txs))
+	for i, tx := range txs {
+		h := sha256.Sum256(tx)
+		hashes[i] = h
+		idx.hashes[h] = append(idx.hashes[h], r)
+	}
+	idx.rounds[r] = hashes
+}
+
+// contains returns whether one of the dedupWindow rounds before r contains the transaction with
+// hash h.
+func (idx *txIndex) contains(h [32]byte, r int) bool {
+	idx.Lock()
+	defer idx.Unlock()
+	for _, round := range idx.hashes[h] {
+		if round < r && round >= r-dedupWindow {
+			return true
+		}
+	}
+	return false
+}
+
+// has returns whether the block of any indexed round contains the transaction with hash h.
+func (idx *txIndex) has(h [32]byte) bool {
+	idx.Lock()
+	defer idx.Unlock()
+	return len(idx.hashes[h]) > 0
+}
+
+// prune removes the rounds that are out of the window of round r. Since rounds are finalized in
+// order, later rounds don't need them either.
+func (idx *txIndex) prune(r int) {
+	idx.Lock()
+	defer idx.Unlock()
+	for round, hashes := range idx.rounds {
+		if round >= r-dedupWindow {
+			continue
+		}
+		for _, h := range hashes {
+			rounds := idx.hashes[h][:0]
+			for _, other := range idx.hashes[h] {
+				if other != round {
+					rounds = append(rounds, other)
+				}
+			}
+			if len(rounds) == 0 {
+				delete(idx.hashes, h)
+			} else {
+				idx.hashes[h] = rounds
+			}
+		}
+		delete(idx.rounds, round)
+	}
+}
+
+// dedupBlock drops the transactions from the block of round r that already appear earlier in the
+// block or in the blocks of the dedupWindow rounds before. Transactions are checked in block order,
+// so the first occurrence is kept. Since the blocks of all rounds before r are finalized when it is
+// called, every node drops the same transactions. Returns the number of dropped duplicates within
+// the block and of dropped transactions that are already in the ledger.
+func (abc *ABC) dedupBlock(r int, block *utils.Block) (int, int) {
+	abc.ledger.prune(r)
+	seen := make(map[[32]byte]bool, len(block.Txs))
+	txs := make([][]byte, 0, len(block.Txs))
+	inBlock, inLedger := 0, 0
+	for _, tx := range block.Txs {
+		h := sha256.Sum256(tx)
+		if seen[h] {
+			inBlock++
+			continue
+		}
+		seen[h] = true
+		if abc.ledger.contains(h, r) {
+			inLedger++
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	block.Txs = txs
+	block.TxsCount = len(txs)
+
+	abc.Lock()
+	abc.DupTxsInBlock += inBlock
+	abc.DupTxsInLedger += inLedger
+	abc.Unlock()
+	return inBlock, inLedger
+}
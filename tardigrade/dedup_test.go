@@ -0,0 +1,57 @@
+package tardigrade
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+func TestDedupBlock(t *testing.T) {
+	u := NewABC(&ABCConfig{n: 1}, nil)
+	txs := func(s ...string) [][]byte {
+		ret := make([][]byte, len(s))
+		for i := range s {
+			ret[i] = []byte(s[i])
+		}
+		return ret
+	}
+
+	t.Run("Drops duplicates within a block", func(t *testing.T) {
+		block := &utils.Block{Txs: txs("foo", "bar", "foo", "baz", "bar")}
+		inBlock, inLedger := u.dedupBlock(0, block)
+		if inBlock != 2 || inLedger != 0 {
+			t.Errorf("Expected %d and %d duplicates, got %d and %d", 2, 0, inBlock, inLedger)
+		}
+		if len(block.Txs) != 3 || string(block.Txs[0]) != "foo" || string(block.Txs[1]) != "bar" || string(block.Txs[2]) != "baz" {
+			t.Errorf("Got unexpected transactions %q", block.Txs)
+		}
+		if block.TxsCount != 3 {
+			t.Errorf("Expected %d transactions, got %d", 3, block.TxsCount)
+		}
+		u.setBlock(0, block)
+	})
+
+	t.Run("Drops transactions of recent rounds", func(t *testing.T) {
+		block := &utils.Block{Txs: txs("foo", "qux")}
+		inBlock, inLedger := u.dedupBlock(1, block)
+		if inBlock != 0 || inLedger != 1 || len(block.Txs) != 1 || string(block.Txs[0]) != "qux" {
+			t.Errorf("Got unexpected transactions %q", block.Txs)
+		}
+		u.setBlock(1, block)
+		if u.DupTxsInBlock != 2 || u.DupTxsInLedger != 1 {
+			t.Errorf("Got unexpected metrics %d and %d", u.DupTxsInBlock, u.DupTxsInLedger)
+		}
+	})
+
+	t.Run("Forgets transactions outside of the window", func(t *testing.T) {
+		r := dedupWindow + 1
+		block := &utils.Block{Txs: txs("foo", "qux")}
+		if _, inLedger := u.dedupBlock(r, block); inLedger != 1 || len(block.Txs) != 1 || string(block.Txs[0]) != "foo" {
+			t.Errorf("Got unexpected transactions %q", block.Txs)
+		}
+		if _, ok := u.ledger.rounds[0]; ok || u.ledger.contains(sha256.Sum256([]byte("bar")), r) {
+			t.Errorf("Round 0 wasn't pruned from the index")
+		}
+	})
+}
@@ -0,0 +1,220 @@
+package tardigrade
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"log"
+	"sync"
+
+	utils "github.com/sochsenreither/tardigrade/utils"
+)
+
+// Domain of the signatures of clients on envelopes
+const envelopeDomain = "tardigrade/client-envelope"
+
+const (
+	envelopeVersion    = 1                                                     // First byte of an encoded envelope
+	envelopeHeaderSize = 1 + ed25519.PublicKeySize + 8 + ed25519.SignatureSize // Version, client, nonce and signature
+	nonceWindow        = 256                                                   // Number of nonces below the highest one a client can still use
+)
+
+// ErrReplayedTx is returned when the nonce of an envelope was already used by its client or is
+// too old.
+var ErrReplayedTx = errors.New("nonce was already used")
+
+// Envelope is a transaction signed by a client. The client is identified by its public key. Every
+// nonce can only be used once per client, so a transaction can't be replayed.
+type Envelope struct {
+	Client  ed25519.PublicKey // Public key of the client
+	Nonce   uint64
+	Payload []byte
+	Sig     []byte // Signature of the client on the nonce and the payload
+}
+
+// NewEnvelope returns the envelope of a payload signed by the client with the private key sk.
+func NewEnvelope(sk ed25519.PrivateKey, nonce uint64, payload []byte) *Envelope {
+	e := &Envelope{
+		Client:  sk.Public().(ed25519.PublicKey),
+		Nonce:   nonce,
+		Payload: payload,
+	}
+	e.Sig = ed25519.Sign(sk, e.signedData())
+	return e
+}
+
+// signedData returns the encoding of the envelope that is signed by the client.
+func (e *Envelope) signedData() []byte {
+	return utils.NewEncoder(envelopeDomain).Bytes(e.Client).Int(int(e.Nonce)).Bytes(e.Payload).Encoded()
+}
+
+// Verify returns an error if the signature of the client is invalid.
+func (e *Envelope) Verify() error {
+	if len(e.Client) != ed25519.PublicKeySize || !ed25519.Verify(e.Client, e.signedData(), e.Sig) {
+		return errors.New("invalid client signature")
+	}
+	return nil
+}
+
+// Encode returns the transaction of the envelope: the version, the client, the nonce, the
+// signature and the payload.
+func (e *Envelope) Encode() []byte {
+	tx := make([]byte, envelopeHeaderSize, envelopeHeaderSize+len(e.Payload))
+	tx[0] = envelopeVersion
+	copy(tx[1:], e.Client)
+	binary.BigEndian.PutUint64(tx[1+ed25519.PublicKeySize:], e.Nonce)
+	copy(tx[1+ed25519.PublicKeySize+8:], e.Sig)
+	return append(tx, e.Payload...)
+}
+
+// DecodeEnvelope decodes the envelope of a transaction. It doesn't verify the signature.
+func DecodeEnvelope(tx []byte) (*Envelope, error) {
+	if len(tx) < envelopeHeaderSize || tx[0] != envelopeVersion {
+		return nil, errors.New("transaction isn't an envelope")
+	}
+	return &Envelope{
+		Client:  ed25519.PublicKey(tx[1 : 1+ed25519.PublicKeySize]),
+		Nonce:   binary.BigEndian.Uint64(tx[1+ed25519.PublicKeySize:]),
+		Sig:     tx[1+ed25519.PublicKeySize+8 : envelopeHeaderSize],
+		Payload: tx[envelopeHeaderSize:],
+	}, nil
+}
+
+// nonceTracker keeps the nonces of every client that were used in the ledger. Nonces are only
+// tracked in a window below the highest nonce of a client, older nonces are rejected.
+type nonceTracker struct {
+	clients map[[ed25519.PublicKeySize]byte]*clientNonces
+	next    int // First round whose block wasn't applied yet
+	sync.Mutex
+}
+
+type clientNonces struct {
+	highest uint64          // Highest used nonce
+	used    map[uint64]bool // Used nonces in the window below highest
+}
+
+func newNonceTracker() *nonceTracker {
+	return &nonceTracker{
+		clients: make(map[[ed25519.PublicKeySize]byte]*clientNonces),
+	}
+}
+
+// check returns ErrReplayedTx if the nonce of e was used or is out of the window.
+func (t *nonceTracker) check(e *Envelope) error {
+	var client [ed25519.PublicKeySize]byte
+	copy(client[:], e.Client)
+	c, ok := t.clients[client]
+	if !ok {
+		return nil
+	}
+	if c.used[e.Nonce] || (c.highest >= nonceWindow && e.Nonce <= c.highest-nonceWindow) {
+		return ErrReplayedTx
+	}
+	return nil
+}
+
+// use marks the nonce of e as used.
+func (t *nonceTracker) use(e *Envelope) {
+	var client [ed25519.PublicKeySize]byte
+	copy(client[:], e.Client)
+	c, ok := t.clients[client]
+	if !ok {
+		c = &clientNonces{used: make(map[uint64]bool)}
+		t.clients[client] = c
+	}
+	c.used[e.Nonce] = true
+	if e.Nonce > c.highest {
+		c.highest = e.Nonce
+		for nonce := range c.used {
+			if c.highest >= nonceWindow && nonce <= c.highest-nonceWindow {
+				delete(c.used, nonce)
+			}
+		}
+	}
+}
+
+// checkEnvelope decodes a transaction and verifies the signature of its client. It doesn't depend
+// on the ledger, so every node decides the same for a transaction.
+func checkEnvelope(tx []byte) (*Envelope, error) {
+	e, err := DecodeEnvelope(tx)
+	if err != nil {
+		return nil, err
+	}
+	return e, e.Verify()
+}
+
+// checkTxValidity returns an error if the transaction is no valid envelope while envelopes are
+// required or if the external validity rejects it. The result only depends on the transaction.
+func (abc *ABC) checkTxValidity(tx []byte) error {
+	if abc.Cfg.envelopes {
+		if _, err := checkEnvelope(tx); err != nil {
+			return err
+		}
+	}
+	if abc.validity != nil {
+		return abc.validity(tx)
+	}
+	return nil
+}
+
+// checkNonce returns ErrReplayedTx if the nonce of the envelope tx was already used in the ledger.
+// Since rounds can still be in progress this is only a hint at admission.
+func (abc *ABC) checkNonce(tx []byte) error {
+	if !abc.Cfg.envelopes {
+		return nil
+	}
+	e, err := DecodeEnvelope(tx)
+	if err != nil {
+		return err
+	}
+	abc.nonces.Lock()
+	defer abc.nonces.Unlock()
+	return abc.nonces.check(e)
+}
+
+// dropReplayedTxs drops the envelopes from the block of round r whose nonces were already used in
+// an earlier round or earlier in the block. The blocks of all rounds before r are applied to the
+// nonce tracker in round order first, so every node drops the same transactions. Returns the
+// number of dropped transactions.
+func (abc *ABC) dropReplayedTxs(r int, block *utils.Block) int {
+	if !abc.Cfg.envelopes {
+		return 0
+	}
+	abc.nonces.Lock()
+	defer abc.nonces.Unlock()
+	for ; abc.nonces.next < r; abc.nonces.next++ {
+		prev, ok := abc.GetBlock(abc.nonces.next)
+		if !ok {
+			log.Printf("Node %d round %d: missing block of round %d for tracking nonces", abc.Cfg.NodeId, r, abc.nonces.next)
+			continue
+		}
+		for _, tx := range prev.Txs {
+			if e, err := DecodeEnvelope(tx); err == nil {
+				abc.nonces.use(e)
+			}
+		}
+	}
+	type clientNonce struct {
+		client [ed25519.PublicKeySize]byte
+		nonce  uint64
+	}
+	seen := make(map[clientNonce]bool)
+	txs := make([][]byte, 0, len(block.Txs))
+	for _, tx := range block.Txs {
+		e, err := DecodeEnvelope(tx)
+		if err != nil || abc.nonces.check(e) != nil {
+			continue
+		}
+		key := clientNonce{nonce: e.Nonce}
+		copy(key.client[:], e.Client)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		txs = append(txs, tx)
+	}
+	dropped := len(block.Txs) - len(txs)
+	block.Txs = txs
+	block.TxsCount = len(txs)
+	return dropped
+}
@@ -0,0 +1,92 @@
+package tardigrade
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+func TestEnvelope(t *testing.T) {
+	_, sk, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ABCConfig{n: 1}
+	cfg.SetEnvelopes(true)
+	u := NewABC(cfg, nil)
+	tx := func(nonce uint64, payload string) []byte {
+		return NewEnvelope(sk, nonce, []byte(payload)).Encode()
+	}
+
+	t.Run("Encodes and verifies envelopes", func(t *testing.T) {
+		e, err := checkEnvelope(tx(7, "foo"))
+		if err != nil {
+			t.Fatalf("Valid envelope was rejected: %s", err)
+		}
+		if e.Nonce != 7 || string(e.Payload) != "foo" || !e.Client.Equal(sk.Public()) {
+			t.Errorf("Got unexpected envelope %+v", e)
+		}
+	})
+
+	t.Run("Rejects invalid envelopes", func(t *testing.T) {
+		tampered := tx(7, "foo")
+		tampered[len(tampered)-1] ^= 1
+		if err := u.checkTxValidity(tampered); err == nil {
+			t.Errorf("Tampered envelope was accepted")
+		}
+		if err := u.checkTxValidity([]byte("foo")); err == nil {
+			t.Errorf("Plain transaction was accepted")
+		}
+	})
+
+	t.Run("Applies the external validity", func(t *testing.T) {
+		errRejected := errors.New("rejected")
+		u.SetExternalValidity(func(tx []byte) error {
+			if e, _ := DecodeEnvelope(tx); string(e.Payload) == "bad" {
+				return errRejected
+			}
+			return nil
+		})
+		defer u.SetExternalValidity(nil)
+		if err := u.checkTxValidity(tx(1, "bad")); err != errRejected {
+			t.Errorf("Expected %v, got %v", errRejected, err)
+		}
+		if err := u.checkTxValidity(tx(1, "good")); err != nil {
+			t.Errorf("Valid transaction was rejected: %s", err)
+		}
+	})
+
+	t.Run("Drops replays within a block", func(t *testing.T) {
+		block := &utils.Block{Txs: [][]byte{tx(1, "foo"), tx(1, "bar"), tx(2, "foo")}}
+		if dropped := u.dropReplayedTxs(0, block); dropped != 1 || len(block.Txs) != 2 || block.TxsCount != 2 {
+			t.Errorf("Expected %d dropped transaction, got %d", 1, dropped)
+		}
+		u.setBlock(0, block)
+	})
+
+	t.Run("Drops replays of earlier rounds", func(t *testing.T) {
+		if err := u.checkNonce(tx(1, "baz")); err != nil {
+			t.Errorf("Nonces of round 0 shouldn't be tracked before round 1 is finalized")
+		}
+		block := &utils.Block{Txs: [][]byte{tx(2, "baz"), tx(3, "baz")}}
+		if dropped := u.dropReplayedTxs(1, block); dropped != 1 || len(block.Txs) != 1 {
+			t.Errorf("Expected %d dropped transaction, got %d", 1, dropped)
+		}
+		if err := u.checkNonce(tx(1, "baz")); err != ErrReplayedTx {
+			t.Errorf("Expected %v, got %v", ErrReplayedTx, err)
+		}
+		u.setBlock(1, block)
+	})
+
+	t.Run("Rejects nonces outside of the window", func(t *testing.T) {
+		block := &utils.Block{Txs: [][]byte{tx(nonceWindow+10, "foo")}}
+		u.dropReplayedTxs(2, block)
+		u.setBlock(2, block)
+		block = &utils.Block{Txs: [][]byte{tx(4, "foo"), tx(nonceWindow+9, "foo")}}
+		if dropped := u.dropReplayedTxs(3, block); dropped != 1 || len(block.Txs) != 1 {
+			t.Errorf("Expected %d dropped transaction, got %d", 1, dropped)
+		}
+	})
+}
@@ -0,0 +1,35 @@
+package tardigrade
+
+import (
+	"log"
+)
+
+// Evidence records misbehaviour of a node that was detected while running a round.
+type Evidence struct {
+	Round    int           // Round in which the misbehaviour was detected
+	Node     int           // Id of the misbehaving node
+	Reason   string        // Short description of the misbehaviour
+	Messages []interface{} // Signed messages proving the misbehaviour, if any
+}
+
+// reportEvidence logs and stores evidence against node in round r.
+func (abc *ABC) reportEvidence(r, node int, reason string, messages ...interface{}) {
+	log.Printf("Node %d round %d: evidence against node %d: %s", abc.Cfg.NodeId, r, node, reason)
+	abc.Lock()
+	defer abc.Unlock()
+	abc.evidence = append(abc.evidence, &Evidence{
+		Round:    r,
+		Node:     node,
+		Reason:   reason,
+		Messages: messages,
+	})
+}
+
+// GetEvidence returns a copy of all evidence collected so far.
+func (abc *ABC) GetEvidence() []*Evidence {
+	abc.Lock()
+	defer abc.Unlock()
+	ret := make([]*Evidence, len(abc.evidence))
+	copy(ret, abc.evidence)
+	return ret
+}
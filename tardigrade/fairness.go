@@ -0,0 +1,196 @@
+package tardigrade
+
+import (
+	"crypto/sha256"
+	"log"
+	"sync"
+	"time"
+
+	utils "github.com/sochsenreither/tardigrade/utils"
+)
+
+const (
+	censorRounds   = 5  // Consecutive rounds without an included slot after which a node is flagged
+	fairnessWindow = 64 // Number of recent rounds whose statistics are kept
+)
+
+// blockSources records where the transactions of a constructed block came from.
+type blockSources struct {
+	slots       []int                 // Maps nodeId -> included pre-block slots of the node
+	proposers   map[[32]byte]int      // Maps h(tx) -> node whose slot contained the transaction first
+	ciphertexts [][]byte              // Ciphertexts of the transactions in the block, if encrypted by clients
+	mempoolKeys map[[32]byte][32]byte // Maps h(tx) -> hash of its ciphertext, if encrypted by clients
+}
+
+func newBlockSources(n int, b []*utils.PreBlock) *blockSources {
+	slots := make([]int, n)
+	for _, pb := range b {
+		for node, v := range pb.Vec {
+			if v != nil && node < n {
+				slots[node]++
+			}
+		}
+	}
+	return &blockSources{
+		slots:       slots,
+		proposers:   make(map[[32]byte]int),
+		mempoolKeys: make(map[[32]byte][32]byte),
+	}
+}
+
+// add records that tx was proposed in the slot of node.
+func (s *blockSources) add(node int, tx []byte) {
+	h := sha256.Sum256(tx)
+	if _, ok := s.proposers[h]; !ok {
+		s.proposers[h] = node
+	}
+}
+
+// addCiphertext records the ciphertext of tx that was submitted by a client. If the transaction was
+// encrypted more than once, the first ciphertext is the one whose transaction stays in the block.
+func (s *blockSources) addCiphertext(tx, c []byte) {
+	s.ciphertexts = append(s.ciphertexts, c)
+	h := sha256.Sum256(tx)
+	if _, ok := s.mempoolKeys[h]; !ok {
+		s.mempoolKeys[h] = sha256.Sum256(c)
+	}
+}
+
+// mempoolKey returns the hash under which the transaction with hash h is kept in the mempool.
+func (s *blockSources) mempoolKey(h [32]byte) [32]byte {
+	if key, ok := s.mempoolKeys[h]; ok {
+		return key
+	}
+	return h
+}
+
+// RoundFairness shows whose transactions were included in the block of a round.
+type RoundFairness struct {
+	Round int
+	Path  string          // Protocol that agreed on the block: "bla" or "acs"
+	Slots []int           // Maps nodeId -> included pre-block slots of the node
+	Txs   []int           // Maps nodeId -> transactions of the node in the block
+	Wait  []time.Duration // Maps nodeId -> average time its transactions waited in the mempool of this node
+}
+
+// ProposerStats are the cumulative statistics of a proposer over all rounds this node finished.
+type ProposerStats struct {
+	SlotsBLA int           // Included slots of the node in rounds agreed on with BLA
+	SlotsACS int           // Included slots of the node in rounds agreed on with ACS
+	Txs      int           // Transactions of the node in blocks
+	AvgWait  time.Duration // Average time its transactions waited in the mempool of this node
+	Missed   int           // Consecutive rounds without an included slot of the node
+	Flagged  bool          // Set if the node was left out in the last censorRounds rounds
+}
+
+// fairness keeps the statistics of the proposers.
+type fairness struct {
+	rounds  map[int]*RoundFairness // Statistics of recent rounds
+	last    int                    // Last recorded round, -1 if none
+	stats   []ProposerStats        // Maps nodeId -> cumulative statistics
+	waited  []int                  // Maps nodeId -> transactions whose wait is known
+	waitSum []time.Duration        // Maps nodeId -> sum of the known waits
+	sync.Mutex
+}
+
+func newFairness(n int) *fairness {
+	return &fairness{
+		rounds:  make(map[int]*RoundFairness),
+		last:    -1,
+		stats:   make([]ProposerStats, n),
+		waited:  make([]int, n),
+		waitSum: make([]time.Duration, n),
+	}
+}
+
+// recordFairness records whose transactions are in the block of round r. It has to be called
+// before the transactions of the block are removed from the mempool.
+func (abc *ABC) recordFairness(r int, path string, block *utils.Block, src *blockSources) {
+	if src == nil {
+		// The block wasn't constructed from pre-blocks, e.g. after a timeout
+		return
+	}
+	n := abc.Cfg.n
+	rf := &RoundFairness{
+		Round: r,
+		Path:  path,
+		Slots: src.slots,
+		Txs:   make([]int, n),
+		Wait:  make([]time.Duration, n),
+	}
+	waited := make([]int, n)
+	for _, tx := range block.Txs {
+		h := sha256.Sum256(tx)
+		node, ok := src.proposers[h]
+		if !ok || node >= n {
+			continue
+		}
+		rf.Txs[node]++
+		if age, ok := abc.mempool.Age(src.mempoolKey(h)); ok {
+			rf.Wait[node] += age
+			waited[node]++
+		}
+	}
+
+	f := abc.fairness
+	f.Lock()
+	defer f.Unlock()
+	for node := 0; node < n; node++ {
+		st := &f.stats[node]
+		if path == "bla" {
+			st.SlotsBLA += rf.Slots[node]
+		} else {
+			st.SlotsACS += rf.Slots[node]
+		}
+		st.Txs += rf.Txs[node]
+		f.waited[node] += waited[node]
+		f.waitSum[node] += rf.Wait[node]
+		if waited[node] > 0 {
+			rf.Wait[node] /= time.Duration(waited[node])
+		}
+		if f.waited[node] > 0 {
+			st.AvgWait = f.waitSum[node] / time.Duration(f.waited[node])
+		}
+		if rf.Slots[node] > 0 {
+			st.Missed = 0
+			st.Flagged = false
+			continue
+		}
+		st.Missed++
+		if st.Missed >= censorRounds && !st.Flagged {
+			st.Flagged = true
+			log.Printf("Node %d round %d: slots of node %d were left out in the last %d rounds", abc.Cfg.NodeId, r, node, st.Missed)
+		}
+	}
+	f.rounds[r] = rf
+	delete(f.rounds, r-fairnessWindow)
+	if r > f.last {
+		f.last = r
+	}
+}
+
+// ProposerStats returns the cumulative statistics of every proposer, indexed by nodeId.
+func (abc *ABC) ProposerStats() []ProposerStats {
+	abc.fairness.Lock()
+	defer abc.fairness.Unlock()
+	ret := make([]ProposerStats, len(abc.fairness.stats))
+	copy(ret, abc.fairness.stats)
+	return ret
+}
+
+// RoundFairness returns the statistics of the proposers in round r, if the round is one of the
+// last fairnessWindow rounds this node finished.
+func (abc *ABC) RoundFairness(r int) (*RoundFairness, bool) {
+	abc.fairness.Lock()
+	defer abc.fairness.Unlock()
+	rf, ok := abc.fairness.rounds[r]
+	return rf, ok
+}
+
+// LastRoundFairness returns the statistics of the proposers in the last round this node finished.
+func (abc *ABC) LastRoundFairness() (*RoundFairness, bool) {
+	abc.fairness.Lock()
+	defer abc.fairness.Unlock()
+	rf, ok := abc.fairness.rounds[abc.fairness.last]
+	return rf, ok
+}
@@ -0,0 +1,79 @@
+package tardigrade
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+func TestRecordFairness(t *testing.T) {
+	n := 3
+	u := NewABC(&ABCConfig{n: n}, nil)
+	now := time.Now()
+	u.mempool.now = func() time.Time { return now }
+	u.mempool.Add([]byte("foo"))
+	now = now.Add(2 * time.Second)
+
+	// newRound returns a block with the transactions txs proposed by node proposers[i] and the
+	// included slots
+	newRound := func(slots []int, txs []string, proposers []int) (*utils.Block, *blockSources) {
+		src := &blockSources{
+			slots:     slots,
+			proposers: make(map[[32]byte]int),
+		}
+		block := &utils.Block{}
+		for i, tx := range txs {
+			block.Txs = append(block.Txs, []byte(tx))
+			src.add(proposers[i], []byte(tx))
+		}
+		return block, src
+	}
+
+	t.Run("Records slots, transactions and wait", func(t *testing.T) {
+		block, src := newRound([]int{1, 1, 0}, []string{"foo", "bar", "baz"}, []int{0, 1, 1})
+		u.recordFairness(0, "bla", block, src)
+		rf, ok := u.RoundFairness(0)
+		if !ok || rf.Path != "bla" || rf.Txs[0] != 1 || rf.Txs[1] != 2 || rf.Txs[2] != 0 {
+			t.Fatalf("Got unexpected round statistics %+v", rf)
+		}
+		if rf.Wait[0] != 2*time.Second || rf.Wait[1] != 0 {
+			t.Errorf("Expected wait of %s, got %s", 2*time.Second, rf.Wait[0])
+		}
+		stats := u.ProposerStats()
+		if stats[0].SlotsBLA != 1 || stats[1].Txs != 2 || stats[0].AvgWait != 2*time.Second || stats[2].Missed != 1 {
+			t.Errorf("Got unexpected statistics %+v", stats)
+		}
+	})
+
+	t.Run("Flags nodes that are left out", func(t *testing.T) {
+		for r := 1; r < censorRounds; r++ {
+			block, src := newRound([]int{2, 1, 0}, nil, nil)
+			u.recordFairness(r, "acs", block, src)
+		}
+		stats := u.ProposerStats()
+		if !stats[2].Flagged || stats[2].Missed != censorRounds || stats[0].Flagged || stats[0].SlotsACS != 2*(censorRounds-1) {
+			t.Errorf("Got unexpected statistics %+v", stats)
+		}
+		block, src := newRound([]int{1, 1, 1}, nil, nil)
+		u.recordFairness(censorRounds, "acs", block, src)
+		if stats := u.ProposerStats(); stats[2].Flagged || stats[2].Missed != 0 {
+			t.Errorf("Node 2 is still flagged after its slot was included")
+		}
+		if rf, ok := u.LastRoundFairness(); !ok || rf.Round != censorRounds {
+			t.Errorf("Got unexpected last round %+v", rf)
+		}
+	})
+
+	t.Run("Forgets rounds outside of the window", func(t *testing.T) {
+		block, src := newRound([]int{1, 1, 1}, nil, nil)
+		u.recordFairness(fairnessWindow, "acs", block, src)
+		if _, ok := u.RoundFairness(0); ok {
+			t.Errorf("Round 0 wasn't pruned")
+		}
+		u.recordFairness(fairnessWindow+1, "acs", &utils.Block{}, nil)
+		if _, ok := u.RoundFairness(fairnessWindow + 1); ok {
+			t.Errorf("Round without pre-blocks was recorded")
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package tardigrade
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Every encrypted transaction starts with this marker. It isn't zero, so a framed transaction keeps
+// its leading zeros when it is converted to an integer for the encryption.
+const frameMarker = 0x01
+
+// Default for the minimum size of a transaction in bytes
+const defaultMinTxSize = 1
+
+// ErrTxSize is returned when a transaction is smaller than the minimum or larger than the maximum
+// transaction size.
+var ErrTxSize = errors.New("transaction size out of bounds")
+
+// encodeFrame returns the frame of a transaction: the marker, the length of the transaction as
+// uvarint and the transaction.
+func encodeFrame(tx []byte) []byte {
+	var l [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(l[:], uint64(len(tx)))
+	frame := make([]byte, 0, 1+n+len(tx))
+	frame = append(frame, frameMarker)
+	frame = append(frame, l[:n]...)
+	return append(frame, tx...)
+}
+
+// decodeFrame returns the transaction in a frame. It returns an error if the frame is malformed or
+// if its length doesn't match the transaction.
+func decodeFrame(frame []byte) ([]byte, error) {
+	if len(frame) == 0 || frame[0] != frameMarker {
+		return nil, errors.New("missing frame marker")
+	}
+	l, n := binary.Uvarint(frame[1:])
+	if n <= 0 {
+		return nil, errors.New("invalid frame length")
+	}
+	tx := frame[1+n:]
+	if uint64(len(tx)) != l {
+		return nil, fmt.Errorf("frame announces %d bytes, but contains %d", l, len(tx))
+	}
+	return tx, nil
+}
+
+// splitFrames returns the transactions of concatenated frames. It returns the transactions before
+// the first malformed frame and an error if there is one.
+func splitFrames(frames []byte) ([][]byte, error) {
+	txs := make([][]byte, 0)
+	for len(frames) > 0 {
+		if frames[0] != frameMarker {
+			return txs, errors.New("missing frame marker")
+		}
+		l, n := binary.Uvarint(frames[1:])
+		if n <= 0 || l > uint64(len(frames)-1-n) {
+			return txs, errors.New("invalid frame length")
+		}
+		end := 1 + n + int(l)
+		txs = append(txs, frames[1+n:end])
+		frames = frames[end:]
+	}
+	return txs, nil
+}
+
+// FrameSize returns the size of the frame of a transaction of size bytes. The frame has to be
+// smaller than the public encryption key.
+func FrameSize(size int) int {
+	var l [binary.MaxVarintLen64]byte
+	return 1 + binary.PutUvarint(l[:], uint64(size)) + size
+}
+
+// checkTxSize returns an error if tx is smaller than the minimum or larger than the maximum
+// transaction size or if its frame doesn't fit into a ciphertext.
+func (abc *ABC) checkTxSize(tx []byte) error {
+	if len(tx) < abc.Cfg.minTxSize || (abc.Cfg.maxTxSize > 0 && len(tx) > abc.Cfg.maxTxSize) {
+		return fmt.Errorf("%w: transaction has %d bytes, allowed are %d to %d", ErrTxSize, len(tx), abc.Cfg.minTxSize, abc.Cfg.maxTxSize)
+	}
+	if abc.tcs != nil && abc.tcs.encPk.N != nil && 8*FrameSize(len(tx)) >= abc.tcs.encPk.N.BitLen() {
+		return fmt.Errorf("%w: transaction of %d bytes doesn't fit into the encryption key", ErrTxSize, len(tx))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package tardigrade
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestFrame(t *testing.T) {
+	t.Run("Keeps leading zeros and the length", func(t *testing.T) {
+		for _, tx := range [][]byte{{}, {0}, {0, 0, 1}, bytes.Repeat([]byte{7}, 300)} {
+			frame := encodeFrame(tx)
+			if len(frame) != FrameSize(len(tx)) {
+				t.Errorf("Expected frame of %d bytes, got %d", FrameSize(len(tx)), len(frame))
+			}
+			// The frame is encrypted as an integer
+			decoded, err := decodeFrame(new(big.Int).SetBytes(frame).Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded, tx) {
+				t.Errorf("Expected %x, got %x", tx, decoded)
+			}
+		}
+	})
+
+	t.Run("Rejects malformed frames", func(t *testing.T) {
+		frame := encodeFrame([]byte("foo"))
+		for _, f := range [][]byte{nil, frame[1:], frame[:len(frame)-1], append(frame, 0), {frameMarker, 0x80}} {
+			if _, err := decodeFrame(f); err == nil {
+				t.Errorf("Malformed frame %x was accepted", f)
+			}
+		}
+	})
+
+	t.Run("Checks the transaction size", func(t *testing.T) {
+		cfg := &ABCConfig{n: 1}
+		cfg.SetTxSizeLimits(2, 4)
+		u := NewABC(cfg, nil)
+		for _, tx := range []string{"a", "abcde"} {
+			if err := u.SubmitTx([]byte(tx)); !errors.Is(err, ErrTxSize) {
+				t.Errorf("Expected ErrTxSize for %q, got %v", tx, err)
+			}
+		}
+		for _, tx := range []string{"ab", "abcd"} {
+			if err := u.SubmitTx([]byte(tx)); err != nil {
+				t.Errorf("Transaction %q was rejected: %s", tx, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,265 @@
+package tardigrade
+
+import (
+	"crypto/sha256"
+	"math/rand"
+	"sync"
+	"time"
+
+	utils "github.com/sochsenreither/tardigrade/utils"
+)
+
+const (
+	defaultGossipRate   = 1000                  // Transactions per second a peer may announce, request or receive
+	gossipInterval      = 50 * time.Millisecond // Time between two announcements
+	gossipRequestExpiry = 1 * time.Second       // Time after which a hash can be requested again
+	maxGossipBatch      = 500                   // Maximum number of hashes or transactions per message
+)
+
+// TxAnnounce announces the hashes of transactions that the sender has in its mempool.
+type TxAnnounce struct {
+	Sender int
+	Hashes [][32]byte
+}
+
+// TxRequest requests announced transactions from the receiver.
+type TxRequest struct {
+	Sender int
+	Hashes [][32]byte
+}
+
+// TxResponse contains requested transactions.
+type TxResponse struct {
+	Sender int
+	Txs    [][]byte
+}
+
+// gossip is the state of the transaction gossip. A node announces the hashes of the transactions it
+// adds to its mempool to a random subset of its peers. Peers request the transactions they don't
+// know yet and announce them to their own peers after adding them to their mempool.
+type gossip struct {
+	announce  [][32]byte             // Hashes of new transactions that weren't announced yet
+	requested map[[32]byte]time.Time // Maps h(tx) -> time it was requested
+	limiter   *rateLimiter           // Limits the transactions handled per peer
+	sync.Mutex
+}
+
+func newGossip(rate int) *gossip {
+	return &gossip{
+		announce:  make([][32]byte, 0),
+		requested: make(map[[32]byte]time.Time),
+		limiter:   newRateLimiter(rate),
+	}
+}
+
+// runGossip announces new transactions every gossipInterval and handles the gossip of other nodes.
+func (abc *ABC) runGossip() {
+	go abc.serveGossip()
+	ticker := time.NewTicker(gossipInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		abc.announceTxs()
+	}
+}
+
+// queueAnnouncement queues the hash of a transaction that was added to the mempool for the next
+// announcement.
+func (abc *ABC) queueAnnouncement(h [32]byte) {
+	if abc.gossip == nil {
+		return
+	}
+	abc.gossip.Lock()
+	defer abc.gossip.Unlock()
+	abc.gossip.announce = append(abc.gossip.announce, h)
+}
+
+// announceTxs announces the queued hashes to gossipFanout random peers. Hashes that don't fit into
+// a message are announced in the next interval.
+func (abc *ABC) announceTxs() {
+	abc.gossip.Lock()
+	hashes := abc.gossip.announce
+	if len(hashes) > maxGossipBatch {
+		hashes = hashes[:maxGossipBatch]
+	}
+	abc.gossip.announce = abc.gossip.announce[len(hashes):]
+	abc.gossip.Unlock()
+	if len(hashes) == 0 {
+		return
+	}
+	mes := &utils.Message{
+		Sender: abc.Cfg.NodeId,
+		Payload: &TxAnnounce{
+			Sender: abc.Cfg.NodeId,
+			Hashes: hashes,
+		},
+	}
+	for _, peer := range abc.gossipPeers() {
+		abc.Cfg.handlerFuncs.MEMmulticast(mes, peer)
+	}
+}
+
+// gossipPeers returns gossipFanout random nodes other than this node.
+func (abc *ABC) gossipPeers() []int {
+	peers := make([]int, 0, abc.Cfg.n-1)
+	for i := 0; i < abc.Cfg.n; i++ {
+		if i != abc.Cfg.NodeId {
+			peers = append(peers, i)
+		}
+	}
+	rand.Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+	if abc.Cfg.gossipFanout < len(peers) {
+		peers = peers[:abc.Cfg.gossipFanout]
+	}
+	return peers
+}
+
+// serveGossip handles the gossip messages of other nodes.
+func (abc *ABC) serveGossip() {
+	for {
+		msg := abc.Cfg.handlerFuncs.MEMreceive()
+		switch m := msg.Payload.(type) {
+		case *TxAnnounce:
+			if abc.validPeer(m.Sender) {
+				abc.handleTxAnnounce(m)
+			}
+		case *TxRequest:
+			if abc.validPeer(m.Sender) {
+				abc.handleTxRequest(m)
+			}
+		case *TxResponse:
+			if abc.validPeer(m.Sender) {
+				abc.handleTxResponse(m)
+			}
+		}
+	}
+}
+
+func (abc *ABC) validPeer(sender int) bool {
+	return sender >= 0 && sender < abc.Cfg.n && sender != abc.Cfg.NodeId
+}
+
+// handleTxAnnounce requests the announced transactions that are neither in the mempool nor in a
+// recent block and weren't requested from another peer yet.
+func (abc *ABC) handleTxAnnounce(m *TxAnnounce) {
+	hashes := m.Hashes
+	if len(hashes) > maxGossipBatch {
+		hashes = hashes[:maxGossipBatch]
+	}
+	hashes = hashes[:abc.gossip.limiter.allow(m.Sender, len(hashes))]
+	missing := make([][32]byte, 0)
+	now := time.Now()
+	abc.gossip.Lock()
+	for h, t := range abc.gossip.requested {
+		if now.Sub(t) >= gossipRequestExpiry {
+			delete(abc.gossip.requested, h)
+		}
+	}
+	for _, h := range hashes {
+		if _, ok := abc.gossip.requested[h]; ok {
+			continue
+		}
+		if abc.mempool.Has(h) || abc.ledger.has(h) {
+			continue
+		}
+		abc.gossip.requested[h] = now
+		missing = append(missing, h)
+	}
+	abc.gossip.Unlock()
+	if len(missing) == 0 {
+		return
+	}
+	mes := &utils.Message{
+		Sender: abc.Cfg.NodeId,
+		Payload: &TxRequest{
+			Sender: abc.Cfg.NodeId,
+			Hashes: missing,
+		},
+	}
+	abc.Cfg.handlerFuncs.MEMmulticast(mes, m.Sender)
+}
+
+// handleTxRequest sends the requested transactions that are in the mempool.
+func (abc *ABC) handleTxRequest(m *TxRequest) {
+	hashes := m.Hashes
+	if len(hashes) > maxGossipBatch {
+		hashes = hashes[:maxGossipBatch]
+	}
+	hashes = hashes[:abc.gossip.limiter.allow(m.Sender, len(hashes))]
+	txs := make([][]byte, 0, len(hashes))
+	for _, h := range hashes {
+		if tx, ok := abc.mempool.Get(h); ok {
+			txs = append(txs, tx)
+		}
+	}
+	if len(txs) == 0 {
+		return
+	}
+	mes := &utils.Message{
+		Sender: abc.Cfg.NodeId,
+		Payload: &TxResponse{
+			Sender: abc.Cfg.NodeId,
+			Txs:    txs,
+		},
+	}
+	abc.Cfg.handlerFuncs.MEMmulticast(mes, m.Sender)
+}
+
+// handleTxResponse adds the requested transactions to the mempool. Transactions that weren't
+// requested are dropped.
+func (abc *ABC) handleTxResponse(m *TxResponse) {
+	txs := m.Txs
+	if len(txs) > maxGossipBatch {
+		txs = txs[:maxGossipBatch]
+	}
+	for _, tx := range txs {
+		h := sha256.Sum256(tx)
+		abc.gossip.Lock()
+		_, ok := abc.gossip.requested[h]
+		delete(abc.gossip.requested, h)
+		abc.gossip.Unlock()
+		if !ok {
+			continue
+		}
+		abc.addTx(tx)
+	}
+}
+
+// rateLimiter is a token bucket per peer. Every peer gets rate tokens per second and can save up
+// to rate tokens.
+type rateLimiter struct {
+	rate   float64
+	tokens map[int]float64   // Maps nodeId -> available tokens
+	last   map[int]time.Time // Maps nodeId -> time the tokens were last updated
+	sync.Mutex
+}
+
+func newRateLimiter(rate int) *rateLimiter {
+	return &rateLimiter{
+		rate:   float64(rate),
+		tokens: make(map[int]float64),
+		last:   make(map[int]time.Time),
+	}
+}
+
+// allow takes up to n tokens of a peer and returns the number of tokens taken.
+func (l *rateLimiter) allow(peer, n int) int {
+	l.Lock()
+	defer l.Unlock()
+	now := time.Now()
+	tokens := l.rate
+	if last, ok := l.last[peer]; ok {
+		tokens = l.tokens[peer] + now.Sub(last).Seconds()*l.rate
+		if tokens > l.rate {
+			tokens = l.rate
+		}
+	}
+	taken := n
+	if float64(taken) > tokens {
+		taken = int(tokens)
+	}
+	l.tokens[peer] = tokens - float64(taken)
+	l.last[peer] = now
+	return taken
+}
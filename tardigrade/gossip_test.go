@@ -0,0 +1,69 @@
+package tardigrade
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+func TestGossip(t *testing.T) {
+	n := 4
+	nodeChans := make(map[int]chan *utils.HandlerMessage)
+	for i := 0; i < n; i++ {
+		nodeChans[i] = make(chan *utils.HandlerMessage, 9999)
+	}
+	abcs := make([]*ABC, n)
+	for i := 0; i < n; i++ {
+		handler := utils.NewLocalHandler(nodeChans, nil, i, n, 1)
+		cfg := NewABCConfig(n, i, 1, 1, 1, 1, 10, 0, 8, map[int]bool{0: true}, nil, handler.Funcs)
+		cfg.SetGossip(n-1, 0)
+		abcs[i] = NewABC(cfg, nil)
+		go abcs[i].runGossip()
+	}
+
+	t.Run("Transactions reach all nodes", func(t *testing.T) {
+		txs := [][]byte{[]byte("foo"), []byte("bar"), []byte("baz")}
+		for _, tx := range txs {
+			if err := abcs[0].SubmitTx(tx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for i := 1; i < n; i++ {
+			for abcs[i].PendingTxs() < len(txs) && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			for _, tx := range txs {
+				if !abcs[i].mempool.Has(sha256.Sum256(tx)) {
+					t.Errorf("Transaction %q didn't reach node %d", tx, i)
+				}
+			}
+		}
+	})
+
+	t.Run("Drops transactions that weren't requested", func(t *testing.T) {
+		abcs[1].handleTxResponse(&TxResponse{Sender: 2, Txs: [][]byte{[]byte("unsolicited")}})
+		if abcs[1].mempool.Has(sha256.Sum256([]byte("unsolicited"))) {
+			t.Errorf("Unsolicited transaction was added to the mempool")
+		}
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(10)
+	if taken := l.allow(1, 8); taken != 8 {
+		t.Errorf("Expected %d tokens, got %d", 8, taken)
+	}
+	if taken := l.allow(1, 8); taken > 3 {
+		t.Errorf("Expected at most %d tokens, got %d", 3, taken)
+	}
+	if taken := l.allow(2, 8); taken != 8 {
+		t.Errorf("Peers share their tokens, got %d tokens", taken)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if taken := l.allow(1, 8); taken < 1 || taken > 3 {
+		t.Errorf("Expected tokens to refill, got %d", taken)
+	}
+}
@@ -0,0 +1,223 @@
+package tardigrade
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Defaults for the limits of the mempool
+const (
+	defaultMempoolCapacity = 100_000
+	defaultMempoolTTL      = 10 * time.Minute
+)
+
+// ErrDuplicateTx is returned when a transaction is added that is already in the mempool.
+var ErrDuplicateTx = errors.New("transaction is already in the mempool")
+
+// Reasons why a transaction is dropped from the mempool without being included in a block
+var (
+	ErrTxEvicted = errors.New("transaction was evicted from the full mempool")
+	ErrTxExpired = errors.New("transaction expired in the mempool")
+)
+
+// Mempool holds the transactions that weren't included in a block yet. Transactions are indexed by
+// their hash and kept in the order they were added. When the mempool is full the oldest transaction
+// is evicted, transactions that are older than the TTL expire. It is safe for concurrent use.
+type Mempool struct {
+	txs      map[[32]byte]*list.Element // Maps h(tx) -> element in order
+	order    *list.List                 // Entries ordered from oldest to newest
+	capacity int                        // Maximum number of transactions, 0 for no limit
+	ttl      time.Duration              // Maximum time a transaction is kept, 0 for no limit
+	now      func() time.Time           // Clock, replaceable in tests
+	onDrop   func(h [32]byte, reason error)
+	sync.Mutex
+}
+
+type mempoolEntry struct {
+	tx    []byte
+	hash  [32]byte
+	added time.Time
+}
+
+func NewMempool(capacity int, ttl time.Duration) *Mempool {
+	return &Mempool{
+		txs:      make(map[[32]byte]*list.Element),
+		order:    list.New(),
+		capacity: capacity,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// SetDropHandler sets a function that is called with the hash of every transaction that is evicted
+// or expires. It is called while the mempool is locked and must not use the mempool.
+func (mp *Mempool) SetDropHandler(f func(h [32]byte, reason error)) {
+	mp.Lock()
+	defer mp.Unlock()
+	mp.onDrop = f
+}
+
+// Add adds a transaction. It returns ErrDuplicateTx if the transaction is already in the mempool and
+// the number of transactions that were evicted to make room for it.
+func (mp *Mempool) Add(tx []byte) (int, error) {
+	h := sha256.Sum256(tx)
+	mp.Lock()
+	defer mp.Unlock()
+	mp.expire()
+	if _, ok := mp.txs[h]; ok {
+		return 0, ErrDuplicateTx
+	}
+	evicted := 0
+	for mp.capacity > 0 && mp.order.Len() >= mp.capacity {
+		mp.drop(mp.order.Front(), ErrTxEvicted)
+		evicted++
+	}
+	mp.txs[h] = mp.order.PushBack(&mempoolEntry{
+		tx:    tx,
+		hash:  h,
+		added: mp.now(),
+	})
+	return evicted, nil
+}
+
+// Has returns whether the transaction with hash h is in the mempool.
+func (mp *Mempool) Has(h [32]byte) bool {
+	mp.Lock()
+	defer mp.Unlock()
+	mp.expire()
+	_, ok := mp.txs[h]
+	return ok
+}
+
+// Get returns the transaction with hash h and false if it isn't in the mempool.
+func (mp *Mempool) Get(h [32]byte) ([]byte, bool) {
+	mp.Lock()
+	defer mp.Unlock()
+	mp.expire()
+	e, ok := mp.txs[h]
+	if !ok {
+		return nil, false
+	}
+	return e.Value.(*mempoolEntry).tx, true
+}
+
+// Age returns the time the transaction with hash h has been in the mempool.
+func (mp *Mempool) Age(h [32]byte) (time.Duration, bool) {
+	mp.Lock()
+	defer mp.Unlock()
+	e, ok := mp.txs[h]
+	if !ok {
+		return 0, false
+	}
+	return mp.now().Sub(e.Value.(*mempoolEntry).added), true
+}
+
+// Remove removes the given transactions. It returns the number of transactions that were in the
+// mempool and the sum of the time they spent in it.
+func (mp *Mempool) Remove(txs [][]byte) (int, time.Duration) {
+	mp.Lock()
+	defer mp.Unlock()
+	removed := 0
+	latency := time.Duration(0)
+	now := mp.now()
+	for _, tx := range txs {
+		e, ok := mp.txs[sha256.Sum256(tx)]
+		if !ok {
+			continue
+		}
+		latency += now.Sub(e.Value.(*mempoolEntry).added)
+		removed++
+		mp.remove(e)
+	}
+	return removed, latency
+}
+
+// Sample chooses l transactions uniformly at random (without replacement) from the m oldest
+// transactions. If the mempool holds less than l transactions all of them are returned.
+func (mp *Mempool) Sample(l, m int) [][]byte {
+	return mp.SamplePreferred(l, m, nil)
+}
+
+// SamplePreferred chooses l transactions like Sample, but considers the m oldest transactions for
+// which prefer returns true first. Only if there are less than l of them the remaining transactions
+// are chosen from the m oldest other transactions. A nil prefer treats all transactions the same.
+func (mp *Mempool) SamplePreferred(l, m int, prefer func(h [32]byte) bool) [][]byte {
+	mp.Lock()
+	defer mp.Unlock()
+	mp.expire()
+	preferred := make([][]byte, 0)
+	others := make([][]byte, 0)
+	for e := mp.order.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*mempoolEntry)
+		if prefer == nil || prefer(entry.hash) {
+			if len(preferred) < m {
+				preferred = append(preferred, entry.tx)
+			}
+		} else if len(others) < m {
+			others = append(others, entry.tx)
+		}
+		if len(preferred) == m && (prefer == nil || len(others) == m) {
+			break
+		}
+	}
+	result := sample(preferred, l)
+	return append(result, sample(others, l-len(result))...)
+}
+
+// sample chooses l values uniformly at random (without replacement) from candidates. The order of
+// candidates is changed. If there are less than l candidates all of them are returned.
+func sample(candidates [][]byte, l int) [][]byte {
+	if l > len(candidates) {
+		l = len(candidates)
+	}
+	if l <= 0 {
+		return [][]byte{}
+	}
+	// Partial Fisher-Yates shuffle of the first l candidates
+	for i := 0; i < l; i++ {
+		j := i + rand.Intn(len(candidates)-i)
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+	return candidates[:l]
+}
+
+// Len returns the number of transactions in the mempool.
+func (mp *Mempool) Len() int {
+	mp.Lock()
+	defer mp.Unlock()
+	mp.expire()
+	return mp.order.Len()
+}
+
+// expire removes all transactions that are older than the TTL. Since transactions are ordered by
+// the time they were added only the front of the list has to be checked.
+func (mp *Mempool) expire() {
+	if mp.ttl <= 0 {
+		return
+	}
+	now := mp.now()
+	for e := mp.order.Front(); e != nil; e = mp.order.Front() {
+		if now.Sub(e.Value.(*mempoolEntry).added) < mp.ttl {
+			return
+		}
+		mp.drop(e, ErrTxExpired)
+	}
+}
+
+// drop removes a transaction that wasn't included in a block and reports it to the drop handler.
+func (mp *Mempool) drop(e *list.Element, reason error) {
+	h := e.Value.(*mempoolEntry).hash
+	mp.remove(e)
+	if mp.onDrop != nil {
+		mp.onDrop(h, reason)
+	}
+}
+
+func (mp *Mempool) remove(e *list.Element) {
+	entry := mp.order.Remove(e).(*mempoolEntry)
+	delete(mp.txs, entry.hash)
+}
@@ -0,0 +1,165 @@
+package tardigrade
+
+import (
+	"crypto/sha256"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMempool(t *testing.T) {
+	t.Run("Drops duplicates", func(t *testing.T) {
+		mp := NewMempool(0, 0)
+		if _, err := mp.Add([]byte("foo")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mp.Add([]byte("foo")); err != ErrDuplicateTx {
+			t.Errorf("Expected ErrDuplicateTx, got %v", err)
+		}
+		if mp.Len() != 1 {
+			t.Errorf("Expected %d transactions, got %d", 1, mp.Len())
+		}
+	})
+
+	t.Run("Evicts the oldest transaction when full", func(t *testing.T) {
+		mp := NewMempool(3, 0)
+		for i := 0; i < 4; i++ {
+			evicted, err := mp.Add([]byte(strconv.Itoa(i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := i / 3; evicted != expected {
+				t.Errorf("Expected %d evicted transactions, got %d", expected, evicted)
+			}
+		}
+		if mp.Len() != 3 || mp.Has(sha256.Sum256([]byte("0"))) || !mp.Has(sha256.Sum256([]byte("3"))) {
+			t.Errorf("Oldest transaction wasn't evicted")
+		}
+	})
+
+	t.Run("Expires transactions after the TTL", func(t *testing.T) {
+		now := time.Now()
+		mp := NewMempool(0, time.Minute)
+		mp.now = func() time.Time { return now }
+		mp.Add([]byte("foo"))
+		now = now.Add(30 * time.Second)
+		mp.Add([]byte("bar"))
+		now = now.Add(30 * time.Second)
+		if mp.Len() != 1 || !mp.Has(sha256.Sum256([]byte("bar"))) {
+			t.Errorf("Expected only the newer transaction to remain")
+		}
+		// An expired transaction can be added again
+		if _, err := mp.Add([]byte("foo")); err != nil {
+			t.Errorf("Unable to add expired transaction again: %s", err)
+		}
+	})
+
+	t.Run("Reports evicted and expired transactions", func(t *testing.T) {
+		now := time.Now()
+		mp := NewMempool(2, time.Minute)
+		mp.now = func() time.Time { return now }
+		dropped := make(map[[32]byte]error)
+		mp.SetDropHandler(func(h [32]byte, reason error) {
+			dropped[h] = reason
+		})
+		mp.Add([]byte("foo"))
+		mp.Add([]byte("bar"))
+		mp.Add([]byte("baz"))
+		now = now.Add(time.Minute)
+		mp.Remove([][]byte{[]byte("baz")})
+		mp.Len()
+		if len(dropped) != 2 || dropped[sha256.Sum256([]byte("foo"))] != ErrTxEvicted || dropped[sha256.Sum256([]byte("bar"))] != ErrTxExpired {
+			t.Errorf("Got unexpected dropped transactions %v", dropped)
+		}
+	})
+
+	t.Run("Removes committed transactions", func(t *testing.T) {
+		now := time.Now()
+		mp := NewMempool(0, 0)
+		mp.now = func() time.Time { return now }
+		mp.Add([]byte("foo"))
+		mp.Add([]byte("bar"))
+		now = now.Add(time.Second)
+		removed, latency := mp.Remove([][]byte{[]byte("foo"), []byte("baz"), []byte("foo")})
+		if removed != 1 || latency != time.Second {
+			t.Errorf("Expected to remove %d transaction with latency %s, got %d with %s", 1, time.Second, removed, latency)
+		}
+		if mp.Len() != 1 || !mp.Has(sha256.Sum256([]byte("bar"))) {
+			t.Errorf("Got unexpected transactions after removal")
+		}
+	})
+
+	t.Run("Samples distinct transactions from the oldest ones", func(t *testing.T) {
+		mp := NewMempool(0, 0)
+		for i := 0; i < 10; i++ {
+			mp.Add([]byte(strconv.Itoa(i)))
+		}
+		for j := 0; j < 100; j++ {
+			txs := mp.Sample(3, 5)
+			if len(txs) != 3 {
+				t.Fatalf("Expected %d transactions, got %d", 3, len(txs))
+			}
+			seen := make(map[string]bool)
+			for _, tx := range txs {
+				i, _ := strconv.Atoi(string(tx))
+				if i >= 5 || seen[string(tx)] {
+					t.Fatalf("Got unexpected sample %q", txs)
+				}
+				seen[string(tx)] = true
+			}
+		}
+	})
+
+	t.Run("Samples what exists when short of transactions", func(t *testing.T) {
+		mp := NewMempool(0, 0)
+		if txs := mp.Sample(4, 16); len(txs) != 0 {
+			t.Errorf("Expected an empty sample, got %q", txs)
+		}
+		mp.Add([]byte("foo"))
+		mp.Add([]byte("bar"))
+		if txs := mp.Sample(4, 16); len(txs) != 2 {
+			t.Errorf("Expected %d transactions, got %d", 2, len(txs))
+		}
+	})
+}
+
+func TestProposeByHash(t *testing.T) {
+	n := 4
+	mempool := NewMempool(0, 0)
+	for i := 0; i < 100; i++ {
+		mempool.Add([]byte(strconv.Itoa(i)))
+	}
+	cfg := &ABCConfig{n: n, NodeId: 1}
+	cfg.SetProposalStrategy(ProposeByHash)
+	u := &ABC{Cfg: cfg, mempool: mempool}
+
+	t.Run("Proposes disjoint transactions of the own partition", func(t *testing.T) {
+		v, w := u.proposeBatches(n, n, 100)
+		if len(v) != n || len(w) != n {
+			t.Fatalf("Expected %d transactions per batch, got %d and %d", n, len(v), len(w))
+		}
+		seen := make(map[string]bool)
+		for _, tx := range append(v, w...) {
+			if seen[string(tx)] {
+				t.Errorf("Transaction %q is proposed twice", tx)
+			}
+			seen[string(tx)] = true
+			if p := partition(sha256.Sum256(tx), n); p != cfg.NodeId {
+				t.Errorf("Transaction %q of partition %d was proposed", tx, p)
+			}
+		}
+	})
+
+	t.Run("Falls back to other transactions", func(t *testing.T) {
+		own := 0
+		for i := 0; i < 100; i++ {
+			if partition(sha256.Sum256([]byte(strconv.Itoa(i))), n) == cfg.NodeId {
+				own++
+			}
+		}
+		txs := u.proposeTxs(own+5, 100)
+		if len(txs) != own+5 {
+			t.Errorf("Expected %d transactions, got %d", own+5, len(txs))
+		}
+	})
+}
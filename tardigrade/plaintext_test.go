@@ -0,0 +1,96 @@
+package tardigrade
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+func TestPlaintextMode(t *testing.T) {
+	t.Run("Constructs blocks without decryption", func(t *testing.T) {
+		cfg := &ABCConfig{n: 2}
+		cfg.SetPlaintextMode(true)
+		cfg.SetBatchLimits(3, 0, 0)
+		u := NewABC(cfg, nil)
+		u.SetExternalValidity(func(tx []byte) error {
+			if string(tx) == "bad" {
+				return errors.New("rejected")
+			}
+			return nil
+		})
+		frame := func(tx string) []byte {
+			f, err := u.encryptTx([]byte(tx))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return f
+		}
+
+		large := utils.NewPreBlock(2)
+		large.Size = "large"
+		large.AddMessage(0, &utils.PreBlockMessage{Message: bytes.Join([][]byte{frame("foo"), frame("bad"), frame("bar")}, nil)})
+		large.AddMessage(1, &utils.PreBlockMessage{Message: append(frame("baz"), frameMarker, 9)})
+		block, _ := u.constructBlock(0, []*utils.PreBlock{large}, nil, nil)
+		if got := string(bytes.Join(block.Txs, []byte(","))); got != "foo,bar,baz" || block.TxsCount != 3 {
+			t.Errorf("Got unexpected transactions %q", got)
+		}
+
+		small := make([]*utils.PreBlock, 2)
+		for i := range small {
+			small[i] = utils.NewPreBlock(2)
+			small[i].AddMessage(0, &utils.PreBlockMessage{Message: frame("qux")})
+			small[i].AddMessage(1, &utils.PreBlockMessage{Message: []byte("malformed")})
+		}
+		block, _ = u.constructBlock(0, small, nil, nil)
+		if got := string(bytes.Join(block.Txs, []byte(","))); got != "qux,qux" {
+			t.Errorf("Got unexpected transactions %q", got)
+		}
+	})
+
+	t.Run("Runs rounds without encryption", func(t *testing.T) {
+		n := 4
+		maxRounds := 2
+		abcs := setupSimulation(setupConfig(n, 0, 0, 2, 1, 0, 10, 8))
+		cfgs := make(map[int]*utils.RoundConfig)
+		for i := 0; i < maxRounds; i++ {
+			cfgs[i] = &utils.RoundConfig{Crashed: map[int]bool{}}
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			abcs[i].Cfg.SetPlaintextMode(true)
+			wg.Add(1)
+			go func(node *ABC) {
+				defer wg.Done()
+				node.Run(maxRounds, cfgs, time.Now())
+			}(abcs[i])
+		}
+		wg.Wait()
+		for r := 0; r < maxRounds; r++ {
+			expected := abcs[0].GetBlocks()[r].Hash()
+			if abcs[0].GetBlocks()[r].TxsCount == 0 {
+				t.Errorf("Block of round %d is empty", r)
+			}
+			for i := 1; i < n; i++ {
+				if abcs[i].GetBlocks()[r].Hash() != expected {
+					t.Errorf("Block of node %d in round %d differs from the block of node 0", i, r)
+				}
+			}
+		}
+	})
+}
+
+func TestSplitFrames(t *testing.T) {
+	frames := bytes.Join([][]byte{encodeFrame([]byte("foo")), encodeFrame(nil), encodeFrame([]byte("bar"))}, nil)
+	txs, err := splitFrames(frames)
+	if err != nil || len(txs) != 3 || string(txs[0]) != "foo" || len(txs[1]) != 0 || string(txs[2]) != "bar" {
+		t.Errorf("Got unexpected transactions %q, %v", txs, err)
+	}
+	txs, err = splitFrames(append(frames, frameMarker, 4, 'x'))
+	if err == nil || len(txs) != 3 {
+		t.Errorf("Expected the transactions before the malformed frame and an error, got %q, %v", txs, err)
+	}
+}
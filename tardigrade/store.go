@@ -0,0 +1,314 @@
+package tardigrade
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	utils "github.com/sochsenreither/tardigrade/utils"
+)
+
+// ErrRoundFinalized is returned when a different block is stored for an already finalized round.
+var ErrRoundFinalized = errors.New("round already finalized with a different block")
+
+// Store persists finalized blocks. A block is stored before its round is reported as finished, so
+// the stored blocks are all the node needs to recover. Implementations must be safe for concurrent
+// use.
+type Store interface {
+	// PutBlock stores the block of round r. Storing the same block twice is a no-op, storing a
+	// different block for a finalized round returns ErrRoundFinalized.
+	PutBlock(r int, block *utils.Block) error
+	// Block returns the stored block of round r and false if there is none.
+	Block(r int) (*utils.Block, bool, error)
+	// Blocks returns all stored blocks.
+	Blocks() (map[int]*utils.Block, error)
+	// Close releases the resources of the store.
+	Close() error
+}
+
+// blockRecord is the on-disk format of a finalized block.
+type blockRecord struct {
+	Round int
+	Block *utils.Block
+}
+
+// sameBlock returns whether two blocks have the same header and contain the same transactions.
+func sameBlock(a, b *utils.Block) bool {
+	if len(a.Txs) != len(b.Txs) || a.TxsCount != b.TxsCount || a.Hash() != b.Hash() {
+		return false
+	}
+	for i := range a.Txs {
+		if !bytes.Equal(a.Txs[i], b.Txs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// MemoryStore keeps blocks in memory. Nothing survives a restart.
+type MemoryStore struct {
+	blocks map[int]*utils.Block
+	sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		blocks: make(map[int]*utils.Block),
+	}
+}
+
+func (s *MemoryStore) PutBlock(r int, block *utils.Block) error {
+	s.Lock()
+	defer s.Unlock()
+	if prev, ok := s.blocks[r]; ok {
+		if sameBlock(prev, block) {
+			return nil
+		}
+		return ErrRoundFinalized
+	}
+	s.blocks[r] = block
+	return nil
+}
+
+func (s *MemoryStore) Block(r int) (*utils.Block, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	block, ok := s.blocks[r]
+	return block, ok, nil
+}
+
+func (s *MemoryStore) Blocks() (map[int]*utils.Block, error) {
+	s.Lock()
+	defer s.Unlock()
+	ret := make(map[int]*utils.Block, len(s.blocks))
+	for r, block := range s.blocks {
+		ret[r] = block
+	}
+	return ret, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// FileStore keeps blocks in an append-only file in a directory. Every record is prefixed with its
+// length and checksum and synced to disk before a write returns. A record that was only partially
+// written when the process crashed is cut off when the store is opened, a corrupted record in front
+// of other records is reported as error.
+type FileStore struct {
+	blockFile *os.File
+	blocks    map[int]*utils.Block // Cache of the blocks on disk
+	sync.Mutex
+}
+
+const (
+	recordHeaderSize = 8       // Length and crc32 checksum of the payload
+	maxRecordSize    = 1 << 30 // Upper bound for the payload of a record
+)
+
+// NewFileStore opens the store in dir. The directory is created if it doesn't exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	blockFile, err := openLog(filepath.Join(dir, "blocks.log"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open blocks: %w", err)
+	}
+	s := &FileStore{
+		blockFile: blockFile,
+		blocks:    make(map[int]*utils.Block),
+	}
+	err = readRecords(blockFile, func() interface{} { return new(blockRecord) }, func(v interface{}) {
+		rec := v.(*blockRecord)
+		s.blocks[rec.Round] = rec.Block
+	})
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("unable to read blocks: %w", err)
+	}
+	return s, nil
+}
+
+func (s *FileStore) PutBlock(r int, block *utils.Block) error {
+	s.Lock()
+	defer s.Unlock()
+	if prev, ok := s.blocks[r]; ok {
+		if sameBlock(prev, block) {
+			return nil
+		}
+		return ErrRoundFinalized
+	}
+	if err := appendRecord(s.blockFile, &blockRecord{Round: r, Block: block}); err != nil {
+		return err
+	}
+	s.blocks[r] = block
+	return nil
+}
+
+func (s *FileStore) Block(r int) (*utils.Block, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	block, ok := s.blocks[r]
+	return block, ok, nil
+}
+
+func (s *FileStore) Blocks() (map[int]*utils.Block, error) {
+	s.Lock()
+	defer s.Unlock()
+	ret := make(map[int]*utils.Block, len(s.blocks))
+	for r, block := range s.blocks {
+		ret[r] = block
+	}
+	return ret, nil
+}
+
+func (s *FileStore) Close() error {
+	return s.blockFile.Close()
+}
+
+// openLog opens an append-only log file and cuts off a partially written last record.
+func openLog(filename string) (*os.File, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	valid, err := validLength(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err = f.Truncate(valid); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err = f.Seek(valid, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// validLength returns the length of the prefix of f that consists of complete records. Only the
+// last record may be incomplete or fail its checksum, that is what a crash during a write leaves
+// behind. A corrupted record in front of other records returns an error.
+func validLength(f *os.File) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+	var valid int64
+	for {
+		payload, err := readRecord(r)
+		switch {
+		case err == io.EOF, err == errIncompleteRecord:
+			return valid, nil
+		case err == errChecksumMismatch:
+			if valid+int64(recordHeaderSize+len(payload)) == info.Size() {
+				return valid, nil
+			}
+			return 0, fmt.Errorf("%w at offset %d", err, valid)
+		case err != nil:
+			return 0, fmt.Errorf("%w at offset %d", err, valid)
+		}
+		valid += int64(recordHeaderSize + len(payload))
+	}
+}
+
+// appendRecord encodes v and appends it to f. It returns after the record was synced to disk.
+func appendRecord(f *os.File, v interface{}) error {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(v); err != nil {
+		return err
+	}
+	rec := make([]byte, recordHeaderSize, recordHeaderSize+payload.Len())
+	binary.BigEndian.PutUint32(rec, uint32(payload.Len()))
+	binary.BigEndian.PutUint32(rec[4:], crc32.ChecksumIEEE(payload.Bytes()))
+	rec = append(rec, payload.Bytes()...)
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(rec); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		// Cut off the partially written record, so that later records stay readable
+		f.Truncate(offset)
+		f.Seek(offset, io.SeekStart)
+		return err
+	}
+	return nil
+}
+
+// readRecords decodes all records of f in order. Every record is decoded into a value returned by
+// newValue and passed to handle. The offset of f is restored afterwards.
+func readRecords(f *os.File, newValue func() interface{}, handle func(v interface{})) error {
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	defer f.Seek(offset, io.SeekStart)
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(io.LimitReader(f, offset))
+	for {
+		payload, err := readRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		v := newValue()
+		if err = gob.NewDecoder(bytes.NewReader(payload)).Decode(v); err != nil {
+			return err
+		}
+		handle(v)
+	}
+}
+
+// Errors returned for records that can't be read
+var (
+	errIncompleteRecord = errors.New("incomplete record")
+	errCorruptedHeader  = errors.New("corrupted record header")
+	errChecksumMismatch = errors.New("corrupted record")
+)
+
+// readRecord reads the payload of the next record. It returns io.EOF if there are no more records
+// and an error if the record is incomplete or corrupted. If the checksum doesn't match, the payload
+// is returned together with errChecksumMismatch.
+func readRecord(r io.Reader) ([]byte, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errIncompleteRecord
+		}
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header)
+	if size > maxRecordSize {
+		return nil, errCorruptedHeader
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errIncompleteRecord
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return payload, errChecksumMismatch
+	}
+	return payload, nil
+}
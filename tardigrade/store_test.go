@@ -0,0 +1,201 @@
+package tardigrade
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+func newTestBlock(txs ...string) *utils.Block {
+	block := &utils.Block{
+		Txs:      make([][]byte, 0),
+		TxsCount: len(txs),
+	}
+	for _, tx := range txs {
+		block.Txs = append(block.Txs, []byte(tx))
+	}
+	return block
+}
+
+// newTestChain returns chained blocks with one transaction per block.
+func newTestChain(txs ...string) []*utils.Block {
+	blocks := make([]*utils.Block, len(txs))
+	var parent *utils.BlockHeader
+	for r, tx := range txs {
+		blocks[r] = newTestBlock(tx)
+		blocks[r].Header = utils.NewBlockHeader(r, parent, blocks[r].Txs, "acs", nil)
+		parent = blocks[r].Header
+	}
+	return blocks
+}
+
+func TestStore(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fileStore.Close()
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"file":   fileStore,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			if err := store.PutBlock(0, newTestBlock("foo", "bar")); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.PutBlock(0, newTestBlock("foo", "bar")); err != nil {
+				t.Errorf("Storing the same block twice failed: %s", err)
+			}
+			if err := store.PutBlock(0, newTestBlock("baz")); err != ErrRoundFinalized {
+				t.Errorf("Expected %v when storing a different block, got %v", ErrRoundFinalized, err)
+			}
+			blocks, err := store.Blocks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(blocks) != 1 || !sameBlock(blocks[0], newTestBlock("foo", "bar")) {
+				t.Errorf("Got unexpected blocks %v", blocks)
+			}
+			if block, ok, err := store.Block(0); err != nil || !ok || !sameBlock(block, newTestBlock("foo", "bar")) {
+				t.Errorf("Got unexpected block %v", block)
+			}
+			if _, ok, _ := store.Block(1); ok {
+				t.Errorf("Got block for a round that wasn't stored")
+			}
+		})
+	}
+}
+
+func TestFileStoreRecovery(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.PutBlock(0, newTestBlock("foo"))
+	store.PutBlock(1, newTestBlock("bar"))
+	store.Close()
+
+	// Simulate a crash while a record was written
+	f, err := os.OpenFile(filepath.Join(dir, "blocks.log"), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 42, 42})
+	f.Close()
+
+	store, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, _ := store.Blocks()
+	if len(blocks) != 2 || !sameBlock(blocks[0], newTestBlock("foo")) || !sameBlock(blocks[1], newTestBlock("bar")) {
+		t.Errorf("Got unexpected blocks after recovery %v", blocks)
+	}
+	// Records written after the recovery must be readable after the next restart
+	store.PutBlock(2, newTestBlock("baz"))
+	store.Close()
+
+	store, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	blocks, _ = store.Blocks()
+	if len(blocks) != 3 || !sameBlock(blocks[2], newTestBlock("baz")) {
+		t.Errorf("Got unexpected blocks after second recovery %v", blocks)
+	}
+}
+
+func TestFileStoreCorruption(t *testing.T) {
+	// writeBlocks writes three blocks and returns the size of the block file after every block
+	writeBlocks := func(dir string) []int64 {
+		store, err := NewFileStore(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		sizes := make([]int64, 0)
+		for r, tx := range []string{"foo", "bar", "baz"} {
+			store.PutBlock(r, newTestBlock(tx))
+			info, err := os.Stat(filepath.Join(dir, "blocks.log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sizes = append(sizes, info.Size())
+		}
+		return sizes
+	}
+	// flipByte flips the last byte of the payload of the record ending at offset
+	flipByte := func(dir string, offset int64) {
+		f, err := os.OpenFile(filepath.Join(dir, "blocks.log"), os.O_RDWR, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		b := make([]byte, 1)
+		f.ReadAt(b, offset-1)
+		b[0] ^= 0xff
+		f.WriteAt(b, offset-1)
+	}
+
+	// A corrupted last record is a torn write and is cut off
+	dir := t.TempDir()
+	sizes := writeBlocks(dir)
+	flipByte(dir, sizes[2])
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Expected store with a torn last record to open, got: %s", err)
+	}
+	blocks, _ := store.Blocks()
+	if len(blocks) != 2 {
+		t.Errorf("Expected %d blocks, got %d", 2, len(blocks))
+	}
+	store.Close()
+
+	// A corrupted record in front of other records is an error
+	dir = t.TempDir()
+	sizes = writeBlocks(dir)
+	flipByte(dir, sizes[1])
+	if _, err = NewFileStore(dir); err == nil {
+		t.Errorf("Expected store with a corrupted record in the middle to be refused")
+	}
+	info, _ := os.Stat(filepath.Join(dir, "blocks.log"))
+	if info.Size() != sizes[2] {
+		t.Errorf("Valid records after the corrupted record were cut off")
+	}
+}
+
+func TestABCRecovery(t *testing.T) {
+	// Scenario: The node crashed in round 2 after the blocks of rounds 0 and 1 were stored.
+	chain := newTestChain("foo", "bar")
+	store := NewMemoryStore()
+	store.PutBlock(0, chain[0])
+	store.PutBlock(1, chain[1])
+
+	u := NewABC(&ABCConfig{n: 1}, nil)
+	if err := u.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+	blocks := u.GetBlocks()
+	if len(blocks) != 2 || !sameBlock(blocks[1], chain[1]) {
+		t.Errorf("Got unexpected blocks after recovery %v", blocks)
+	}
+	if !u.isFinalized(1) || u.isFinalized(2) {
+		t.Errorf("Expected round 1 to be finalized and round 2 not")
+	}
+
+	// A block that was tampered with is refused
+	tampered := newTestChain("foo", "bar")
+	tampered[1].Txs[0] = []byte("baz")
+	store = NewMemoryStore()
+	store.PutBlock(0, tampered[0])
+	store.PutBlock(1, tampered[1])
+	if err := NewABC(&ABCConfig{n: 1}, nil).SetStore(store); err == nil {
+		t.Errorf("Tampered block got recovered")
+	}
+}
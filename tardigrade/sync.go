@@ -0,0 +1,211 @@
+package tardigrade
+
+import (
+	"log"
+	"time"
+
+	utils "github.com/sochsenreither/tardigrade/utils"
+)
+
+// Messages of the catch-up protocol use this round, so they don't mix with the messages of a
+// running round.
+const syncRound = -1
+
+// Domains of the signatures on synced blocks and of their hashes
+const (
+	syncBlockDomain     = "abc-sync-block"
+	syncBlockHashDomain = "tardigrade/abc-sync-block"
+)
+
+const (
+	maxSyncBlocks   = 100 // Maximum number of blocks in one sync response
+	maxSyncAttempts = 10  // Number of requests sent before giving up on a catch-up
+)
+
+// SyncRequest asks peers for their finalized blocks starting at round From.
+type SyncRequest struct {
+	Sender int
+	From   int
+}
+
+// SyncResponse contains finalized blocks of a peer.
+type SyncResponse struct {
+	Sender int
+	Blocks []*SyncedBlock
+}
+
+// SyncedBlock is a finalized block vouched for by the sender of a sync response.
+type SyncedBlock struct {
+	Round int
+	Block *utils.Block
+	Sig   []byte // Signature of the sender on the round and the block
+}
+
+// serveSync answers sync requests of other nodes, forwards sync responses to a running catch-up
+// and collects the checkpoints of other nodes.
+func (abc *ABC) serveSync() {
+	for {
+		msg := abc.receive(syncRound)
+		switch m := msg.Payload.(type) {
+		case *SyncRequest:
+			abc.handleSyncRequest(m)
+		case *SyncResponse:
+			select {
+			case abc.syncChan <- m:
+			default:
+				// No catch-up is running or it can't keep up
+			}
+		case *Checkpoint:
+			abc.handleCheckpoint(m)
+		}
+	}
+}
+
+// handleSyncRequest sends the finalized blocks starting at the requested round to the sender.
+func (abc *ABC) handleSyncRequest(m *SyncRequest) {
+	if m.Sender < 0 || m.Sender >= abc.Cfg.n || m.Sender == abc.Cfg.NodeId {
+		return
+	}
+	blocks := abc.GetBlocks()
+	resp := &SyncResponse{
+		Sender: abc.Cfg.NodeId,
+		Blocks: make([]*SyncedBlock, 0),
+	}
+	for r := m.From; len(resp.Blocks) < maxSyncBlocks; r++ {
+		block, ok := blocks[r]
+		if !ok {
+			// Blocks are only sent without gaps
+			break
+		}
+		resp.Blocks = append(resp.Blocks, &SyncedBlock{
+			Round: r,
+			Block: block,
+			Sig:   abc.tcs.identity.Sign(syncBlockDomain, syncBlockHash(r, block)),
+		})
+	}
+	if len(resp.Blocks) == 0 {
+		return
+	}
+	mes := &utils.Message{
+		Sender:  abc.Cfg.NodeId,
+		Payload: resp,
+	}
+	abc.multicast(mes, syncRound, m.Sender)
+}
+
+// catchUp requests the blocks of all rounds before round to that are missing, starting at the
+// first missing round. A block is only accepted if ta+1 nodes signed the same block for a round,
+// so at least one honest node finalized it. It returns the number of rounds that are still missing.
+func (abc *ABC) catchUp(to int) int {
+	from := abc.firstMissingRound()
+	if from >= to {
+		return 0
+	}
+	log.Printf("Node %d: catching up on rounds %d to %d", abc.Cfg.NodeId, from, to-1)
+
+	// Maps round -> hash of the block -> nodeId -> block
+	votes := make(map[int]map[[32]byte]map[int]*utils.Block)
+	interval := time.Duration(abc.Cfg.lambda) * time.Millisecond
+	for attempt := 0; attempt < maxSyncAttempts && from < to; attempt++ {
+		req := &utils.Message{
+			Sender: abc.Cfg.NodeId,
+			Payload: &SyncRequest{
+				Sender: abc.Cfg.NodeId,
+				From:   from,
+			},
+		}
+		abc.multicast(req, syncRound)
+
+		timeout := time.After(interval)
+	Collect:
+		for from < to {
+			select {
+			case m := <-abc.syncChan:
+				abc.handleSyncResponse(m, from, to, votes)
+				from = abc.firstMissingRound()
+			case <-timeout:
+				break Collect
+			}
+		}
+	}
+
+	if from < to {
+		log.Printf("Node %d: catch-up stopped at round %d", abc.Cfg.NodeId, from)
+		return to - from
+	}
+	log.Printf("Node %d: caught up to round %d", abc.Cfg.NodeId, to-1)
+	return 0
+}
+
+// handleSyncResponse counts the valid blocks of a sync response for the rounds from to to.
+// Afterwards all rounds for which ta+1 nodes sent the same block are finalized in order.
+func (abc *ABC) handleSyncResponse(m *SyncResponse, from, to int, votes map[int]map[[32]byte]map[int]*utils.Block) {
+	for _, sb := range m.Blocks {
+		if sb == nil || sb.Block == nil || sb.Round < from || sb.Round >= to {
+			continue
+		}
+		h := syncBlockHash(sb.Round, sb.Block)
+		if !abc.tcs.identity.Cert.VerifySig(m.Sender, syncBlockDomain, h, sb.Sig) {
+			log.Printf("Node %d: received synced block of round %d with invalid signature from %d", abc.Cfg.NodeId, sb.Round, m.Sender)
+			continue
+		}
+		if votes[sb.Round] == nil {
+			votes[sb.Round] = make(map[[32]byte]map[int]*utils.Block)
+		}
+		if votes[sb.Round][h] == nil {
+			votes[sb.Round][h] = make(map[int]*utils.Block)
+		}
+		votes[sb.Round][h][m.Sender] = sb.Block
+	}
+
+	for r := from; r < to; r++ {
+		if abc.isFinalized(r) {
+			continue
+		}
+		var block *utils.Block
+		for _, vs := range votes[r] {
+			if len(vs) >= abc.Cfg.ta+1 {
+				for _, b := range vs {
+					block = b
+					break
+				}
+			}
+		}
+		if block == nil {
+			return
+		}
+		// The block has to extend the ledger of the node
+		blocks := abc.GetBlocks()
+		blocks[r] = block
+		if err := verifyBlock(blocks, r); err != nil {
+			log.Printf("Node %d round %d: synced block doesn't extend the ledger: %s", abc.Cfg.NodeId, r, err)
+			return
+		}
+		if err := abc.store.PutBlock(r, block); err != nil {
+			log.Fatalf("Node %d round %d: failed to store synced block: %s", abc.Cfg.NodeId, r, err)
+		}
+		abc.Lock()
+		abc.synced[r] = true
+		abc.Unlock()
+		abc.setBlock(r, block)
+		log.Printf("Node %d round %d: finalized round with synced block", abc.Cfg.NodeId, r)
+	}
+}
+
+// firstMissingRound returns the first round without a finalized block.
+func (abc *ABC) firstMissingRound() int {
+	abc.Lock()
+	defer abc.Unlock()
+	r := 0
+	for {
+		if _, ok := abc.blocks[r]; !ok {
+			return r
+		}
+		r++
+	}
+}
+
+// syncBlockHash returns a sha256 hash over the round and the block.
+func syncBlockHash(r int, block *utils.Block) [32]byte {
+	return utils.NewEncoder(syncBlockHashDomain).Int(r).Int(block.TxsCount).Hash(block.Hash()).Sum()
+}
@@ -0,0 +1,99 @@
+package tardigrade
+
+import (
+	"encoding/gob"
+	"net"
+	"testing"
+
+	"github.com/niclabs/tcrsa"
+	"github.com/sochsenreither/tardigrade/utils"
+)
+
+// setupCatchUp returns n nodes that use the handlers returned by newHandler. Node 0 missed rounds
+// 0 to 2. Nodes 1 and 2 are honest, node 3 is byzantine and sends a different chain from round 1
+// on.
+func setupCatchUp(t *testing.T, n int, newHandler func(i int) *utils.HandlerFuncs) ([]*ABC, []*utils.Block) {
+	keyShares, keyMeta, err := tcrsa.NewKey(512, uint16(n/2+1), uint16(n), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identities, err := utils.NewIdentities(n, 0, map[int]bool{0: true, 1: true}, keyShares, keyMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := newTestChain("foo", "bar", "baz")
+	forged := newTestChain("foo", "forged", "baz")
+	abcs := make([]*ABC, n)
+	for i := 0; i < n; i++ {
+		funcs := newHandler(i)
+		cfg := NewABCConfig(n, i, 1, 1, 1, 1, 10, 0, 8, map[int]bool{0: true, 1: true}, nil, funcs)
+		abcs[i] = NewABC(cfg, &tcs{identity: identities[i]})
+		if i > 0 {
+			store := NewMemoryStore()
+			chain := blocks
+			if i == 3 {
+				chain = forged
+			}
+			for r, block := range chain {
+				store.PutBlock(r, block)
+			}
+			if err := abcs[i].SetStore(store); err != nil {
+				t.Fatal(err)
+			}
+		}
+		go funcs.Receiver()
+		go abcs[i].serveSync()
+	}
+	return abcs, blocks
+}
+
+// checkCatchUp runs a catch-up of node 0 and checks that it got the honest chain.
+func checkCatchUp(t *testing.T, abcs []*ABC, blocks []*utils.Block) {
+	if missing := abcs[0].catchUp(len(blocks)); missing != 0 {
+		t.Fatalf("Expected to catch up on all rounds, %d rounds are missing", missing)
+	}
+	synced := abcs[0].GetBlocks()
+	for r, block := range blocks {
+		if synced[r] == nil || !sameBlock(synced[r], block) {
+			t.Errorf("Got unexpected block in round %d: %v", r, synced[r])
+		}
+	}
+	stored, _ := abcs[0].store.Blocks()
+	if len(stored) != len(blocks) {
+		t.Errorf("Expected %d synced blocks in the store, got %d", len(blocks), len(stored))
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	n := 4
+	nodeChans := make(map[int]chan *utils.HandlerMessage)
+	for i := 0; i < n; i++ {
+		nodeChans[i] = make(chan *utils.HandlerMessage, 9999)
+	}
+	abcs, blocks := setupCatchUp(t, n, func(i int) *utils.HandlerFuncs {
+		return utils.NewLocalHandler(nodeChans, nil, i, n, 1).Funcs
+	})
+	checkCatchUp(t, abcs, blocks)
+}
+
+func TestCatchUpNetwork(t *testing.T) {
+	// Messages of the catch-up protocol are sent in syncRound, which has no round configuration
+	gob.Register(&SyncRequest{})
+	gob.Register(&SyncResponse{})
+	n := 4
+	ips := make(map[int]string)
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ips[i] = l.Addr().String()
+		l.Close()
+	}
+	rcfgs := utils.SyncNoCrashes(3).RoundCfgs
+	abcs, blocks := setupCatchUp(t, n, func(i int) *utils.HandlerFuncs {
+		return utils.NewNetworkHandler(ips, i, n, 1, rcfgs).Funcs
+	})
+	checkCatchUp(t, abcs, blocks)
+}
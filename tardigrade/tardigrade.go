@@ -2,13 +2,13 @@ package tardigrade
 
 import (
 	"bytes"
-	"crypto"
-	"crypto/rsa"
 	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"log"
 	"math/big"
-	"math/rand"
-	"strconv"
+	"sort"
 	"sync"
 	"time"
 
@@ -24,21 +24,47 @@ type ABC struct {
 	acss           []*acs.CommonSubset                             // Subset instances
 	blas           []*bla.BlockAgreement                           // Blockagreement instances
 	tcs            *tcs                                            // Keys for threshold crypto system
-	buf            [][]byte                                        // Transaction buffer
+	mempool        *Mempool                                        // Transactions that aren't in a block yet
 	multicast      func(msg *utils.Message, round int, rec ...int) // Function for multicasting messages
 	receive        func(round int) *utils.Message                  // Function for receiving messages
 	blocks         map[int]*utils.Block                            // Maps round -> block
-	latency        map[[32]byte]time.Time                          //
+	finalized      map[int]chan struct{}                           // Closed when the block of a round is finalized
+	synced         map[int]bool                                    // Rounds whose block was received from peers
+	app            Application                                     // Application that processes finalized blocks
+	appHashes      map[int][32]byte                                // Maps checkpoint round -> own app hash
+	checkpoints    map[int]map[int][32]byte                        // Maps checkpoint round -> nodeId -> app hash
+	store          Store                                           // Storage for finalized blocks and decisions
+	syncChan       chan *SyncResponse                              // Sync responses for a running catch-up
+	catchingUp     bool                                            // Whether a catch-up is running
+	catchUpTo      int                                             // Round up to which the running catch-up goes
+	evidence       []*Evidence                                     // Detected misbehaviour of other nodes
+	fairness       *fairness                                       // Statistics of the proposers
+	ledger         *txIndex                                        // Transactions of the blocks of recent rounds
+	gossip         *gossip                                         // Transaction gossip, nil if disabled
+	nonces         *nonceTracker                                   // Used nonces of the clients
+	validity       ExternalValidity                                // Deterministic check of decrypted transactions
+	onInclude      func(h [32]byte, r int)                         // Called for included client ciphertexts
+	onDrop         func(h [32]byte, reason error)                  // Called for dropped transactions
 	LatencyTotal   time.Duration
+	RuntimeTotal   time.Duration // Sum of the runtimes of all finished rounds
 	FinishedRounds int
+	DupTxsInBlock  int // Transactions dropped because they appear earlier in the same block
+	DupTxsInLedger int // Transactions dropped because they are in the block of a recent round
+	ReplayedTxs    int // Envelopes dropped because their nonce was already used
 	sync.Mutex
 }
 
+// Domains of the signatures on committee messages and of their hashes
+const (
+	committeeMessageDomain     = "abc-committee"
+	committeeMessageHashDomain = "tardigrade/abc-committee-message"
+)
+
 type BlockMessage struct {
 	Sender  int
-	Status  string          // "large" or "small"
-	Payload []byte          // Encrypted data
-	Sig     *tcrsa.SigShare // Signature on payload
+	Status  string // "large" or "small"
+	Payload []byte // Encrypted data
+	Sig     []byte // Signature of the sender on sender, status and payload
 }
 
 type CommitteeMessage struct {
@@ -46,7 +72,7 @@ type CommitteeMessage struct {
 	PreBlock *utils.PreBlock
 	Hash     [32]byte        // Hash of the pre-block
 	HashSig  *tcrsa.SigShare // Signature of the hash
-	Proof    *tcrsa.SigShare // Signature of the dealer on the nodeId of the sender
+	Sig      []byte          // Signature of the sender on the hash and round
 }
 
 type PointerMessage struct {
@@ -63,11 +89,24 @@ type PreBlockMessage struct {
 type PbDecryptionShareMessage struct {
 	Sender    int
 	DecShares [][]*tcpaillier.DecryptionShare // One decryption share for every message in the block
+	Proofs    [][]*tcpaillier.DecryptShareZK  // Proof of validity for every decryption share
 }
 
 func NewABC(cfg *ABCConfig, tcs *tcs) *ABC {
 	tk := (((1 - cfg.epsilon) * cfg.kappa * cfg.ta) / cfg.n)
 	cfg.tk = tk
+	if cfg.decTimeout == 0 {
+		cfg.decTimeout = defaultDecryptionTimeout
+	}
+	if cfg.minTxSize == 0 {
+		cfg.minTxSize = defaultMinTxSize
+	}
+	if cfg.mempoolCap == 0 {
+		cfg.mempoolCap = defaultMempoolCapacity
+	}
+	if cfg.mempoolTTL == 0 {
+		cfg.mempoolTTL = defaultMempoolTTL
+	}
 	receive := func(round int) *utils.Message {
 		return cfg.handlerFuncs.ABCreceive(round)
 	}
@@ -88,35 +127,87 @@ func NewABC(cfg *ABCConfig, tcs *tcs) *ABC {
 		acss:           acss,
 		blas:           blas,
 		tcs:            tcs,
-		buf:            make([][]byte, 0),
+		mempool:        NewMempool(cfg.mempoolCap, cfg.mempoolTTL),
 		multicast:      multicast,
 		receive:        receive,
 		blocks:         make(map[int]*utils.Block),
-		latency:        make(map[[32]byte]time.Time),
+		finalized:      make(map[int]chan struct{}),
+		synced:         make(map[int]bool),
+		appHashes:      make(map[int][32]byte),
+		checkpoints:    make(map[int]map[int][32]byte),
+		store:          NewMemoryStore(),
+		syncChan:       make(chan *SyncResponse, 999),
+		ledger:         newTxIndex(),
+		nonces:         newNonceTracker(),
+		fairness:       newFairness(cfg.n),
 		LatencyTotal:   time.Duration(0),
+		RuntimeTotal:   time.Duration(0),
 		FinishedRounds: 0,
 	}
+	if cfg.batchSize == 0 {
+		cfg.batchSize = cfg.n
+	}
+	if cfg.window == 0 {
+		cfg.window = cfg.n * cfg.n * cfg.kappa
+	}
+	if cfg.plaintext && cfg.clientEnc {
+		log.Printf("Node %d: client encryption can't be used in plaintext mode, disabling it", cfg.NodeId)
+		cfg.clientEnc = false
+	}
+	if cfg.gossipFanout > 0 {
+		if cfg.gossipRate <= 0 {
+			cfg.gossipRate = defaultGossipRate
+		}
+		u.gossip = newGossip(cfg.gossipRate)
+	}
 	return u
 }
 
 func (abc *ABC) Run(maxRound int, roundCfg utils.RoundConfigs, start time.Time) {
 	<-time.After(time.Until(start))
+	// A node that starts after the first round has passed rejoins the schedule at the next round
+	// and catches up on the rounds it missed.
+	round := 0
+	lambda := time.Duration(abc.Cfg.lambda) * time.Millisecond
+	if elapsed := time.Since(start); elapsed >= lambda {
+		round = int(elapsed/lambda) + 1
+		<-time.After(time.Until(start.Add(time.Duration(round) * lambda)))
+	}
 	startTime := time.Now()
 	log.Printf("Node %d starting", abc.Cfg.NodeId)
 	go abc.Cfg.handlerFuncs.Receiver()
+	go abc.serveSync()
+	if abc.app != nil {
+		go abc.runApplication()
+	}
+	if abc.gossip != nil {
+		go abc.runGossip()
+	}
+	if round > 0 {
+		log.Printf("Node %d rejoining in round %d", abc.Cfg.NodeId, round)
+		go abc.runCatchUp(round)
+	}
+	if round >= maxRound && maxRound > 0 {
+		return
+	}
+	// Instances of rounds that were missed are never run
+	for len(abc.acss) < round {
+		abc.acss = append(abc.acss, nil)
+		abc.blas = append(abc.blas, nil)
+	}
 
 	stop := make(chan struct{}, 100)
 	var wg sync.WaitGroup
-	round := 0
-	ticker := time.NewTicker(time.Duration(abc.Cfg.lambda) * time.Millisecond)
+	ticker := time.NewTicker(lambda)
 	if maxRound > 0 {
-		wg.Add(maxRound)
+		wg.Add(maxRound - round)
 	}
 	// Start first round immediately
+	first := round
 	go func() {
-		abc.acss = append(abc.acss, setupACS(0, abc.Cfg, abc.tcs, roundCfg[0].Ta))
-		abc.blas = append(abc.blas, setupBLA(0, abc.Cfg, abc.tcs, roundCfg[0].Ts))
-		abc.runProtocol(0, roundCfg[0])
+		abc.acss = append(abc.acss, setupACS(first, abc.Cfg, abc.tcs, roundCfg[first].Ta))
+		abc.blas = append(abc.blas, setupBLA(first, abc.Cfg, abc.tcs, roundCfg[first].Ts))
+		abc.runProtocol(first, roundCfg[first])
 		if maxRound > 0 {
 			wg.Done()
 		}
@@ -136,6 +227,10 @@ func (abc *ABC) Run(maxRound int, roundCfg utils.RoundConfigs, start time.Time)
 			if r >= maxRound && maxRound > 0 {
 				stop <- struct{}{}
 			} else {
+				// A node that recovers from a crash catches up on the rounds it missed
+				if prev := roundCfg[r-1]; prev != nil && prev.Crashed[abc.Cfg.NodeId] && !roundCfg[r].Crashed[abc.Cfg.NodeId] {
+					go abc.runCatchUp(r)
+				}
 				go func() {
 					abc.runProtocol(r, roundCfg[r])
 					if maxRound > 0 {
@@ -150,12 +245,43 @@ func (abc *ABC) Run(maxRound int, roundCfg utils.RoundConfigs, start time.Time)
 	}
 }
 
+// runCatchUp catches up on all rounds before round to. Only one catch-up runs at a time. If a
+// catch-up is already running, it goes on up to round to when it is done and this call returns
+// immediately.
+func (abc *ABC) runCatchUp(to int) {
+	abc.Lock()
+	if to > abc.catchUpTo {
+		abc.catchUpTo = to
+	}
+	if abc.catchingUp {
+		abc.Unlock()
+		return
+	}
+	abc.catchingUp = true
+	for {
+		target := abc.catchUpTo
+		abc.Unlock()
+		abc.catchUp(target)
+		abc.Lock()
+		if abc.catchUpTo == target {
+			abc.catchingUp = false
+			abc.Unlock()
+			return
+		}
+	}
+}
+
 func (abc *ABC) runProtocol(r int, rcfg *utils.RoundConfig) {
 	if rcfg.Crashed[abc.Cfg.NodeId] {
 		// Crash node for current round
 		log.Printf("Node %d crashing in round %d", abc.Cfg.NodeId, r)
 		return
 	}
+	if abc.isFinalized(r) {
+		// Round was finalized before a restart
+		log.Printf("Node %d round %d: already finalized, skipping round", abc.Cfg.NodeId, r)
+		return
+	}
 	startTotal := time.Now()
 
 	// log.Printf("Node %d: starting round %d\n", abc.Cfg.NodeId, r)
@@ -177,7 +303,7 @@ func (abc *ABC) runProtocol(r int, rcfg *utils.RoundConfig) {
 	var ptr *utils.BlockPointer                        // Blockpointer
 	largeBlockChan := make(chan *utils.PreBlock, 9999) // Buffer for received large pre-blocks
 	pbChan := make(chan *utils.PreBlock, 9999)         // Chan for pre-block that matches ptr from acs
-	decChan := make(chan [][]*tcpaillier.DecryptionShare, abc.Cfg.n*99)
+	decChan := make(chan *PbDecryptionShareMessage, abc.Cfg.n*99)
 
 	// Listener function that handles incoming messages
 	listener := func() {
@@ -199,7 +325,7 @@ func (abc *ABC) runProtocol(r int, rcfg *utils.RoundConfig) {
 				abc.handleCommitteeMessage(r, m, &ptr, mesRec, blocksReceived, &mu, ptrChan)
 			case *PbDecryptionShareMessage:
 				// log.Printf("Node %d: receiving decryption share. decshares: %d from %d", abc.cfg.nodeId, len(m.DecShares), m.Sender)
-				decChan <- m.DecShares
+				decChan <- m
 			case *PreBlockMessage:
 				//log.Printf("Node %d: receiving pre-block", abc.cfg.nodeId)
 				pbChan <- m.PreBlock
@@ -210,12 +336,8 @@ func (abc *ABC) runProtocol(r int, rcfg *utils.RoundConfig) {
 
 	// At time 0 propose transactions:
 	go func() {
-		l := abc.Cfg.n * abc.Cfg.n
-		// abc.Lock()
-		// bufLen := len(abc.buf)
-		// abc.Unlock()
-		v := abc.proposeTxs(l/abc.Cfg.n, l*abc.Cfg.kappa)
-		w := abc.proposeTxs(l/abc.Cfg.n, l*abc.Cfg.kappa)
+		// If the mempool is short fewer transactions are proposed
+		v, w := abc.proposeBatches(abc.Cfg.n, abc.Cfg.batchSize, abc.Cfg.window)
 
 		// Encrypt each v_i in v and send it to node_i
 		// log.Printf("Node %d round %d: is sending small blocks to nodes", abc.cfg.nodeId, r)
@@ -276,75 +398,110 @@ func (abc *ABC) runProtocol(r int, rcfg *utils.RoundConfig) {
 	acsOutput := abc.acss[r].GetValue()
 	acsTime := time.Since(start)
 	var block *utils.Block
+	var sources *blockSources // Proposers of the transactions in the block
+	// Every node has to finalize the same block, so a node never finishes the round with only the
+	// transactions it could decrypt by itself. While the pre-block or the decryption shares are
+	// missing, the node tries to catch up on the block of the round from its peers every
+	// decTimeout. Waiting stops once the round is finalized by the catch-up.
+	finalized := abc.finalizedChan(r)
+	stopCatchUps := abc.startCatchUps(r+1, abc.Cfg.decTimeout)
 	// log.Printf("Node %d round %d: received output from ACS. len: %d", abc.Cfg.NodeId, r, len(acsOutput))
 	if len(acsOutput) == 1 {
 		// BLA was successfull and we got one large block as result
 		if abc.Cfg.committee[abc.Cfg.NodeId] {
-			abc.waitForMatchingBlock(r, acsOutput[0].Pointer, largeBlockChan)
+			abc.waitForMatchingBlock(r, acsOutput[0].Pointer, largeBlockChan, finalized)
 		}
-		for pb := range pbChan {
-			h := pb.Hash()
-			if bytes.Equal(acsOutput[0].Pointer.BlockHash, h[:]) {
-				// We know the block is a large pre-block
-				block = abc.constructBlock(r, []*utils.PreBlock{pb}, decChan)
-			}
-			if block != nil {
-				break
+	Wait:
+		for block == nil {
+			select {
+			case pb := <-pbChan:
+				h := pb.Hash()
+				if bytes.Equal(acsOutput[0].Pointer.BlockHash, h[:]) {
+					// We know the block is a large pre-block
+					block, sources = abc.constructBlock(r, []*utils.PreBlock{pb}, decChan, finalized)
+					break Wait
+				}
+			case <-finalized:
+				break Wait
 			}
 		}
 	} else {
-		if abc.Cfg.committee[abc.Cfg.NodeId] {
+		if abc.Cfg.committee[abc.Cfg.NodeId] && !abc.Cfg.plaintext {
 			abc.sendDecryptionShares(r, acsOutput)
 		}
 		preBlocks := make([]*utils.PreBlock, len(acsOutput))
 		for i, bs := range acsOutput {
 			preBlocks[i] = bs.Block
 		}
-		block = abc.constructBlock(r, preBlocks, decChan)
+		block, sources = abc.constructBlock(r, preBlocks, decChan, finalized)
+	}
+	stopCatchUps()
+	if block == nil {
+		log.Printf("Node %d round %d: round was finalized with the block of the peers", abc.Cfg.NodeId, r)
+		return
 	}
 
-	//abc.setBlock(r, block)
+	proto := "bla"
+	var pointerSig tcrsa.Signature
+	if len(acsOutput) == 1 {
+		pointerSig = acsOutput[0].Pointer.Sig
+	} else {
+		proto = "acs"
+	}
+	// Blocks are chained in the order of the rounds, so the block of the previous round is needed
+	parent := abc.waitForParent(r)
+	if abc.isFinalized(r) {
+		// A catch-up of a later round got the block while the node waited for the parent
+		log.Printf("Node %d round %d: round was finalized with the block of the peers while waiting for round %d", abc.Cfg.NodeId, r, r-1)
+		if abc.Cfg.clientEnc && sources != nil {
+			synced, _ := abc.GetBlock(r)
+			abc.reportCiphertexts(r, synced, sources)
+			abc.mempool.Remove(sources.ciphertexts)
+		}
+		return
+	}
+	dupInBlock, dupInLedger := abc.dedupBlock(r, block)
+	replayed := abc.dropReplayedTxs(r, block)
+	abc.recordFairness(r, proto, block, sources)
+	block.Header = utils.NewBlockHeader(r, parent, block.Txs, proto, pointerSig)
+
+	// The block has to be on disk before the round is reported as finished
+	if err := abc.store.PutBlock(r, block); err != nil {
+		// Later rounds can't be finished without this block
+		log.Fatalf("Node %d round %d: failed to store block: %s", abc.Cfg.NodeId, r, err)
+	}
 	count, uniqueTxs, latency := abc.setBlock(r, block)
+	if abc.Cfg.clientEnc && sources != nil {
+		// The mempool holds the ciphertexts of the transactions
+		abc.reportCiphertexts(r, block, sources)
+		uniqueTxs, latency = abc.mempool.Remove(sources.ciphertexts)
+		if uniqueTxs > 0 {
+			latency /= time.Duration(uniqueTxs)
+		}
+	}
+	runTimeTotal := time.Since(startTotal)
 	abc.Lock()
 	abc.LatencyTotal += latency
+	abc.RuntimeTotal += runTimeTotal
 	abc.FinishedRounds++
+	abc.ReplayedTxs += replayed
 	abc.Unlock()
-	runTimeTotal := time.Since(startTotal)
-	proto := "bla"
-	if len(acsOutput) != 1 {
-		proto = "acs"
-	}
-	log.Printf("Node %d finished round %d with %s. txs: %d unique_txs: %d latency: %d t_acs: %d t_total: %d", abc.Cfg.NodeId, r, proto, count, uniqueTxs, latency.Milliseconds(), acsTime.Milliseconds(), runTimeTotal.Milliseconds())
+	log.Printf("Node %d finished round %d with %s. txs: %d unique_txs: %d dup_block: %d dup_ledger: %d replayed: %d latency: %d t_acs: %d t_total: %d", abc.Cfg.NodeId, r, proto, count, uniqueTxs, dupInBlock, dupInLedger, replayed, latency.Milliseconds(), acsTime.Milliseconds(), runTimeTotal.Milliseconds())
 
 }
 
-// SetBlock removes all transactions from the buffer that are in the block and sets the block of
-// the current round. Note: duplicate transactions in the buffer won't get removed, but there
-// shouldn't be duplicates anyway. Returns the amount of transactions in the block.
+// SetBlock removes all transactions from the mempool that are in the block and sets the block of
+// the current round. Returns the amount of transactions in the block, the amount of transactions
+// that were removed from the mempool and their average latency.
 func (abc *ABC) setBlock(r int, block *utils.Block) (int, int, time.Duration) {
-	// Removes an element at index i
-	remove := func(arr [][]byte, i int) [][]byte {
-		arr[i] = arr[len(arr)-1]
-		// Set last element to nil, so that the garbage collector can clean up properly
-		arr[len(arr)-1] = nil
-		return arr[:len(arr)-1]
-	}
-
+	removedTxs, latency := abc.mempool.Remove(block.Txs)
+	abc.ledger.add(r, block.Txs)
 	abc.Lock()
-	removedTxs := 0
-	latency := time.Duration(0)
-	for _, tx := range block.Txs {
-		for i, bufTx := range abc.buf {
-			if bytes.Equal(tx, bufTx) {
-				//log.Printf("Node %d removing from buf: %s", abc.cfg.nodeId, tx)
-				h := sha256.Sum256(tx)
-				latency += time.Since(abc.latency[h])
-				removedTxs++
-				abc.buf = remove(abc.buf, i)
-			}
-		}
-	}
 	abc.blocks[r] = block
+	if ch, ok := abc.finalized[r]; ok {
+		close(ch)
+		delete(abc.finalized, r)
+	}
 	abc.Unlock()
 
 	if removedTxs == 0 {
@@ -354,121 +511,339 @@ func (abc *ABC) setBlock(r int, block *utils.Block) (int, int, time.Duration) {
 	}
 }
 
-func (abc *ABC) constructBlock(r int, b []*utils.PreBlock, decChan chan [][]*tcpaillier.DecryptionShare) *utils.Block {
+// constructBlock decrypts the transactions of the pre-blocks b. Ciphertexts are decrypted
+// concurrently as soon as enough decryption shares arrived. The transactions of the block are
+// ordered by their position in the pre-blocks, so every node constructs the same block regardless
+// of the order in which the decryptions finish. The proposers of the transactions are returned as
+// well. Every ciphertext is decrypted before the block is returned, since a block with only some
+// of the transactions would differ from the blocks of other nodes. If stop is closed first, nil
+// is returned.
+func (abc *ABC) constructBlock(r int, b []*utils.PreBlock, decChan chan *PbDecryptionShareMessage, stop <-chan struct{}) (*utils.Block, *blockSources) {
+	b = abc.limitPreBlocks(r, b)
+	if abc.Cfg.plaintext {
+		return abc.plaintextBlock(r, b)
+	}
 	//log.Printf("Node %d: constructing block.", abc.cfg.nodeId)
-	txs := make([][]byte, 0)
 
-	// Get number of total transactions.
+	// Collect the ciphertexts of all transactions. Decryption shares are indexed the same way.
+	cts := abc.ciphertexts(b)
 	txsCount := 0
-	for _, block := range b {
-		txsCount += block.Quality()
-	}
-	// bl := b[0]
-	// for i, v := range bl.Vec {
-	// 	log.Printf("Node %d: %d - %x", abc.cfg.nodeId, i, v.Message)
-	// }
-	decCounter := 0
-	bytesCounter := 0
-	if len(b) == 1 {
-		// Decrypt large block
-		pb := b[0]
-		decshares := make([][][]*tcpaillier.DecryptionShare, len(pb.Vec))
-		for i := range decshares {
-			decshares[i] = make([][]*tcpaillier.DecryptionShare, abc.Cfg.n)
+	for _, row := range cts {
+		for _, c := range row {
+			if c != nil {
+				txsCount++
+			}
 		}
+	}
 
-		for s := range decChan {
-			for node, messageShares := range s {
-				for message, share := range messageShares {
-					if decshares[node][message] == nil {
-						decshares[node][message] = make([]*tcpaillier.DecryptionShare, 0)
-					}
-					decshares[node][message] = append(decshares[node][message], share)
-					if len(decshares[node][message]) >= len(abc.Cfg.committee)/2+1 {
-						dec, err := abc.tcs.encPk.CombineShares(decshares[node][message]...)
-						if err != nil {
-							log.Printf("Node %d: failed to decrypt ciphertext. %s", abc.Cfg.NodeId, err)
-							continue
-						}
-						txs = append(txs, dec.Bytes())
-						//log.Printf("Node %d: %d - %s", abc.cfg.nodeId, j, dec.Bytes())
-						bytesCounter += len(dec.Bytes())
-						decCounter++
-						if decCounter == txsCount*len(messageShares) {
-							goto Done
-						}
-					}
-				}
-			}
+	// Maps ciphertext -> nodeId -> valid decryption share
+	decshares := make([][]map[int]*tcpaillier.DecryptionShare, len(cts))
+	plaintexts := make([][][]byte, len(cts)) // Decrypted transactions, indexed like the ciphertexts. Nil if malformed
+	decrypted := make([][]bool, len(cts))
+	pending := make([][]bool, len(cts)) // Set once the decryption of a ciphertext started
+	for i := range cts {
+		decshares[i] = make([]map[int]*tcpaillier.DecryptionShare, len(cts[i]))
+		plaintexts[i] = make([][]byte, len(cts[i]))
+		decrypted[i] = make([]bool, len(cts[i]))
+		pending[i] = make([]bool, len(cts[i]))
+		for j := range cts[i] {
+			decshares[i][j] = make(map[int]*tcpaillier.DecryptionShare)
 		}
-	} else {
-		// Decrypt small blocks
-		decshares := make([][][]*tcpaillier.DecryptionShare, len(b))
-		for i := range decshares {
-			decshares[i] = make([][]*tcpaillier.DecryptionShare, abc.Cfg.n)
+	}
+	faulty := make(map[int]bool) // Nodes that sent invalid decryption shares
+	decryptions := make(chan *decryption, txsCount)
+
+	// decrypt combines the decryption shares of ciphertext j of row i in the background.
+	decrypt := func(i, j int) {
+		shares := make(map[int]*tcpaillier.DecryptionShare, len(decshares[i][j]))
+		for sender, share := range decshares[i][j] {
+			shares[sender] = share
 		}
+		pending[i][j] = true
+		go func() {
+			dec, err := abc.combineShares(shares)
+			decryptions <- &decryption{i: i, j: j, plaintext: dec, err: err}
+		}()
+	}
 
-		for s := range decChan {
-			for i, shares := range s {
+	decCounter := 0
+	for decCounter < txsCount {
+		select {
+		case m := <-decChan:
+			if faulty[m.Sender] {
+				continue
+			}
+			if !abc.Cfg.committee[m.Sender] {
+				faulty[m.Sender] = true
+				abc.reportEvidence(r, m.Sender, "sent decryption shares without being in the committee")
+				continue
+			}
+			for i, shares := range m.DecShares {
+				if i >= len(cts) || faulty[m.Sender] {
+					break
+				}
 				for j, share := range shares {
-					if share != nil {
-						decshares[i][j] = append(decshares[i][j], share)
+					if j >= len(cts[i]) || cts[i][j] == nil || decrypted[i][j] || share == nil {
+						continue
+					}
+					if decshares[i][j][m.Sender] != nil {
+						continue
 					}
-					if len(decshares[i][j]) >= len(abc.Cfg.committee)/2+1 {
-						dec, err := abc.tcs.encPk.CombineShares(decshares[i][j]...)
-						if err != nil {
-							log.Printf("Node %d: failed to decrypt ciphertext. %s", abc.Cfg.NodeId, err)
-							continue
-						}
-						txs = append(txs, dec.Bytes())
-						//log.Printf("Node %d: %d - %s", abc.cfg.nodeId, j, dec.Bytes())
-						bytesCounter += len(dec.Bytes())
-						decCounter++
-						if decCounter == txsCount {
-							goto Done
-						}
+					var proof *tcpaillier.DecryptShareZK
+					if i < len(m.Proofs) && j < len(m.Proofs[i]) {
+						proof = m.Proofs[i][j]
+					}
+					if err := abc.verifyDecryptionShare(m.Sender, cts[i][j], share, proof); err != nil {
+						faulty[m.Sender] = true
+						abc.reportEvidence(r, m.Sender, "invalid decryption share: "+err.Error())
+						break
+					}
+					decshares[i][j][m.Sender] = share
+					if len(decshares[i][j]) >= int(abc.tcs.encPk.K) && !pending[i][j] {
+						decrypt(i, j)
+					}
+				}
+			}
+		case d := <-decryptions:
+			if d.err != nil {
+				// Verified shares always combine, see combineShares. The ciphertext stays pending,
+				// so the round only finishes with the block of the other nodes.
+				log.Printf("Node %d round %d: failed to decrypt ciphertext. %s", abc.Cfg.NodeId, r, d.err)
+				continue
+			}
+			decrypted[d.i][d.j] = true
+			decCounter++
+			tx, err := decodeFrame(d.plaintext.Bytes())
+			if err != nil {
+				// The ciphertext was created by a byzantine node, every node drops it
+				log.Printf("Node %d round %d: dropping malformed transaction. %s", abc.Cfg.NodeId, r, err)
+				continue
+			}
+			if err := abc.checkTxValidity(tx); err != nil {
+				// Validity only depends on the transaction, so every node drops it
+				log.Printf("Node %d round %d: dropping invalid transaction. %s", abc.Cfg.NodeId, r, err)
+				continue
+			}
+			if abc.Cfg.clientEnc {
+				// Transactions encrypted by a client are checked by the application only now
+				if err := abc.checkTxSize(tx); err != nil {
+					log.Printf("Node %d round %d: dropping invalid transaction. %s", abc.Cfg.NodeId, r, err)
+					continue
+				}
+				if abc.app != nil {
+					if err := abc.app.CheckTx(tx); err != nil {
+						log.Printf("Node %d round %d: dropping transaction rejected by the application. %s", abc.Cfg.NodeId, r, err)
+						continue
 					}
 				}
 			}
+			plaintexts[d.i][d.j] = tx
+		case <-stop:
+			log.Printf("Node %d round %d: stopped decrypting block after %d of %d transactions", abc.Cfg.NodeId, r, decCounter, txsCount)
+			return nil, nil
 		}
 	}
 
-Done:
+	txs := make([][]byte, 0, decCounter)
+	src := newBlockSources(abc.Cfg.n, b)
+	large := len(b) == 1 && b[0].Size == "large"
+	ctSize := 0
+	if abc.Cfg.clientEnc {
+		ctSize = CiphertextSize(&abc.tcs.encPk)
+	}
+	for i := range plaintexts {
+		for j, tx := range plaintexts[i] {
+			if decrypted[i][j] && tx != nil {
+				txs = append(txs, tx)
+				// Ciphertexts of a large pre-block are indexed by node, of small pre-blocks by
+				// pre-block and node
+				proposer := j
+				if large {
+					proposer = i
+				}
+				src.add(proposer, tx)
+				if abc.Cfg.clientEnc && len(cts[i][j].Bytes()) <= ctSize {
+					src.addCiphertext(tx, cts[i][j].FillBytes(make([]byte, ctSize)))
+				}
+			}
+		}
+	}
 	//log.Printf("Node %d: done constructing block. Total of %d bytes", abc.cfg.nodeId, bytesCounter)
 	block := &utils.Block{
 		Txs:      txs,
-		TxsCount: bytesCounter / abc.Cfg.txSize,
+		TxsCount: len(txs),
 	}
 	// for _, tx := range txs {
 	// 	log.Printf("Node %d round %d: final txs: %s - %dB", abc.cfg.nodeId, r, tx, len(tx))
 	// }
-	return block
+	return block, src
 }
 
-// sendDecryptionShares sends for every tx in every block a decryption share
-func (abc *ABC) sendDecryptionShares(r int, acsOutput []*utils.BlockShare) {
-	decShares := make([][]*tcpaillier.DecryptionShare, len(acsOutput))
-	for i, bs := range acsOutput {
-		decShares[i] = make([]*tcpaillier.DecryptionShare, len(bs.Block.Vec))
-		for j, v := range bs.Block.Vec {
+// plaintextBlock returns the block of the unencrypted pre-blocks b in plaintext mode and the
+// proposers of its transactions. The transactions are ordered like the ciphertexts of encrypted
+// pre-blocks.
+func (abc *ABC) plaintextBlock(r int, b []*utils.PreBlock) (*utils.Block, *blockSources) {
+	// Every message of a large pre-block contains the frames of multiple transactions, every
+	// message of a small pre-block the frame of one transaction.
+	large := len(b) == 1 && b[0].Size == "large"
+	src := newBlockSources(abc.Cfg.n, b)
+	txs := make([][]byte, 0)
+	for _, pb := range b {
+		for node, v := range pb.Vec {
 			if v == nil {
+				continue
+			}
+			var frameTxs [][]byte
+			var err error
+			if large {
+				frameTxs, err = splitFrames(v.Message)
+			} else {
+				var tx []byte
+				if tx, err = decodeFrame(v.Message); err == nil {
+					frameTxs = [][]byte{tx}
+				}
+			}
+			if err != nil {
+				log.Printf("Node %d round %d: dropping malformed transaction. %s", abc.Cfg.NodeId, r, err)
+			}
+			for _, tx := range frameTxs {
+				if err := abc.checkTxValidity(tx); err != nil {
+					log.Printf("Node %d round %d: dropping invalid transaction. %s", abc.Cfg.NodeId, r, err)
+					continue
+				}
+				txs = append(txs, tx)
+				src.add(node, tx)
+			}
+		}
+	}
+	block := &utils.Block{
+		Txs:      txs,
+		TxsCount: len(txs),
+	}
+	return block, src
+}
+
+// decryption is the result of combining the decryption shares of a ciphertext.
+type decryption struct {
+	i, j      int // Index of the ciphertext
+	plaintext *big.Int
+	err       error
+}
+
+// ciphertexts returns the ciphertexts contained in the pre-blocks b. For a single large pre-block
+// the ciphertexts are indexed by node and position in the message of the node, for small
+// pre-blocks they are indexed by pre-block and node. Missing messages are nil.
+func (abc *ABC) ciphertexts(b []*utils.PreBlock) [][]*big.Int {
+	if len(b) == 1 && b[0].Size == "large" {
+		enclen := abc.tcs.encPk.N.BitLen() / 4
+		pb := b[0]
+		cts := make([][]*big.Int, len(pb.Vec))
+		for node, v := range pb.Vec {
+			if v == nil {
+				continue
+			}
+			for i := 0; i < len(v.Message); i += enclen {
+				end := i + enclen
+				if end > len(v.Message) {
+					end = len(v.Message)
+				}
+				cts[node] = append(cts[node], new(big.Int).SetBytes(v.Message[i:end]))
+			}
+		}
+		return cts
+	}
+
+	cts := make([][]*big.Int, len(b))
+	for i, pb := range b {
+		cts[i] = make([]*big.Int, len(pb.Vec))
+		for j, v := range pb.Vec {
+			if v != nil {
+				cts[i][j] = new(big.Int).SetBytes(v.Message)
+			}
+		}
+	}
+	return cts
+}
+
+// partialDecrypt creates a decryption share and a proof of its validity for every ciphertext.
+func (abc *ABC) partialDecrypt(r int, cts [][]*big.Int) ([][]*tcpaillier.DecryptionShare, [][]*tcpaillier.DecryptShareZK) {
+	decShares := make([][]*tcpaillier.DecryptionShare, len(cts))
+	proofs := make([][]*tcpaillier.DecryptShareZK, len(cts))
+	for i, row := range cts {
+		decShares[i] = make([]*tcpaillier.DecryptionShare, len(row))
+		proofs[i] = make([]*tcpaillier.DecryptShareZK, len(row))
+		for j, c := range row {
+			if c == nil {
 				log.Printf("Node %d round %d: got nil in blockvec", abc.Cfg.NodeId, r)
 				continue
 			}
-			tmp := new(big.Int)
-			tmp.SetBytes(v.Message)
-			decShare, err := abc.tcs.committeeKeys.encSk.PartialDecrypt(tmp)
+			decShare, proof, err := abc.tcs.committeeKeys.encSk.PartialDecryptWithProof(c)
 			if err != nil {
-				log.Printf("Node %d: is unable to partially decrypt message[%d]: %s. %s", abc.Cfg.NodeId, j, v.Message, err)
+				log.Printf("Node %d: is unable to partially decrypt message[%d][%d]. %s", abc.Cfg.NodeId, i, j, err)
 				continue
 			}
 			decShares[i][j] = decShare
+			proofs[i][j] = proof
 		}
 	}
+	return decShares, proofs
+}
+
+// verifyDecryptionShare returns an error if share is not a valid decryption share of ciphertext c
+// created by committee member sender. The index of the key share of a committee member is given by
+// its position in the committee, see utils.CommitteeIndex.
+func (abc *ABC) verifyDecryptionShare(sender int, c *big.Int, share *tcpaillier.DecryptionShare, proof *tcpaillier.DecryptShareZK) error {
+	pk := &abc.tcs.encPk
+	if proof == nil || proof.V == nil || proof.Vi == nil || proof.Z == nil || proof.E == nil || share.Ci == nil {
+		return errors.New("missing proof")
+	}
+	index, ok := utils.CommitteeIndex(abc.Cfg.committee, sender)
+	if !ok || int(share.Index) != index+1 || int(share.Index) > len(pk.Vi) {
+		return fmt.Errorf("share index %d doesn't belong to node %d", share.Index, sender)
+	}
+	// The verification keys in the proof are chosen by the sender, they have to match ours
+	if proof.V.Cmp(pk.V) != 0 || proof.Vi.Cmp(pk.Vi[share.Index-1]) != 0 {
+		return errors.New("proof uses wrong verification keys")
+	}
+	if proof.Z.Sign() < 0 || proof.E.Sign() < 0 {
+		return errors.New("malformed proof")
+	}
+	// Verification inverts the share, so it must be a unit modulo N^(s+1)
+	if share.Ci.Sign() <= 0 || share.Ci.Cmp(pk.Cache().NToSPlusOne) >= 0 || new(big.Int).GCD(nil, nil, share.Ci, pk.N).Cmp(big.NewInt(1)) != 0 {
+		return errors.New("share out of range")
+	}
+	return proof.Verify(pk, c, share)
+}
+
+// combineShares combines k of the verified decryption shares of a ciphertext. Every share was
+// checked against its proof and belongs to the key share of its sender, so the shares have
+// distinct indexes and any k of them yield the plaintext. CombineShares only fails for fewer than k
+// shares or repeated indexes, so there is no other subset of the shares to retry with.
+func (abc *ABC) combineShares(shares map[int]*tcpaillier.DecryptionShare) (*big.Int, error) {
+	nodes := make([]int, 0, len(shares))
+	for node := range shares {
+		nodes = append(nodes, node)
+	}
+	sort.Ints(nodes)
+	list := make([]*tcpaillier.DecryptionShare, len(nodes))
+	for i, node := range nodes {
+		list[i] = shares[node]
+	}
+	return abc.tcs.encPk.CombineShares(list...)
+}
+
+// sendDecryptionShares sends for every tx in every block a decryption share
+func (abc *ABC) sendDecryptionShares(r int, acsOutput []*utils.BlockShare) {
+	preBlocks := make([]*utils.PreBlock, len(acsOutput))
+	for i, bs := range acsOutput {
+		preBlocks[i] = bs.Block
+	}
+	decShares, proofs := abc.partialDecrypt(r, abc.ciphertexts(abc.limitPreBlocks(r, preBlocks)))
 
 	mes := &PbDecryptionShareMessage{
 		Sender:    abc.Cfg.NodeId,
 		DecShares: decShares,
+		Proofs:    proofs,
 	}
 	m := &utils.Message{
 		Sender:  abc.Cfg.NodeId,
@@ -478,83 +853,49 @@ func (abc *ABC) sendDecryptionShares(r int, acsOutput []*utils.BlockShare) {
 	abc.multicast(m, r)
 }
 
-func (abc *ABC) waitForMatchingBlock(r int, ptr *utils.BlockPointer, largeBlockChan chan *utils.PreBlock) {
-	done := false
-	for pb := range largeBlockChan {
+// waitForMatchingBlock waits until a large pre-block matching ptr is received, multicasts it and
+// multicasts decryption shares for it. It returns early if stop is closed.
+func (abc *ABC) waitForMatchingBlock(r int, ptr *utils.BlockPointer, largeBlockChan chan *utils.PreBlock, stop <-chan struct{}) {
+	for {
+		var pb *utils.PreBlock
+		select {
+		case pb = <-largeBlockChan:
+		case <-stop:
+			return
+		}
 		h := pb.Hash()
-		if done {
+		if !bytes.Equal(h[:], ptr.BlockHash) {
+			continue
+		}
+		// Multicast pre-block
+		pbmes := &PreBlockMessage{
+			Sender:   abc.Cfg.NodeId,
+			PreBlock: pb,
+		}
+		pbm := &utils.Message{
+			Sender:  abc.Cfg.NodeId,
+			Payload: pbmes,
+		}
+		//log.Printf("Node %d: multicasting matching pre-block", abc.cfg.nodeId)
+		abc.multicast(pbm, r)
+		if abc.Cfg.plaintext {
 			return
 		}
-		if bytes.Equal(h[:], ptr.BlockHash) {
-			// Multicast pre-block
-			pbmes := &PreBlockMessage{
-				Sender:   abc.Cfg.NodeId,
-				PreBlock: pb,
-			}
-			pbm := &utils.Message{
-				Sender:  abc.Cfg.NodeId,
-				Payload: pbmes,
-			}
-			//log.Printf("Node %d: multicasting matching pre-block", abc.cfg.nodeId)
-			abc.multicast(pbm, r)
-
-			// Multicast decryption shares
-			if pb.Size == "large" {
-				decShares := make([][]*tcpaillier.DecryptionShare, len(pb.Vec))
-				bitlen := abc.tcs.encPk.N.BitLen()
-				enclen := bitlen / 4
-				for node, v := range pb.Vec {
-					decShares[node] = make([]*tcpaillier.DecryptionShare, 0)
-					// Split Messages
-					for i := 0; i < len(v.Message); i += enclen {
-						end := i + enclen
-						if end > len(v.Message) {
-							end = len(v.Message)
-						}
-						tmp := new(big.Int)
-						tmp.SetBytes(v.Message[i:end])
-						decShare, err := abc.tcs.committeeKeys.encSk.PartialDecrypt(tmp)
-						if err != nil {
-							log.Printf("Node %d: is unable to partially decrypt message[%d]: %s. %s", abc.Cfg.NodeId, i, v.Message, err)
-							continue
-						}
-						decShares[node] = append(decShares[node], decShare)
-					}
-				}
-				mes := &PbDecryptionShareMessage{
-					Sender:    abc.Cfg.NodeId,
-					DecShares: decShares,
-				}
-				m := &utils.Message{
-					Sender:  abc.Cfg.NodeId,
-					Payload: mes,
-				}
-				abc.multicast(m, r)
-			} else {
-				decShares := make([]*tcpaillier.DecryptionShare, len(pb.Vec))
-				for i, v := range pb.Vec {
-					tmp := new(big.Int)
-					tmp.SetBytes(v.Message)
-					decShare, err := abc.tcs.committeeKeys.encSk.PartialDecrypt(tmp)
-					if err != nil {
-						log.Printf("Node %d: is unable to partially decrypt message[%d]: %s. %s", abc.Cfg.NodeId, i, v.Message, err)
-						continue
-					}
-					decShares[i] = decShare
-				}
-				mes := &PbDecryptionShareMessage{
-					Sender:    abc.Cfg.NodeId,
-					DecShares: [][]*tcpaillier.DecryptionShare{decShares},
-				}
-				m := &utils.Message{
-					Sender:  abc.Cfg.NodeId,
-					Payload: mes,
-				}
-				//log.Printf("Node %d: multicasting decrpytion share", abc.cfg.nodeId)
-				abc.multicast(m, r)
-			}
+
+		// Multicast decryption shares
+		decShares, proofs := abc.partialDecrypt(r, abc.ciphertexts(abc.limitPreBlocks(r, []*utils.PreBlock{pb})))
+		mes := &PbDecryptionShareMessage{
+			Sender:    abc.Cfg.NodeId,
+			DecShares: decShares,
+			Proofs:    proofs,
 		}
-		done = true
+		m := &utils.Message{
+			Sender:  abc.Cfg.NodeId,
+			Payload: mes,
+		}
+		//log.Printf("Node %d: multicasting decrpytion share", abc.cfg.nodeId)
+		abc.multicast(m, r)
+		return
 	}
 }
 
@@ -564,56 +905,29 @@ func (abc *ABC) isWellFormedBlockShare(bs *utils.BlockShare) bool {
 	if bs == nil {
 		return false
 	}
-	err := rsa.VerifyPKCS1v15(abc.tcs.keyMetaC.PublicKey, crypto.SHA256, bs.Pointer.BlockHash, bs.Pointer.Sig)
+	err := utils.VerifyThresholdSig(abc.tcs.keyMetaC, abc.tcs.sigHash(), bs.Pointer.BlockHash, bs.Pointer.Sig)
 	return err == nil
 }
 
 // handleLargeTransaction sends a blockMessage containing encrypted transactions w to the committee.
 func (abc *ABC) handleLargeTransaction(r int, w [][]byte) {
-	// Encrypt one by one and then merge
+	// Encrypt the frames one by one and then merge. All ciphertexts have the same size.
 	tx := make([]byte, 0)
-	for _, t := range w {
-		data := new(big.Int)
-		data.SetBytes(t)
-		d, _, err := abc.tcs.encPk.Encrypt(data)
+	for i, t := range w {
+		c, err := abc.encryptTx(t)
 		if err != nil {
-			log.Printf("Node %d round %d failed to encrypt tx %x", abc.Cfg.NodeId, r, t)
+			log.Printf("Node %d round %d failed to encrypt tx %x. %s", abc.Cfg.NodeId, r, t, err)
 			return
 		}
-		// In case encryption output is corrupted repeat
-		for len(d.Bytes()) != abc.tcs.encPk.N.BitLen()/4 {
-			data := new(big.Int)
-			data.SetBytes(t)
-			d, _, _ = abc.tcs.encPk.Encrypt(data)
+		if abc.Cfg.blockBytes > 0 && len(tx)+len(c) > abc.Cfg.blockBytes {
+			log.Printf("Node %d round %d: large block is full, proposing %d of %d transactions", abc.Cfg.NodeId, r, i, len(w))
+			break
 		}
-
-		tx = append(tx, d.Bytes()...)
-
+		tx = append(tx, c...)
 	}
 
 	// Sign resulting slice of encrypted transactions
-	h := sha256.Sum256(tx)
-	pH, err := tcrsa.PrepareDocumentHash(abc.tcs.keyMeta.PublicKey.Size(), crypto.SHA256, h[:])
-	if err != nil {
-		log.Printf("Node %d: failed to hash transaction %s", abc.Cfg.NodeId, tx)
-		return
-	}
-	sig, err := abc.tcs.sigSk.Sign(pH, crypto.SHA256, abc.tcs.keyMeta)
-	if err != nil {
-		log.Printf("Node %d: failed to sign transaction %s", abc.Cfg.NodeId, tx)
-		return
-	}
-
-	mes := &BlockMessage{
-		Sender:  abc.Cfg.NodeId,
-		Status:  "large",
-		Payload: tx,
-		Sig:     sig,
-	}
-	m := &utils.Message{
-		Sender:  abc.Cfg.NodeId,
-		Payload: mes,
-	}
+	m := abc.newBlockMessage(tx, "large")
 	// log.Printf("Node %d sending large block. Size: %d", abc.cfg.nodeId, len(tx))
 	// Only send to committee members
 	for i := 0; i < abc.Cfg.n; i++ {
@@ -623,65 +937,40 @@ func (abc *ABC) handleLargeTransaction(r int, w [][]byte) {
 	}
 }
 
-// handleSmallTransaction sends a blockMessage containing encrypted transaction tx to node i.
+// handleSmallTransaction sends a blockMessage containing the encrypted frame of transaction tx to
+// node i.
 func (abc *ABC) handleSmallTransaction(i, r int, tx []byte) {
-	data := new(big.Int)
-	data.SetBytes(tx)
-	m, err := abc.encryptAndSign(r, data, "small")
+	c, err := abc.encryptTx(tx)
 	if err != nil {
-		log.Printf("Node %d round %d: encryptAndSign failed: %s", abc.Cfg.NodeId, r, err)
+		log.Printf("Node %d round %d: failed to encrypt transaction: %s", abc.Cfg.NodeId, r, err)
 		return
 	}
-	abc.multicast(m, r, i)
+	abc.multicast(abc.newBlockMessage(c, "small"), r, i)
 }
 
-// encryptAndSign encrypts data, signs the hash of the encrypted value and returns a blockMessage
-// wrapped into a Message
-func (abc *ABC) encryptAndSign(r int, data *big.Int, status string) (*utils.Message, error) {
-	tx := string(data.Bytes())
-	// Encrypt transaction
-	e, _, err := abc.tcs.encPk.Encrypt(data)
-	if err != nil {
-		log.Printf("Node %d: failed to encrypt transaction %s", abc.Cfg.NodeId, tx)
-		return nil, err
-	}
-	// Sign encryption transaction
-	h := sha256.Sum256(e.Bytes())
-	pH, err := tcrsa.PrepareDocumentHash(abc.tcs.keyMeta.PublicKey.Size(), crypto.SHA256, h[:])
-	if err != nil {
-		log.Printf("Node %d: failed to hash transaction %s", abc.Cfg.NodeId, tx)
-		return nil, err
-	}
-	sig, err := abc.tcs.sigSk.Sign(pH, crypto.SHA256, abc.tcs.keyMeta)
-	if err != nil {
-		log.Printf("Node %d: failed to sign transaction %s", abc.Cfg.NodeId, tx)
-		return nil, err
-	}
+// newBlockMessage signs encrypted transactions and returns a blockMessage wrapped into a Message.
+func (abc *ABC) newBlockMessage(ct []byte, status string) *utils.Message {
+	pbMes := utils.NewPreBlockMessage(ct, status, abc.tcs.identity)
 	mes := &BlockMessage{
 		Sender:  abc.Cfg.NodeId,
 		Status:  status,
-		Payload: e.Bytes(),
-		Sig:     sig,
+		Payload: pbMes.Message,
+		Sig:     pbMes.Sig,
 	}
-	m := &utils.Message{
+	return &utils.Message{
 		Sender:  abc.Cfg.NodeId,
 		Payload: mes,
 	}
-	// log.Printf("Tx before enc: %d. Tx after enc: %d", len(data.Bytes()), len(e.Bytes()))
-	return m, nil
 }
 
 // handleSmallBlockMessage saves incoming blockMessages containing small blocks.
 func (abc *ABC) handleSmallBlockMessage(r, ta int, m *BlockMessage, b *utils.PreBlock, rdy *bool, mu *sync.Mutex, readyChan chan struct{}) {
+	if !abc.isValidBlockMessage(r, m) || !abc.withinBlockLimits(r, m) {
+		return
+	}
 	mu.Lock()
 	defer mu.Unlock()
-	if b.Vec[m.Sender] == nil {
-		pbMes := &utils.PreBlockMessage{
-			Message: m.Payload,
-			Sig:     m.Sig,
-		}
-		b.AddMessage(m.Sender, pbMes)
-
+	if abc.addBlockMessage(r, m, b) {
 		if b.Quality() >= abc.Cfg.n-ta && !*rdy {
 			*rdy = true
 			readyChan <- struct{}{}
@@ -691,25 +980,22 @@ func (abc *ABC) handleSmallBlockMessage(r, ta int, m *BlockMessage, b *utils.Pre
 
 // handleLargeBlockMessage saves incoming blockMessages containing large blocks.
 func (abc *ABC) handleLargeBlockMessage(r, ta int, m *BlockMessage, b *utils.PreBlock, rdy *bool, mu *sync.Mutex) {
+	if !abc.isValidBlockMessage(r, m) || !abc.withinBlockLimits(r, m) {
+		return
+	}
 	mu.Lock()
 	defer mu.Unlock()
-	if b.Vec[m.Sender] == nil {
-		pbMes := &utils.PreBlockMessage{
-			Message: m.Payload,
-			Sig:     m.Sig,
-		}
-		b.Vec[m.Sender] = pbMes
-
+	if abc.addBlockMessage(r, m, b) {
 		if b.Quality() >= abc.Cfg.n-ta && !*rdy {
 			//log.Printf("Node %d: has a %d-quality pre-block", abc.cfg.nodeId, b.Quality())
 			*rdy = true
 			h := b.Hash()
-			paddedHash, err := tcrsa.PrepareDocumentHash(abc.tcs.keyMetaC.PublicKey.Size(), crypto.SHA256, h[:])
+			paddedHash, err := utils.PrepareSigHash(abc.tcs.keyMetaC, abc.tcs.sigHash(), h[:])
 			if err != nil {
 				log.Printf("Node %d: failed to create a padded hash", abc.Cfg.NodeId)
 				return
 			}
-			sig, err := abc.tcs.committeeKeys.sigSk.Sign(paddedHash, crypto.SHA256, abc.tcs.keyMetaC)
+			sig, err := abc.tcs.committeeKeys.sigSk.Sign(paddedHash, abc.tcs.sigHash(), abc.tcs.keyMetaC)
 			if err != nil {
 				log.Printf("Node %d: failed to sign pre-block hash", abc.Cfg.NodeId)
 				return
@@ -719,7 +1005,7 @@ func (abc *ABC) handleLargeBlockMessage(r, ta int, m *BlockMessage, b *utils.Pre
 				PreBlock: b,
 				Hash:     h,
 				HashSig:  sig,
-				Proof:    abc.tcs.proof,
+				Sig:      abc.tcs.identity.Sign(committeeMessageDomain, committeeMessageHash(r, h)),
 			}
 			m := &utils.Message{
 				Sender:  abc.Cfg.NodeId,
@@ -737,6 +1023,69 @@ func (abc *ABC) handleLargeBlockMessage(r, ta int, m *BlockMessage, b *utils.Pre
 	}
 }
 
+// isValidBlockMessage returns whether a blockMessage carries a valid signature on its payload
+// that was created by the sender of the message.
+func (abc *ABC) isValidBlockMessage(r int, m *BlockMessage) bool {
+	if m == nil || m.Sig == nil || m.Payload == nil {
+		log.Printf("Node %d round %d: received corrupted block message", abc.Cfg.NodeId, r)
+		return false
+	}
+	if m.Sender < 0 || m.Sender >= abc.Cfg.n {
+		log.Printf("Node %d round %d: received block message with invalid sender %d", abc.Cfg.NodeId, r, m.Sender)
+		return false
+	}
+	// The signature covers the sender. This binds the message to the slot of its signer.
+	pbMes := &utils.PreBlockMessage{
+		Message: m.Payload,
+		Sig:     m.Sig,
+	}
+	if !pbMes.Verify(m.Sender, m.Status, abc.tcs.identity.Cert) {
+		log.Printf("Node %d round %d: received block message from %d with invalid signature", abc.Cfg.NodeId, r, m.Sender)
+		return false
+	}
+	return true
+}
+
+// withinBlockLimits returns whether a blockMessage carries no more transactions and bytes than
+// allowed for its status.
+func (abc *ABC) withinBlockLimits(r int, m *BlockMessage) bool {
+	if err := abc.checkBlockLimits(m.Status, m.Payload); err != nil {
+		log.Printf("Node %d round %d: dropping %s block message from %d. %s", abc.Cfg.NodeId, r, m.Status, m.Sender, err)
+		return false
+	}
+	return true
+}
+
+// addBlockMessage adds a valid blockMessage to the slot of its sender in the pre-block b and
+// returns whether it was added. A second message for the same slot is recorded as evidence
+// against the sender.
+func (abc *ABC) addBlockMessage(r int, m *BlockMessage, b *utils.PreBlock) bool {
+	if m.Sender >= len(b.Vec) {
+		log.Printf("Node %d round %d: no slot for block message from %d", abc.Cfg.NodeId, r, m.Sender)
+		return false
+	}
+	if prev := b.Vec[m.Sender]; prev != nil {
+		if bytes.Equal(prev.Message, m.Payload) {
+			abc.reportEvidence(r, m.Sender, "duplicate "+m.Status+" block message", m)
+		} else {
+			prevMes := &BlockMessage{
+				Sender:  m.Sender,
+				Status:  m.Status,
+				Payload: prev.Message,
+				Sig:     prev.Sig,
+			}
+			abc.reportEvidence(r, m.Sender, "conflicting "+m.Status+" block messages", prevMes, m)
+		}
+		return false
+	}
+	pbMes := &utils.PreBlockMessage{
+		Message: m.Payload,
+		Sig:     m.Sig,
+	}
+	b.AddMessage(m.Sender, pbMes)
+	return true
+}
+
 // handlePointerMessage saves a received block pointer, if the node has no current block pointer.
 // If the node is in the committee and receives a well-formed block pointer, it multicasts it
 func (abc *ABC) handlePointerMessage(r int, m *PointerMessage, ptr **utils.BlockPointer, mu *sync.Mutex, ptrChan chan struct{}) {
@@ -748,7 +1097,7 @@ func (abc *ABC) handlePointerMessage(r int, m *PointerMessage, ptr **utils.Block
 	}
 	// If node is in committee check if pointer is well-formed, multicast it
 	if abc.Cfg.committee[abc.Cfg.NodeId] {
-		err := rsa.VerifyPKCS1v15(abc.tcs.keyMetaC.PublicKey, crypto.SHA256, m.Pointer.BlockHash, m.Pointer.Sig)
+		err := utils.VerifyThresholdSig(abc.tcs.keyMetaC, abc.tcs.sigHash(), m.Pointer.BlockHash, m.Pointer.Sig)
 		if err != nil {
 			log.Printf("Node %d: received block pointer with invalid signature: %s", abc.Cfg.NodeId, err)
 			return
@@ -783,19 +1132,19 @@ func (abc *ABC) handleCommitteeMessage(r int, m *CommitteeMessage, ptr **utils.B
 		return
 	}
 	// If the committee message is invalid don't do anything
-	if !abc.isValidCommitteeMessage(m) {
+	if !abc.isValidCommitteeMessage(r, m) {
 		return
 	}
 	// Echo first valid committee messages received by any committee member, but only when the block
 	// pointer is nil.
 	if !mesRec[m.Sender] && ptr == nil {
 		mesRec[m.Sender] = true
-		paddedHash, err := tcrsa.PrepareDocumentHash(abc.tcs.keyMetaC.PublicKey.Size(), crypto.SHA256, m.Hash[:])
+		paddedHash, err := utils.PrepareSigHash(abc.tcs.keyMetaC, abc.tcs.sigHash(), m.Hash[:])
 		if err != nil {
 			log.Printf("Node %d: failed to hash pre-block", abc.Cfg.NodeId)
 			return
 		}
-		hashSig, err := abc.tcs.committeeKeys.sigSk.Sign(paddedHash, crypto.SHA256, abc.tcs.keyMeta)
+		hashSig, err := abc.tcs.committeeKeys.sigSk.Sign(paddedHash, abc.tcs.sigHash(), abc.tcs.keyMeta)
 		if err != nil {
 			log.Printf("Node %d: failed to sign hash of pre-block", abc.Cfg.NodeId)
 			return
@@ -805,7 +1154,7 @@ func (abc *ABC) handleCommitteeMessage(r int, m *CommitteeMessage, ptr **utils.B
 			PreBlock: m.PreBlock,
 			Hash:     m.Hash,
 			HashSig:  hashSig,
-			Proof:    abc.tcs.proof,
+			Sig:      abc.tcs.identity.Sign(committeeMessageDomain, committeeMessageHash(r, m.Hash)),
 		}
 		m := &utils.Message{
 			Sender:  abc.Cfg.NodeId,
@@ -828,7 +1177,7 @@ func (abc *ABC) handleCommitteeMessage(r int, m *CommitteeMessage, ptr **utils.B
 		for _, s := range blocksReceived[m.Hash] {
 			sigShares = append(sigShares, s)
 		}
-		h, err := tcrsa.PrepareDocumentHash(abc.tcs.keyMetaC.PublicKey.Size(), crypto.SHA256, m.Hash[:])
+		h, err := utils.PrepareSigHash(abc.tcs.keyMetaC, abc.tcs.sigHash(), m.Hash[:])
 		if err != nil {
 			log.Printf("Node %d: failed to pad block hash", abc.Cfg.NodeId)
 			return
@@ -858,29 +1207,27 @@ func (abc *ABC) handleCommitteeMessage(r int, m *CommitteeMessage, ptr **utils.B
 
 // isValidCommitteeMessage returns whether a message from a committee member is valid. Three
 // conditions must hold:
-// 1. The signature on the id is valid.
+// 1. The sender is a committee member and signed the message with its identity key.
 // 2. The signature of the hash is valid.
 // 3. The hash matches the hashed pre-block
-func (abc *ABC) isValidCommitteeMessage(m *CommitteeMessage) bool {
-	if m == nil || m.HashSig == nil || m.Proof == nil || m.PreBlock == nil {
+func (abc *ABC) isValidCommitteeMessage(r int, m *CommitteeMessage) bool {
+	if m == nil || m.HashSig == nil || m.Sig == nil || m.PreBlock == nil {
 		log.Printf("Received corrupted committee message")
 		return false
 	}
 	// Condition 1:
-	hash := sha256.Sum256([]byte(strconv.Itoa(m.Sender)))
-	paddedHash, err := tcrsa.PrepareDocumentHash(abc.tcs.keyMeta.PublicKey.Size(), crypto.SHA256, hash[:])
-	if err != nil {
-		log.Printf("Node %d: was unable to hash sender id", abc.Cfg.NodeId)
+	if !abc.tcs.identity.Cert.IsCommittee(m.Sender) {
+		log.Printf("Node %d: received committee message from non-committee member %d", abc.Cfg.NodeId, m.Sender)
 		return false
 	}
-	if err = m.Proof.Verify(paddedHash, abc.tcs.keyMeta); err != nil {
-		log.Printf("Node %d: received invalid committee message: invalid id proof", abc.Cfg.NodeId)
+	if !abc.tcs.identity.Cert.VerifySig(m.Sender, committeeMessageDomain, committeeMessageHash(r, m.Hash), m.Sig) {
+		log.Printf("Node %d: received invalid committee message: invalid signature of sender %d", abc.Cfg.NodeId, m.Sender)
 		return false
 	}
 
 	// Condition 2:
 	// Use committee exclusive pki
-	paddedHash, err = tcrsa.PrepareDocumentHash(abc.tcs.keyMetaC.PublicKey.Size(), crypto.SHA256, m.Hash[:])
+	paddedHash, err := utils.PrepareSigHash(abc.tcs.keyMetaC, abc.tcs.sigHash(), m.Hash[:])
 	if err != nil {
 		log.Printf("Node %d: unable to pad block hash", abc.Cfg.NodeId)
 		return false
@@ -898,37 +1245,164 @@ func (abc *ABC) isValidCommitteeMessage(m *CommitteeMessage) bool {
 	return true
 }
 
+// committeeMessageHash returns a sha256 hash over the round and the hash of a pre-block.
+func committeeMessageHash(r int, hash [32]byte) [32]byte {
+	return utils.NewEncoder(committeeMessageHashDomain).Int(r).Hash(hash).Sum()
+}
+
 // proposeTxs chooses l values v1, ..., vl uniformaly at random (without replacement) from the first
-// m values in buf.
+// m values in the mempool. If there are less than l transactions all of them are proposed. With
+// ProposeByHash the values are chosen from the own partition of the mempool first.
 func (abc *ABC) proposeTxs(l, m int) [][]byte {
-	abc.Lock()
-	defer abc.Unlock()
-	if m > len(abc.buf) {
-		m = len(abc.buf)
+	if abc.Cfg.proposal != ProposeByHash {
+		return abc.mempool.Sample(l, m)
 	}
-	indices := make(map[int]bool)
-	result := make([][]byte, 0)
-	for j := 0; j < l; j++ {
-		i := rand.Intn(m)
-		for indices[i] {
-			i = rand.Intn(m)
-		}
-		indices[i] = true
-		result = append(result, abc.buf[i])
+	n := abc.Cfg.n
+	nodeId := abc.Cfg.NodeId
+	return abc.mempool.SamplePreferred(l, m, func(h [32]byte) bool {
+		return partition(h, n) == nodeId
+	})
+}
+
+// proposeBatches returns the small transactions for the small blocks and the large transactions for
+// the large block of a round, sampled from the first m transactions in the mempool. With
+// ProposeByHash both are chosen at once, so they don't overlap.
+func (abc *ABC) proposeBatches(small, large, m int) ([][]byte, [][]byte) {
+	if abc.Cfg.proposal != ProposeByHash {
+		return abc.proposeTxs(small, m), abc.proposeTxs(large, m)
+	}
+	txs := abc.proposeTxs(small+large, m)
+	if len(txs) <= small {
+		return txs, [][]byte{}
 	}
+	return txs[:small], txs[small:]
+}
 
-	return result
+// partition returns the node whose partition of the mempool contains the transaction with hash h.
+func partition(h [32]byte, n int) int {
+	return int(binary.BigEndian.Uint64(h[:8]) % uint64(n))
 }
 
-// FillBuffer appends a slice of transactions to the buffer.
+// FillBuffer adds a slice of transactions to the mempool. Transactions rejected by the application,
+// transactions of invalid size and transactions that are already in the mempool are dropped.
 func (abc *ABC) FillBuffer(txs [][]byte) {
+	for _, tx := range txs {
+		if err := abc.addTx(tx); err != nil && err != ErrDuplicateTx {
+			log.Printf("Node %d: dropping rejected transaction: %s", abc.Cfg.NodeId, err)
+		}
+	}
+}
+
+// SubmitTx checks a transaction with the application and adds it to the mempool. It returns the
+// error of the application or of the external validity if the transaction is rejected, ErrTxSize
+// if its size is out of bounds, ErrReplayedTx if the nonce of its envelope was already used and
+// ErrDuplicateTx if it is already in the mempool.
+func (abc *ABC) SubmitTx(tx []byte) error {
+	return abc.addTx(tx)
+}
+
+// addTx checks the size, the validity and the nonce of a transaction and checks it with the
+// application before adding it to the mempool. Transactions encrypted by a client are only checked
+// to be ciphertexts, the remaining checks are done after they were decrypted.
+func (abc *ABC) addTx(tx []byte) error {
+	if abc.Cfg.clientEnc {
+		if err := abc.checkCiphertext(tx); err != nil {
+			return err
+		}
+		return abc.addToMempool(tx)
+	}
+	if err := abc.checkTxSize(tx); err != nil {
+		return err
+	}
+	if err := abc.checkTxValidity(tx); err != nil {
+		return err
+	}
+	if err := abc.checkNonce(tx); err != nil {
+		return err
+	}
+	if abc.app != nil {
+		if err := abc.app.CheckTx(tx); err != nil {
+			return err
+		}
+	}
+	return abc.addToMempool(tx)
+}
+
+// addToMempool adds a checked transaction to the mempool and queues it for the gossip.
+func (abc *ABC) addToMempool(tx []byte) error {
+	evicted, err := abc.mempool.Add(tx)
+	if evicted > 0 {
+		log.Printf("Node %d: mempool is full, evicted %d transactions", abc.Cfg.NodeId, evicted)
+	}
+	if err == nil {
+		abc.queueAnnouncement(sha256.Sum256(tx))
+	}
+	return err
+}
+
+// PendingTxs returns the number of transactions in the mempool.
+func (abc *ABC) PendingTxs() int {
+	return abc.mempool.Len()
+}
+
+// SetDropHandler sets a function that is called with the hash of every transaction that is evicted
+// from the full mempool or expires in it, together with ErrTxEvicted or ErrTxExpired. With client
+// encryption it is also called with ErrTxRejected for ciphertexts whose transaction was dropped
+// from the block after decryption. It may be called while the mempool is locked and must not use
+// the node.
+func (abc *ABC) SetDropHandler(f func(h [32]byte, reason error)) {
+	abc.Lock()
+	abc.onDrop = f
+	abc.Unlock()
+	abc.mempool.SetDropHandler(f)
+}
+
+// SetStore sets the storage for finalized blocks and recovers the blocks of rounds that were
+// finalized before a restart. Rounds that were running during a crash are caught up on from the
+// peers, the node doesn't run the agreement of a round again. It must be called before Run.
+func (abc *ABC) SetStore(store Store) error {
+	blocks, err := store.Blocks()
+	if err != nil {
+		return err
+	}
+	// Detect blocks that were tampered with
+	for r := range blocks {
+		if err = verifyBlock(blocks, r); err != nil {
+			return fmt.Errorf("invalid block in round %d: %w", r, err)
+		}
+	}
+	if len(blocks) > 0 {
+		log.Printf("Node %d: recovered %d finalized blocks", abc.Cfg.NodeId, len(blocks))
+	}
+
 	abc.Lock()
 	defer abc.Unlock()
-	for _, tx := range txs {
-		h := sha256.Sum256(tx)
-		abc.latency[h] = time.Now()
+	abc.store = store
+	abc.blocks = blocks
+	for r, block := range blocks {
+		abc.ledger.add(r, block.Txs)
+		if ch, ok := abc.finalized[r]; ok {
+			close(ch)
+			delete(abc.finalized, r)
+		}
 	}
-	abc.buf = append(abc.buf, txs...)
+	return nil
+}
+
+// isFinalized returns whether the block of round r is known.
+func (abc *ABC) isFinalized(r int) bool {
+	abc.Lock()
+	defer abc.Unlock()
+	_, ok := abc.blocks[r]
+	return ok
+}
+
+// GetBlock returns the block of round r if it is finalized.
+func (abc *ABC) GetBlock(r int) (*utils.Block, bool) {
+	abc.Lock()
+	defer abc.Unlock()
+	block, ok := abc.blocks[r]
+	return block, ok
 }
 
 // GetBlocks returns a copy of the blocks.
@@ -1,8 +1,8 @@
 package tardigrade
 
 import (
-	"crypto"
-	"crypto/sha256"
+	"bytes"
+	"encoding/gob"
 	"fmt"
 
 	// "io/ioutil"
@@ -10,6 +10,7 @@ import (
 	// "os"
 	"time"
 
+	"math/big"
 	"math/rand"
 	"strconv"
 	"sync"
@@ -34,7 +35,7 @@ type testConfig struct {
 	sigKeys    tcrsa.KeyShareList     // List of keyShares of the signature scheme
 	keyMeta    *tcrsa.KeyMeta         // keyMeta of the signature scheme
 	pk         tcpaillier.PubKey      // public key of the encryption scheme
-	proofs     []*tcrsa.SigShare      // List of signed node ids by the dealer
+	identities []*utils.Identity      // Identity keys and membership certificate
 	keyMetaC   *tcrsa.KeyMeta         // KeyMeta for committee members
 	sigKeysC   []*tcrsa.KeyShare      // Signings keys for committee members
 	encKeysC   []*tcpaillier.KeyShare // Private encryption keys for committee members
@@ -46,9 +47,9 @@ type testConfig struct {
 // }
 
 func simpleTestInstance(n int) *ABC {
-	buf := make([][]byte, 10)
+	mempool := NewMempool(0, 0)
 	for i := 0; i < 10; i++ {
-		buf[i] = []byte(strconv.Itoa(i))
+		mempool.Add([]byte(strconv.Itoa(i)))
 	}
 	committee := make(map[int]bool)
 	committee[0] = true
@@ -66,7 +67,7 @@ func simpleTestInstance(n int) *ABC {
 		acss: nil,
 		blas: nil,
 		tcs: nil,
-		buf: buf,
+		mempool: mempool,
 	}
 	return u
 }
@@ -168,7 +169,7 @@ func setupSimulation(cfg *testConfig) []*ABC {
 		tcs := &tcs{
 			keyMeta:       cfg.keyMeta,
 			keyMetaC:      cfg.keyMetaC,
-			proof:         cfg.proofs[i],
+			identity:      cfg.identities[i],
 			sigSk:         cfg.sigKeys[i],
 			encPk:         cfg.pk,
 			committeeKeys: nil,
@@ -191,7 +192,7 @@ func setupSimulation(cfg *testConfig) []*ABC {
 			lambda:     cfg.lambda,
 			epsilon:    cfg.epsilon,
 			committee:  cfg.committee,
-			txSize:     cfg.txSize,
+			maxTxSize:  cfg.txSize,
 			leaderFunc: leaderFunc,
 			handlerFuncs:    handlers[i].Funcs,
 		}
@@ -225,16 +226,10 @@ func setupConfig(n, ta, ts, kappa, delta, epsilon, lambda int, txSize int) *test
 
 	start := time.Now()
 	sigKeys, keyMeta, pk, sigKeysC, keyMetaC, encKeysC := setupKeys(n, committee)
-	signedIds := make([]*tcrsa.SigShare, n)
-	// Dealer signs node ids (dealer is node 0 in this case)
-	for i := 0; i < n; i++ {
-		hash := sha256.Sum256([]byte(strconv.Itoa(i)))
-		paddedHash, _ := tcrsa.PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, hash[:])
-		sig, err := sigKeys[0].Sign(paddedHash, crypto.SHA256, keyMeta)
-		if err != nil {
-			panic(err)
-		}
-		signedIds[i] = sig
+	// Dealer creates identity keys and the membership certificate
+	identities, err := utils.NewIdentities(n, 0, committee, sigKeys, keyMeta)
+	if err != nil {
+		panic(err)
 	}
 	fmt.Println("Key setup took", time.Since(start))
 	cfg := &testConfig{
@@ -249,7 +244,7 @@ func setupConfig(n, ta, ts, kappa, delta, epsilon, lambda int, txSize int) *test
 		sigKeys:   sigKeys,
 		keyMeta:   keyMeta,
 		pk:        *pk,
-		proofs:    signedIds,
+		identities: identities,
 		keyMetaC:  keyMetaC,
 		sigKeysC:  sigKeysC,
 		encKeysC:  encKeysC,
@@ -279,3 +274,443 @@ func setupKeys(n int, committee map[int]bool) (tcrsa.KeyShareList, *tcrsa.KeyMet
 
 	return keyShares, keyMeta, pk, keySharesC, keyMetaC, shares
 }
+
+func TestDecryptionShareVerification(t *testing.T) {
+	shares, pk, err := tcpaillier.NewKey(512, 1, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	committee := map[int]bool{0: true, 1: true, 2: true}
+	u := &ABC{
+		Cfg: &ABCConfig{
+			n:         3,
+			NodeId:    0,
+			committee: committee,
+		},
+		tcs: &tcs{
+			encPk: *pk,
+		},
+	}
+
+	c, _, err := pk.Encrypt(new(big.Int).SetBytes(encodeFrame([]byte("tx"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decShares := make(map[int]*tcpaillier.DecryptionShare)
+	proofs := make(map[int]*tcpaillier.DecryptShareZK)
+	for i, share := range shares {
+		ds, zk, err := share.PartialDecryptWithProof(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decShares[i] = ds
+		proofs[i] = zk
+	}
+
+	t.Run("Accepts valid shares", func(t *testing.T) {
+		for i := range shares {
+			if err := u.verifyDecryptionShare(i, c, decShares[i], proofs[i]); err != nil {
+				t.Errorf("Valid share of node %d got rejected: %s", i, err)
+			}
+		}
+	})
+
+	t.Run("Rejects invalid shares", func(t *testing.T) {
+		forged := &tcpaillier.DecryptionShare{
+			Index: decShares[1].Index,
+			Ci:    new(big.Int).Add(decShares[1].Ci, big.NewInt(1)),
+		}
+		if err := u.verifyDecryptionShare(1, c, forged, proofs[1]); err == nil {
+			t.Errorf("Forged share got accepted")
+		}
+		if err := u.verifyDecryptionShare(2, c, decShares[1], proofs[1]); err == nil {
+			t.Errorf("Share of another node got accepted")
+		}
+		if err := u.verifyDecryptionShare(1, c, decShares[1], nil); err == nil {
+			t.Errorf("Share without proof got accepted")
+		}
+		other, _, _ := pk.Encrypt(big.NewInt(42))
+		if err := u.verifyDecryptionShare(1, other, decShares[1], proofs[1]); err == nil {
+			t.Errorf("Share for another ciphertext got accepted")
+		}
+	})
+
+	t.Run("Maps senders to key shares by their position in the committee", func(t *testing.T) {
+		v := &ABC{
+			Cfg: &ABCConfig{
+				n:         6,
+				NodeId:    0,
+				committee: map[int]bool{1: true, 3: true, 5: true},
+			},
+			tcs: u.tcs,
+		}
+		for i, sender := range []int{1, 3, 5} {
+			if err := v.verifyDecryptionShare(sender, c, decShares[i], proofs[i]); err != nil {
+				t.Errorf("Valid share of node %d got rejected: %s", sender, err)
+			}
+		}
+		if err := v.verifyDecryptionShare(3, c, decShares[2], proofs[2]); err == nil {
+			t.Errorf("Share of node 5 got accepted from node 3")
+		}
+	})
+
+	t.Run("Constructs block despite a malicious committee member", func(t *testing.T) {
+		mes := &utils.PreBlockMessage{Message: c.Bytes()}
+		pb := utils.NewPreBlock(1)
+		pb.AddMessage(0, mes)
+		decChan := make(chan *PbDecryptionShareMessage, 3)
+		// Node 0 sends a garbage share first
+		decChan <- &PbDecryptionShareMessage{
+			Sender:    0,
+			DecShares: [][]*tcpaillier.DecryptionShare{{{Index: 1, Ci: big.NewInt(2)}}},
+			Proofs:    [][]*tcpaillier.DecryptShareZK{{proofs[0]}},
+		}
+		for i := 1; i < 3; i++ {
+			decChan <- &PbDecryptionShareMessage{
+				Sender:    i,
+				DecShares: [][]*tcpaillier.DecryptionShare{{decShares[i]}},
+				Proofs:    [][]*tcpaillier.DecryptShareZK{{proofs[i]}},
+			}
+		}
+		block, _ := u.constructBlock(0, []*utils.PreBlock{pb}, decChan, newDeadline(5*time.Second))
+		if len(block.Txs) != 1 || string(block.Txs[0]) != "tx" {
+			t.Errorf("Expected block containing %q, got %q", "tx", block.Txs)
+		}
+		evidence := u.GetEvidence()
+		if len(evidence) != 1 || evidence[0].Node != 0 {
+			t.Errorf("Expected evidence against node 0, got %v", evidence)
+		}
+	})
+
+	t.Run("Doesn't finish with a partial block", func(t *testing.T) {
+		mes := &utils.PreBlockMessage{Message: c.Bytes()}
+		pb := utils.NewPreBlock(1)
+		pb.AddMessage(0, mes)
+		decChan := make(chan *PbDecryptionShareMessage, 1)
+		// Only one share arrives, so the ciphertext can't be decrypted until the node stops
+		decChan <- &PbDecryptionShareMessage{
+			Sender:    1,
+			DecShares: [][]*tcpaillier.DecryptionShare{{decShares[1]}},
+			Proofs:    [][]*tcpaillier.DecryptShareZK{{proofs[1]}},
+		}
+		block, src := u.constructBlock(0, []*utils.PreBlock{pb}, decChan, newDeadline(10*time.Millisecond))
+		if block != nil || src != nil {
+			t.Errorf("Expected no block, got %d transactions", len(block.Txs))
+		}
+	})
+}
+
+// newDeadline returns a channel that gets closed after d.
+func newDeadline(d time.Duration) <-chan struct{} {
+	c := make(chan struct{})
+	time.AfterFunc(d, func() {
+		close(c)
+	})
+	return c
+}
+
+func TestBlockTransactionOrder(t *testing.T) {
+	shares, pk, err := tcpaillier.NewKey(512, 1, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &ABC{
+		Cfg: &ABCConfig{
+			n:         2,
+			NodeId:    0,
+			committee: map[int]bool{0: true, 1: true},
+			maxTxSize: 3,
+		},
+		tcs: &tcs{
+			encPk: *pk,
+		},
+	}
+
+	// Two small pre-blocks with one transaction each
+	txs := []string{"foo", "bar"}
+	pbs := make([]*utils.PreBlock, len(txs))
+	for i, tx := range txs {
+		c, _, err := pk.Encrypt(new(big.Int).SetBytes(encodeFrame([]byte(tx))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pbs[i] = utils.NewPreBlock(2)
+		pbs[i].AddMessage(1, &utils.PreBlockMessage{Message: c.Bytes()})
+	}
+	cts := u.ciphertexts(pbs)
+
+	// The shares of the second transaction arrive first
+	decChan := make(chan *PbDecryptionShareMessage, 2*len(txs))
+	for _, i := range []int{1, 0} {
+		for node, share := range shares {
+			ds, zk, err := share.PartialDecryptWithProof(cts[i][1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := &PbDecryptionShareMessage{
+				Sender:    node,
+				DecShares: make([][]*tcpaillier.DecryptionShare, len(cts)),
+				Proofs:    make([][]*tcpaillier.DecryptShareZK, len(cts)),
+			}
+			m.DecShares[i] = []*tcpaillier.DecryptionShare{nil, ds}
+			m.Proofs[i] = []*tcpaillier.DecryptShareZK{nil, zk}
+			decChan <- m
+		}
+	}
+
+	block, _ := u.constructBlock(0, pbs, decChan, newDeadline(5*time.Second))
+	if len(block.Txs) != len(txs) {
+		t.Fatalf("Expected %d transactions, got %d", len(txs), len(block.Txs))
+	}
+	for i, tx := range txs {
+		if string(block.Txs[i]) != tx {
+			t.Errorf("Expected %q at position %d, got %q", tx, i, block.Txs[i])
+		}
+	}
+}
+
+func TestIdenticalBlocks(t *testing.T) {
+	n := 4
+	maxRounds := 3
+	cfg := setupConfig(n, 0, 0, 2, 1, 0, 10, 8)
+	abcs := setupSimulation(cfg)
+	cfgs := make(map[int]*utils.RoundConfig)
+	for i := 0; i < maxRounds; i++ {
+		cfgs[i] = &utils.RoundConfig{
+			Ta:      0,
+			Ts:      0,
+			Crashed: map[int]bool{},
+		}
+	}
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		i := i
+		go func() {
+			defer wg.Done()
+			abcs[i].Run(maxRounds, cfgs, time.Now())
+		}()
+	}
+	wg.Wait()
+
+	// Every node has to finalize byte-identical blocks
+	for r := 0; r < maxRounds; r++ {
+		var expected []byte
+		for i := 0; i < n; i++ {
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(abcs[i].GetBlocks()[r]); err != nil {
+				t.Fatal(err)
+			}
+			if i == 0 {
+				expected = buf.Bytes()
+			} else if !bytes.Equal(buf.Bytes(), expected) {
+				t.Errorf("Block of node %d in round %d differs from the block of node 0", i, r)
+			}
+		}
+	}
+}
+
+func TestIdenticalBlocksAfterDecryptionTimeout(t *testing.T) {
+	n := 4
+	maxRounds := 3
+	cfg := setupConfig(n, 0, 0, 2, 1, 0, 10, 8)
+	abcs := setupSimulation(cfg)
+	cfgs := make(map[int]*utils.RoundConfig)
+	for i := 0; i < maxRounds; i++ {
+		cfgs[i] = &utils.RoundConfig{
+			Ta:      0,
+			Ts:      0,
+			Crashed: map[int]bool{},
+		}
+	}
+	// Node 3 isn't in the committee and never receives decryption shares, so it hits the
+	// decryption timeout in every round while the other nodes decrypt their blocks.
+	slow := abcs[n-1]
+	slow.Cfg.decTimeout = 50 * time.Millisecond
+	receive := slow.receive
+	slow.receive = func(round int) *utils.Message {
+		for {
+			msg := receive(round)
+			if _, ok := msg.Payload.(*PbDecryptionShareMessage); !ok {
+				return msg
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		i := i
+		go func() {
+			defer wg.Done()
+			abcs[i].Run(maxRounds, cfgs, time.Now())
+		}()
+	}
+	wg.Wait()
+
+	for r := 0; r < maxRounds; r++ {
+		expected := abcs[0].GetBlocks()[r]
+		if expected == nil {
+			t.Fatalf("Node 0 has no block in round %d", r)
+		}
+		for i := 1; i < n; i++ {
+			block := abcs[i].GetBlocks()[r]
+			if block == nil || block.Hash() != expected.Hash() {
+				t.Errorf("Block of node %d in round %d differs from the block of node 0", i, r)
+			}
+		}
+	}
+	if expected := abcs[0].GetBlocks()[0]; expected != nil && expected.TxsCount == 0 {
+		t.Errorf("Expected transactions in the block of round 0")
+	}
+}
+
+func TestDelayedParent(t *testing.T) {
+	n := 4
+	maxRounds := 4
+	cfg := setupConfig(n, 0, 0, 2, 1, 0, 10, 8)
+	abcs := setupSimulation(cfg)
+	cfgs := make(map[int]*utils.RoundConfig)
+	for i := 0; i < maxRounds; i++ {
+		cfgs[i] = &utils.RoundConfig{
+			Ta:      0,
+			Ts:      0,
+			Crashed: map[int]bool{},
+		}
+	}
+	// Node 3 can't decrypt the block of round 0 and the sync responses of its peers are delayed
+	// by a few seconds. Its later rounds are decrypted before and have to wait for round 0.
+	slow := abcs[n-1]
+	slow.Cfg.decTimeout = 500 * time.Millisecond
+	delayed := time.Now().Add(4 * time.Second)
+	receive := slow.receive
+	slow.receive = func(round int) *utils.Message {
+		for {
+			msg := receive(round)
+			switch msg.Payload.(type) {
+			case *PbDecryptionShareMessage:
+				if round == 0 {
+					continue
+				}
+			case *SyncResponse:
+				if time.Now().Before(delayed) {
+					continue
+				}
+			}
+			return msg
+		}
+	}
+	done := make(chan struct{})
+	defer close(done)
+	commits := slow.Commits(0, done)
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		i := i
+		go func() {
+			defer wg.Done()
+			abcs[i].Run(maxRounds, cfgs, time.Now())
+		}()
+	}
+	wg.Wait()
+
+	for r := 0; r < maxRounds; r++ {
+		select {
+		case c := <-commits:
+			expected := abcs[0].GetBlocks()[r]
+			if c.Round != r || expected == nil || c.Block.Hash() != expected.Hash() {
+				t.Errorf("Expected the block of node 0 in round %d, got round %d", r, c.Round)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Round %d wasn't committed", r)
+		}
+	}
+}
+
+func TestBlockMessageVerification(t *testing.T) {
+	n := 4
+	keyShares, keyMeta, err := tcrsa.NewKey(512, uint16(n/2+1), uint16(n), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identities, err := utils.NewIdentities(n, 0, map[int]bool{0: true}, keyShares, keyMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &ABC{
+		Cfg: &ABCConfig{
+			n:         n,
+			NodeId:    0,
+			committee: map[int]bool{0: true},
+		},
+		tcs: &tcs{
+			keyMeta:  keyMeta,
+			identity: identities[0],
+		},
+	}
+	// newBlockMessage returns a block message from sender signed with the identity key of signer
+	newBlockMessage := func(sender, signer int, payload []byte) *BlockMessage {
+		pbMes := utils.NewPreBlockMessage(payload, "small", identities[signer])
+		return &BlockMessage{
+			Sender:  sender,
+			Status:  "small",
+			Payload: pbMes.Message,
+			Sig:     pbMes.Sig,
+		}
+	}
+
+	var mu sync.Mutex
+	rdy := false
+	readyChan := make(chan struct{}, 1)
+	pb := utils.NewPreBlock(n)
+
+	t.Run("Rejects forged block messages", func(t *testing.T) {
+		// Node 1 tries to fill the slot of node 2
+		u.handleSmallBlockMessage(0, 0, newBlockMessage(2, 1, []byte("foo")), pb, &rdy, &mu, readyChan)
+		if pb.Vec[2] != nil {
+			t.Errorf("Block message signed by another node got accepted")
+		}
+		// Signature on a different payload
+		m := newBlockMessage(2, 2, []byte("foo"))
+		m.Payload = []byte("bar")
+		u.handleSmallBlockMessage(0, 0, m, pb, &rdy, &mu, readyChan)
+		if pb.Vec[2] != nil {
+			t.Errorf("Block message with invalid signature got accepted")
+		}
+		// Missing signature
+		m.Sig = nil
+		u.handleSmallBlockMessage(0, 0, m, pb, &rdy, &mu, readyChan)
+		if pb.Vec[2] != nil {
+			t.Errorf("Block message without signature got accepted")
+		}
+		if len(u.GetEvidence()) != 0 {
+			t.Errorf("Forged messages shouldn't create evidence against the claimed sender")
+		}
+	})
+
+	t.Run("Accepts valid block messages", func(t *testing.T) {
+		u.handleSmallBlockMessage(0, 0, newBlockMessage(2, 2, []byte("foo")), pb, &rdy, &mu, readyChan)
+		if pb.Vec[2] == nil || string(pb.Vec[2].Message) != "foo" {
+			t.Errorf("Valid block message didn't get added to the slot of the sender")
+		}
+	})
+
+	t.Run("Records duplicate and conflicting block messages", func(t *testing.T) {
+		u.handleSmallBlockMessage(0, 0, newBlockMessage(2, 2, []byte("foo")), pb, &rdy, &mu, readyChan)
+		u.handleSmallBlockMessage(0, 0, newBlockMessage(2, 2, []byte("baz")), pb, &rdy, &mu, readyChan)
+		if string(pb.Vec[2].Message) != "foo" {
+			t.Errorf("Conflicting block message replaced the first one")
+		}
+		evidence := u.GetEvidence()
+		if len(evidence) != 2 {
+			t.Fatalf("Expected %d pieces of evidence, got %d", 2, len(evidence))
+		}
+		if evidence[0].Node != 2 || len(evidence[0].Messages) != 1 {
+			t.Errorf("Expected evidence of a duplicate from node 2, got %v", evidence[0])
+		}
+		if evidence[1].Node != 2 || len(evidence[1].Messages) != 2 {
+			t.Errorf("Expected evidence of conflicting messages from node 2, got %v", evidence[1])
+		}
+	})
+}
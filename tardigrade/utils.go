@@ -1,7 +1,10 @@
 package tardigrade
 
 import (
+	"crypto"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/niclabs/tcpaillier"
 	"github.com/niclabs/tcrsa"
@@ -12,27 +15,35 @@ import (
 	utils "github.com/sochsenreither/tardigrade/utils"
 )
 
+// Default for the time a node waits for the decryption of a block before it catches up on it
+const defaultDecryptionTimeout = 30 * time.Second
+
 type tcs struct {
 	keyMeta       *tcrsa.KeyMeta    // KeyMeta containig pks for verifying
 	keyMetaC      *tcrsa.KeyMeta    // KeyMeta containig pks for verifying committee signatures
-	proof         *tcrsa.SigShare   // Signature on the node index signed by the dealer
+	identity      *utils.Identity   // Identity key and membership certificate
 	sigSk         *tcrsa.KeyShare   // Private signing key
 	encPk         tcpaillier.PubKey // Public encryption key
 	committeeKeys *committeeKeys
 	sync.Mutex
 }
 
+// sigHash returns the hash function of the threshold signatures chosen by the dealer.
+func (tcs *tcs) sigHash() crypto.Hash {
+	return tcs.identity.Cert.SignatureHash()
+}
+
 // These keys are only used for signing committee messages and creating decryption shares
 type committeeKeys struct {
 	sigSk *tcrsa.KeyShare      // Private signing key
 	encSk *tcpaillier.KeyShare // Private encryption key
 }
 
-func NewTcs(keyShare *tcrsa.KeyShare, keyMeta, keyMetaCommittee *tcrsa.KeyMeta, pk *tcpaillier.PubKey, proof *tcrsa.SigShare, keyShareCommitte *tcrsa.KeyShare, decryptionShare *tcpaillier.KeyShare) *tcs {
+func NewTcs(keyShare *tcrsa.KeyShare, keyMeta, keyMetaCommittee *tcrsa.KeyMeta, pk *tcpaillier.PubKey, identity *utils.Identity, keyShareCommitte *tcrsa.KeyShare, decryptionShare *tcpaillier.KeyShare) *tcs {
 	tcs := &tcs{
 		keyMeta:  keyMeta,
 		keyMetaC: keyMetaCommittee,
-		proof:    proof,
+		identity: identity,
 		sigSk:    keyShare,
 		encPk:    *pk,
 	}
@@ -45,6 +56,29 @@ func NewTcs(keyShare *tcrsa.KeyShare, keyMeta, keyMetaCommittee *tcrsa.KeyMeta,
 	return tcs
 }
 
+// ProposalStrategy decides which transactions of the mempool a node proposes in a round.
+type ProposalStrategy int
+
+const (
+	// ProposeRandom samples the proposals from the oldest transactions of the mempool. Nodes with
+	// the same transactions often propose the same ones.
+	ProposeRandom ProposalStrategy = iota
+	// ProposeByHash partitions the transactions by their hash modulo n. A node proposes the
+	// transactions of its own partition and only samples other transactions if its partition is
+	// short of transactions. The small and the large proposal of a round don't overlap.
+	ProposeByHash
+)
+
+func (s ProposalStrategy) String() string {
+	switch s {
+	case ProposeRandom:
+		return "random"
+	case ProposeByHash:
+		return "hash"
+	default:
+		return fmt.Sprintf("ProposalStrategy(%d)", int(s))
+	}
+}
 
 type ABCConfig struct {
 	n            int                 // Number of nodes
@@ -57,12 +91,26 @@ type ABCConfig struct {
 	lambda       int                 // spacing paramter
 	epsilon      int                 //
 	committee    map[int]bool        // List of committee members
-	txSize       int                 // Transaction size in bytes
+	minTxSize    int                 // Minimum transaction size in bytes
+	maxTxSize    int                 // Maximum transaction size in bytes, 0 for no limit
+	decTimeout   time.Duration       // Time after which a node catches up on a block it is missing
+	mempoolCap   int                 // Maximum number of transactions in the mempool
+	mempoolTTL   time.Duration       // Maximum time a transaction is kept in the mempool
+	proposal     ProposalStrategy    // Strategy for choosing the transactions to propose
+	batchSize    int                 // Number of transactions in the large pre-block message of a node
+	window       int                 // Number of oldest transactions in the mempool proposals are sampled from
+	blockBytes   int                 // Maximum size of the large pre-block message of a node, 0 for no limit
+	gossipFanout int                 // Number of peers new transactions are announced to, 0 disables gossip
+	gossipRate   int                 // Transactions per second handled per peer in the gossip
+	envelopes    bool                // Transactions must be envelopes signed by a client
+	clientEnc    bool                // Transactions are submitted encrypted by the clients
+	plaintext    bool                // Transactions are proposed without encryption
 	leaderFunc   func(r, n int) int  // Function for electing a leader
 	handlerFuncs *utils.HandlerFuncs // Communication handler
 }
 
-func NewABCConfig(n, nodeId, ta, ts, kappa, delta, lambda, epsilon, txSize int, committee map[int]bool, leaderFunc func(r, n int) int, handlerFuncs *utils.HandlerFuncs) *ABCConfig {
+// NewABCConfig returns the parameters of a node. Transactions can be up to maxTxSize bytes large.
+func NewABCConfig(n, nodeId, ta, ts, kappa, delta, lambda, epsilon, maxTxSize int, committee map[int]bool, leaderFunc func(r, n int) int, handlerFuncs *utils.HandlerFuncs) *ABCConfig {
 	return &ABCConfig{
 		n:            n,
 		NodeId:       nodeId,
@@ -73,14 +121,97 @@ func NewABCConfig(n, nodeId, ta, ts, kappa, delta, lambda, epsilon, txSize int,
 		lambda:       lambda,
 		epsilon:      epsilon,
 		committee:    committee,
-		txSize:       txSize,
+		maxTxSize:    maxTxSize,
 		leaderFunc:   leaderFunc,
 		handlerFuncs: handlerFuncs,
 	}
 }
 
+// SetDecryptionTimeout sets the time a node waits for the pre-block and the decryption shares
+// after the output of a round is known. When it expires the node keeps waiting, but also tries to
+// catch up on the block from its peers every d. A node never finishes a round with only the
+// transactions it could decrypt, since its block would differ from the blocks of the other nodes.
+// A round that waits for the block of the previous round catches up on it every d as well.
+func (cfg *ABCConfig) SetDecryptionTimeout(d time.Duration) {
+	cfg.decTimeout = d
+}
+
+// SetTxSizeLimits sets the minimum and maximum size of a transaction in bytes. Transactions of
+// other sizes aren't admitted to the mempool. A maximum of 0 only limits the size by the size of
+// the encryption key.
+func (cfg *ABCConfig) SetTxSizeLimits(min, max int) {
+	cfg.minTxSize = min
+	cfg.maxTxSize = max
+}
+
+// SetMempoolLimits sets the capacity of the mempool and the time after which transactions that
+// weren't included in a block are dropped. When the mempool is full the oldest transaction is
+// evicted. A negative value disables the respective limit.
+func (cfg *ABCConfig) SetMempoolLimits(capacity int, ttl time.Duration) {
+	cfg.mempoolCap = capacity
+	cfg.mempoolTTL = ttl
+}
+
+// SetProposalStrategy sets the strategy for choosing the transactions a node proposes. The default
+// is ProposeRandom.
+func (cfg *ABCConfig) SetProposalStrategy(s ProposalStrategy) {
+	cfg.proposal = s
+}
+
+// SetBatchLimits sets the number of transactions a node proposes in its large pre-block message,
+// the number of oldest transactions in the mempool they are sampled from and the maximum size of
+// the message in bytes. A batch size or window of 0 uses the default of n and n*n*kappa
+// transactions, a maximum size of 0 doesn't limit the size. Every node has to use the same limits,
+// since messages exceeding them are dropped.
+func (cfg *ABCConfig) SetBatchLimits(batchSize, window, blockBytes int) {
+	cfg.batchSize = batchSize
+	cfg.window = window
+	cfg.blockBytes = blockBytes
+}
+
+// SetGossip enables the transaction gossip. New transactions are announced to fanout random peers
+// and every peer may announce, request or send rate transactions per second. A rate of 0 uses the
+// default rate.
+func (cfg *ABCConfig) SetGossip(fanout, rate int) {
+	cfg.gossipFanout = fanout
+	cfg.gossipRate = rate
+}
+
+// SetEnvelopes requires every transaction to be an envelope signed by a client. Envelopes with an
+// invalid signature are rejected and every nonce of a client is only included once in the ledger.
+func (cfg *ABCConfig) SetEnvelopes(required bool) {
+	cfg.envelopes = required
+}
+
+// SetClientEncryption requires every transaction to be encrypted by a Client. Nodes propose the
+// ciphertexts as they were submitted and check the size, the validity and the nonce of a
+// transaction only after it was decrypted.
+func (cfg *ABCConfig) SetClientEncryption(required bool) {
+	cfg.clientEnc = required
+}
+
+// SetPlaintextMode disables the threshold encryption for measuring the consensus alone. Nodes
+// propose the frames of the transactions unencrypted and build the block without exchanging
+// decryption shares. It gives up censorship resistance and must only be used for benchmarks. Client
+// encryption can't be used in plaintext mode.
+func (cfg *ABCConfig) SetPlaintextMode(enabled bool) {
+	cfg.plaintext = enabled
+}
+
+// EncryptionMode returns how transactions are encrypted: "plaintext", "client" or "node".
+func (cfg *ABCConfig) EncryptionMode() string {
+	switch {
+	case cfg.plaintext:
+		return "plaintext"
+	case cfg.clientEnc:
+		return "client"
+	default:
+		return "node"
+	}
+}
+
 func setupBLA(UROUND int, cfg *ABCConfig, tcs *tcs, ts int) *bla.BlockAgreement {
-	return bla.NewBlockAgreement(UROUND, cfg.n, cfg.NodeId, ts, cfg.kappa, nil, tcs.sigSk, tcs.keyMeta, cfg.leaderFunc, cfg.delta, cfg.handlerFuncs)
+	return bla.NewBlockAgreement(UROUND, cfg.n, cfg.NodeId, ts, cfg.kappa, nil, tcs.identity, cfg.leaderFunc, cfg.delta, cfg.handlerFuncs)
 }
 
 func setupACS(UROUND int, cfg *ABCConfig, tcs *tcs, ta int) *acs.CommonSubset {
@@ -97,7 +228,7 @@ func setupACS(UROUND int, cfg *ABCConfig, tcs *tcs, ta int) *acs.CommonSubset {
 	t := &acs.ThresholdCrypto{
 		Sk:       tcs.sigSk,
 		KeyMeta:  tcs.keyMeta,
-		Proof:    tcs.proof,
+		Identity: tcs.identity,
 		KeyMetaC: tcs.keyMetaC,
 		SkC:      nil,
 	}
@@ -111,10 +242,6 @@ func setupACS(UROUND int, cfg *ABCConfig, tcs *tcs, ta int) *acs.CommonSubset {
 // Returns n instances of rbc
 func setupRBC(UROUND int, cfg *ABCConfig, tcs *tcs, ta int) []*rbc.ReliableBroadcast {
 	rbcs := make([]*rbc.ReliableBroadcast, cfg.n)
-	sig := &rbc.Signature{
-		Proof:   tcs.proof,
-		KeyMeta: tcs.keyMeta,
-	}
 	for i := 0; i < cfg.n; i++ {
 		config := &rbc.ReliableBroadcastConfig{
 			UROUND:   UROUND,
@@ -126,7 +253,7 @@ func setupRBC(UROUND int, cfg *ABCConfig, tcs *tcs, ta int) []*rbc.ReliableBroad
 			SenderId: i,
 			Instance: i,
 		}
-		rbcs[i] = rbc.NewReliableBroadcast(config, cfg.committee, sig, cfg.handlerFuncs)
+		rbcs[i] = rbc.NewReliableBroadcast(config, cfg.committee, tcs.identity, cfg.handlerFuncs)
 	}
 	return rbcs
 }
@@ -136,6 +263,7 @@ func setupABA(UROUND int, cfg *ABCConfig, tcs *tcs, ta int) []*aba.BinaryAgreeme
 	tc := &aba.ThresholdCrypto{
 		KeyShare: tcs.sigSk,
 		KeyMeta:  tcs.keyMeta,
+		Hash:     tcs.sigHash(),
 	}
 	abas := make([]*aba.BinaryAgreement, cfg.n)
 	for i := 0; i < cfg.n; i++ {
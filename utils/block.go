@@ -1,17 +1,31 @@
 package utils
 
 import (
-	"crypto"
-	"crypto/sha256"
+	"errors"
+	"fmt"
 
 	"github.com/niclabs/tcrsa"
 )
 
+// Domain of the signatures on pre-block messages
+const preBlockMessageDomain = "pre-block-message"
+
 type Block struct {
+	Header *BlockHeader
 	Txs [][]byte
 	TxsCount int
 }
 
+// BlockHeader links a block to its parent and commits to the transactions of the block.
+type BlockHeader struct {
+	Round      int
+	Height     int             // Number of blocks before this block in the ledger
+	ParentHash [32]byte        // Hash of the header of the parent block, zero for the first block
+	TxRoot     [32]byte        // Merkle root of the ordered transactions
+	Path       string          // Protocol that agreed on the block: "bla" or "acs"
+	PointerSig tcrsa.Signature // Committee signature of the block pointer, if agreed on with BLA
+}
+
 type PreBlock struct {
 	Vec []*PreBlockMessage
 	Size string
@@ -19,7 +33,7 @@ type PreBlock struct {
 
 type PreBlockMessage struct {
 	Message []byte
-	Sig     *tcrsa.SigShare
+	Sig     []byte // Signature of the sender on the message
 }
 
 type BlockPointer struct {
@@ -32,14 +46,66 @@ type BlockShare struct {
 	Pointer *BlockPointer
 }
 
-// Hash returns a sha256 hash of the block
+// Hash returns the hash of the header of the block. A block without header is identified by the
+// Merkle root of its transactions.
 func (block *Block) Hash() [32]byte {
-	var ret []byte
-	for _, tx := range block.Txs {
-		ret = append(ret, tx...)
+	if block.Header == nil {
+		return MerkleRoot(block.Txs)
 	}
-	hash := sha256.Sum256(ret)
-	return hash
+	return block.Header.Hash()
+}
+
+// NewBlockHeader returns the header of a block of round r with the transactions txs. parent is the
+// header of the previous block in the ledger, nil for the first block.
+func NewBlockHeader(r int, parent *BlockHeader, txs [][]byte, path string, pointerSig tcrsa.Signature) *BlockHeader {
+	header := &BlockHeader{
+		Round:      r,
+		TxRoot:     MerkleRoot(txs),
+		Path:       path,
+		PointerSig: pointerSig,
+	}
+	if parent != nil {
+		header.Height = parent.Height + 1
+		header.ParentHash = parent.Hash()
+	}
+	return header
+}
+
+// Hash returns a sha256 hash over all fields of the header.
+func (h *BlockHeader) Hash() [32]byte {
+	return NewEncoder(blockHeaderHashDomain).
+		Int(h.Round).
+		Int(h.Height).
+		Hash(h.ParentHash).
+		Hash(h.TxRoot).
+		String(h.Path).
+		Bytes(h.PointerSig).
+		Sum()
+}
+
+// Verify returns an error if the transactions of the block don't match its header or if the block
+// isn't a child of parent. parent is nil for the first block.
+func (block *Block) Verify(parent *BlockHeader) error {
+	h := block.Header
+	if h == nil {
+		return errors.New("block has no header")
+	}
+	if h.TxRoot != MerkleRoot(block.Txs) {
+		return errors.New("transactions don't match the header")
+	}
+	if parent == nil {
+		if h.Height != 0 || h.ParentHash != ([32]byte{}) {
+			return errors.New("first block has a parent")
+		}
+		return nil
+	}
+	if h.ParentHash != parent.Hash() {
+		return errors.New("parent hash doesn't match the previous block")
+	}
+	if h.Height != parent.Height+1 || h.Round <= parent.Round {
+		return fmt.Errorf("block of round %d at height %d can't follow round %d at height %d", h.Round, h.Height, parent.Round, parent.Height)
+	}
+	return nil
 }
 
 // Print appends all transactions and returns them as one byte array
@@ -70,36 +136,36 @@ func (pre *PreBlock) Quality() (counter int) {
 	return counter
 }
 
-// Concatenates all the messages and signatures and takes the hash of that byte array.
+// Hash returns a sha256 hash over the size and all slots of the pre-block. Every slot is encoded
+// with its index, so messages can't be moved to other slots without changing the hash.
 func (pre *PreBlock) Hash() [32]byte {
-	var ret []byte
-	for _, m := range pre.Vec {
+	e := NewEncoder(preBlockHashDomain).String(pre.Size).Int(len(pre.Vec))
+	for i, m := range pre.Vec {
+		e.Int(i).Bool(m != nil)
 		if m != nil {
-			// append message and signature
-			b := append(m.Message, m.Sig.Xi...)
-			ret = append(ret, b...)
+			e.Bytes(m.Message).Bytes(m.Sig)
 		}
 	}
-	hash := sha256.Sum256(ret)
-	return hash
+	return e.Sum()
 }
 
-// Concatenates BlockHash and Sig which are both byte slices and returns the hash of the combined a
-// slice.
+// Hash returns a sha256 hash over the block hash and the signature of the pointer.
 func (ptr *BlockPointer) Hash() [32]byte {
-	h := append(ptr.BlockHash, ptr.Sig...)
-	hash := sha256.Sum256(h)
-	return hash
+	return NewEncoder(blockPointerHashDomain).Bytes(ptr.BlockHash).Bytes(ptr.Sig).Sum()
 }
 
-// Concatenates the hashes of the block and block pointer and returns the hash of those combined
-// byte slices.
+// Hash returns a sha256 hash over the hashes of the pre-block and the block pointer. Missing parts
+// are encoded as absent.
 func (bs *BlockShare) Hash() [32]byte {
-	pointerHash := bs.Pointer.Hash()
-	blockHash := bs.Block.Hash()
-	h := append(pointerHash[:], blockHash[:]...)
-	hash := sha256.Sum256(h)
-	return hash
+	e := NewEncoder(blockShareHashDomain).Bool(bs.Block != nil)
+	if bs.Block != nil {
+		e.Hash(bs.Block.Hash())
+	}
+	e.Bool(bs.Pointer != nil)
+	if bs.Pointer != nil {
+		e.Hash(bs.Pointer.Hash())
+	}
+	return e.Sum()
 }
 
 // Returns a new empty pre-block of size n
@@ -129,20 +195,23 @@ func NewBlockShare(block *PreBlock, pointer *BlockPointer) *BlockShare {
 	}
 }
 
-// Returns a new pre-block message
-func NewPreBlockMessage(mes []byte, keyShare *tcrsa.KeyShare, keyMeta *tcrsa.KeyMeta) (*PreBlockMessage, error) {
-	mesHash := sha256.Sum256(mes)
-	mesHashPadded, err := tcrsa.PrepareDocumentHash(keyMeta.PublicKey.Size(), crypto.SHA256, mesHash[:])
-	if err != nil {
-		return nil, err
-	}
-	sig, err := keyShare.Sign(mesHashPadded, crypto.SHA256, keyMeta)
-	if err != nil {
-		return nil, err
-	}
-	preBlockMes := &PreBlockMessage{
+// Returns a new pre-block message signed with the identity key of the node
+func NewPreBlockMessage(mes []byte, status string, identity *Identity) *PreBlockMessage {
+	hash := PreBlockMessageHash(identity.NodeId, status, mes)
+	return &PreBlockMessage{
 		Message: mes,
-		Sig:     sig,
+		Sig:     identity.Sign(preBlockMessageDomain, hash),
 	}
-	return preBlockMes, nil
+}
+
+// PreBlockMessageHash returns a sha256 hash over the sender, the status ("large" or "small") and
+// the message.
+func PreBlockMessageHash(sender int, status string, mes []byte) [32]byte {
+	return NewEncoder(preBlockMessageHashDomain).Int(sender).String(status).Bytes(mes).Sum()
+}
+
+// Verify returns whether the pre-block message was signed by node sender.
+func (m *PreBlockMessage) Verify(sender int, status string, cert *MembershipCertificate) bool {
+	hash := PreBlockMessageHash(sender, status, m.Message)
+	return cert.VerifySig(sender, preBlockMessageDomain, hash, m.Sig)
 }
@@ -37,8 +37,12 @@ func TestPreBlock(t *testing.T) {
 
 	t.Run("Check if pre-block gets hashed", func(t *testing.T) {
 		keyShares, keyMeta, _ := tcrsa.NewKey(512, uint16(2), uint16(2), nil)
-		preBlockMessage1, _ := NewPreBlockMessage([]byte("foo"), keyShares[0], keyMeta)
-		preBlockMessage2, _ := NewPreBlockMessage([]byte("bar"), keyShares[1], keyMeta)
+		identities, err := NewIdentities(2, 0, map[int]bool{0: true}, keyShares, keyMeta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		preBlockMessage1 := NewPreBlockMessage([]byte("foo"), "small", identities[0])
+		preBlockMessage2 := NewPreBlockMessage([]byte("bar"), "small", identities[1])
 
 		block1 := NewPreBlock(3)
 		block2 := NewPreBlock(3)
@@ -57,3 +61,54 @@ func TestPreBlock(t *testing.T) {
 		}
 	})
 }
+
+func TestBlockHeader(t *testing.T) {
+	txs := [][]byte{[]byte("foo"), []byte("bar"), []byte("baz")}
+	first := &Block{
+		Txs: txs,
+	}
+	first.Header = NewBlockHeader(0, nil, first.Txs, "acs", nil)
+	second := &Block{
+		Txs: [][]byte{[]byte("qux")},
+	}
+	second.Header = NewBlockHeader(1, first.Header, second.Txs, "bla", []byte{1})
+
+	t.Run("Accepts a valid chain", func(t *testing.T) {
+		if err := first.Verify(nil); err != nil {
+			t.Errorf("First block is invalid: %s", err)
+		}
+		if err := second.Verify(first.Header); err != nil {
+			t.Errorf("Second block is invalid: %s", err)
+		}
+		if second.Header.Height != 1 || second.Header.ParentHash != first.Hash() {
+			t.Errorf("Second block doesn't point to the first block")
+		}
+	})
+
+	t.Run("Detects tampering", func(t *testing.T) {
+		reordered := &Block{
+			Header: first.Header,
+			Txs:    [][]byte{txs[1], txs[0], txs[2]},
+		}
+		if err := reordered.Verify(nil); err == nil {
+			t.Errorf("Block with reordered transactions is valid")
+		}
+		parent := *first.Header
+		parent.Path = "bla"
+		if err := second.Verify(&parent); err == nil {
+			t.Errorf("Block with modified parent is valid")
+		}
+		if err := second.Verify(second.Header); err == nil {
+			t.Errorf("Block is valid as its own child")
+		}
+	})
+
+	t.Run("Merkle root depends on the split of transactions", func(t *testing.T) {
+		if MerkleRoot([][]byte{[]byte("ab"), []byte("c")}) == MerkleRoot([][]byte{[]byte("a"), []byte("bc")}) {
+			t.Errorf("Different transactions have the same Merkle root")
+		}
+		if MerkleRoot(txs[:1]) == MerkleRoot(nil) {
+			t.Errorf("Single transaction has the root of no transactions")
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// Domains of the hashes of the types in this package. Every hash starts with its domain, so hashes
+// of different types never collide.
+const (
+	preBlockHashDomain        = "tardigrade/pre-block"
+	preBlockMessageHashDomain = "tardigrade/pre-block-message"
+	blockPointerHashDomain    = "tardigrade/block-pointer"
+	blockShareHashDomain      = "tardigrade/block-share"
+	blockHeaderHashDomain     = "tardigrade/block-header"
+	certificateHashDomain     = "tardigrade/membership-certificate"
+	coinHashDomain            = "tardigrade/coin"
+	signedDataDomain          = "tardigrade/signed-data"
+)
+
+// Encoder builds the canonical encoding of a value that gets hashed. The encoding starts with the
+// domain, integers are encoded with 8 bytes and byte slices and strings are prefixed with their
+// length. Optional values are prefixed with a presence flag. Therefore the encoding is injective
+// for values of the same domain as long as the fields are always written in the same order.
+type Encoder struct {
+	buf []byte
+}
+
+// NewEncoder returns an encoder for a value of the given domain.
+func NewEncoder(domain string) *Encoder {
+	e := &Encoder{
+		buf: make([]byte, 0, 64),
+	}
+	return e.String(domain)
+}
+
+// Int appends an integer.
+func (e *Encoder) Int(i int) *Encoder {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(i))
+	e.buf = append(e.buf, b[:]...)
+	return e
+}
+
+// Bool appends a boolean.
+func (e *Encoder) Bool(b bool) *Encoder {
+	if b {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+	return e
+}
+
+// Bytes appends a byte slice prefixed with its length.
+func (e *Encoder) Bytes(b []byte) *Encoder {
+	e.Int(len(b))
+	e.buf = append(e.buf, b...)
+	return e
+}
+
+// String appends a string prefixed with its length.
+func (e *Encoder) String(s string) *Encoder {
+	e.Int(len(s))
+	e.buf = append(e.buf, s...)
+	return e
+}
+
+// Hash appends a hash. Hashes have a fixed size and aren't prefixed with their length.
+func (e *Encoder) Hash(h [32]byte) *Encoder {
+	e.buf = append(e.buf, h[:]...)
+	return e
+}
+
+// Encoded returns the encoding built so far.
+func (e *Encoder) Encoded() []byte {
+	return e.buf
+}
+
+// Sum returns the sha256 hash of the encoding.
+func (e *Encoder) Sum() [32]byte {
+	return sha256.Sum256(e.buf)
+}
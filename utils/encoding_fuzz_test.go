@@ -0,0 +1,39 @@
+//go:build go1.18
+// +build go1.18
+
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzEncoder(f *testing.F) {
+	f.Add("small", []byte("ab"), []byte("c"), "small", []byte("a"), []byte("bc"))
+	f.Add("", []byte{}, []byte{0}, "", []byte{0}, []byte{})
+	f.Fuzz(func(t *testing.T, s1 string, a1, b1 []byte, s2 string, a2, b2 []byte) {
+		e1 := NewEncoder("fuzz").String(s1).Bytes(a1).Bytes(b1).Encoded()
+		e2 := NewEncoder("fuzz").String(s2).Bytes(a2).Bytes(b2).Encoded()
+		equal := s1 == s2 && bytes.Equal(a1, a2) && bytes.Equal(b1, b2)
+		if bytes.Equal(e1, e2) != equal {
+			t.Errorf("Encoding isn't injective: (%q, %x, %x) and (%q, %x, %x)", s1, a1, b1, s2, a2, b2)
+		}
+	})
+}
+
+func FuzzPreBlockHash(f *testing.F) {
+	f.Add(uint8(3), uint8(1), []byte("foo"), []byte("sig"), uint8(2), []byte("foo"), []byte("sig"))
+	f.Add(uint8(2), uint8(0), []byte("foos"), []byte("ig"), uint8(0), []byte("foo"), []byte("sig"))
+	f.Fuzz(func(t *testing.T, n, i1 uint8, m1, s1 []byte, i2 uint8, m2, s2 []byte) {
+		size := int(n%8) + 1
+		slot1, slot2 := int(i1)%size, int(i2)%size
+		pre1 := NewPreBlock(size)
+		pre1.AddMessage(slot1, &PreBlockMessage{Message: m1, Sig: s1})
+		pre2 := NewPreBlock(size)
+		pre2.AddMessage(slot2, &PreBlockMessage{Message: m2, Sig: s2})
+		equal := slot1 == slot2 && bytes.Equal(m1, m2) && bytes.Equal(s1, s2)
+		if (pre1.Hash() == pre2.Hash()) != equal {
+			t.Errorf("Pre-blocks with slot %d (%x, %x) and slot %d (%x, %x) have colliding hashes", slot1, m1, s1, slot2, m2, s2)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	t.Run("Encodes fields canonically", func(t *testing.T) {
+		got := NewEncoder("test").Int(1).Bool(true).Bytes([]byte("ab")).String("c").Hash([32]byte{1}).Encoded()
+		expected := "0000000000000004" + hex.EncodeToString([]byte("test")) +
+			"0000000000000001" +
+			"01" +
+			"0000000000000002" + hex.EncodeToString([]byte("ab")) +
+			"0000000000000001" + hex.EncodeToString([]byte("c")) +
+			"01" + "00000000000000000000000000000000000000000000000000000000000000"
+		if hex.EncodeToString(got) != expected {
+			t.Errorf("Got encoding %x, expected %s", got, expected)
+		}
+	})
+
+	t.Run("Encoding depends on the split of fields", func(t *testing.T) {
+		a := NewEncoder("test").Bytes([]byte("ab")).Bytes([]byte("c")).Encoded()
+		b := NewEncoder("test").Bytes([]byte("a")).Bytes([]byte("bc")).Encoded()
+		if bytes.Equal(a, b) {
+			t.Errorf("Different fields have the same encoding")
+		}
+		if NewEncoder("a").Sum() == NewEncoder("b").Sum() {
+			t.Errorf("Different domains have the same hash")
+		}
+	})
+}
+
+func TestHashVectors(t *testing.T) {
+	pre := NewPreBlock(3)
+	pre.Size = "small"
+	pre.AddMessage(1, &PreBlockMessage{Message: []byte("foo"), Sig: []byte("sig")})
+	ptr := &BlockPointer{BlockHash: []byte("hash"), Sig: []byte("sig")}
+	header := &BlockHeader{Round: 1, Height: 1, ParentHash: [32]byte{1}, TxRoot: [32]byte{2}, Path: "acs"}
+
+	// The hashes are signed by the nodes, so they must never change between versions
+	vectors := []struct {
+		name     string
+		hash     [32]byte
+		expected string
+	}{
+		{"block header", header.Hash(), "772acb1c82ce8fdb7f7e7c59ad784adca01fe6e5c588dab56d3f5b765898be70"},
+		{"pre-block", pre.Hash(), "45aa7619c22ba2edf3a355baf252ea601d4ca5eb8518a8df37499b202f09f5da"},
+		{"pre-block message", PreBlockMessageHash(2, "large", []byte("foo")), "2119a1876c78dd0ea63dd29a1dfbc9374add5acb887809e9e37b0faa89087f85"},
+		{"block pointer", ptr.Hash(), "eb16681252bd1d393f8d05429d389a3825e0c53d0ab188ee0ca14705d22a980a"},
+		{"block share", (&BlockShare{Block: pre, Pointer: ptr}).Hash(), "d3cb0f85e5e36d630f0ef2947e75a70be0a561a80adb3a552a5b1ed3a7f3246a"},
+		{"empty block share", (&BlockShare{}).Hash(), "3296a9e6e3851a1b972672dac74ba47f96f972bb941f2517de4c09f1b66557cf"},
+		{"coin", CoinHash(1, 2), "64ad806e90cefa6872daba789d21c93c38e3f04eb8186be807e18586eeeaf784"},
+	}
+	for _, v := range vectors {
+		if got := hex.EncodeToString(v.hash[:]); got != v.expected {
+			t.Errorf("Got %s hash %s, expected %s", v.name, got, v.expected)
+		}
+	}
+
+	t.Run("Messages are bound to their slot", func(t *testing.T) {
+		moved := NewPreBlock(3)
+		moved.Size = "small"
+		moved.AddMessage(2, pre.Vec[1])
+		if moved.Hash() == pre.Hash() {
+			t.Errorf("Moving a message to another slot doesn't change the hash")
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+
+	"github.com/niclabs/tcrsa"
+)
+
+// Identity contains the identity key of a node and the membership certificate of all nodes.
+type Identity struct {
+	NodeId int
+	Sk     ed25519.PrivateKey     // Private identity key
+	Cert   *MembershipCertificate // Certificate listing the identity keys of all nodes
+}
+
+// Member is an entry of a membership certificate.
+type Member struct {
+	NodeId    int
+	Pk        ed25519.PublicKey // Public identity key
+	Committee bool              // Whether the node is a committee member
+}
+
+// MembershipCertificate lists all nodes of an epoch with their identity keys. It is signed by the
+// dealer with the threshold key of all nodes.
+type MembershipCertificate struct {
+	Epoch   int
+	Members []*Member       // Members ordered by node id
+	SigHash crypto.Hash     // Hash function of the threshold signatures, DefaultSigHash if 0
+	Sig     tcrsa.Signature // Signature of the dealer on the hash of the certificate
+}
+
+// NewIdentities creates identity keys for n nodes and a membership certificate signed with the
+// given key shares. This is done by the dealer.
+func NewIdentities(n, epoch int, committee map[int]bool, keyShares tcrsa.KeyShareList, keyMeta *tcrsa.KeyMeta) ([]*Identity, error) {
+	return NewIdentitiesWithHash(n, epoch, committee, DefaultSigHash, keyShares, keyMeta)
+}
+
+// NewIdentitiesWithHash is like NewIdentities, but the nodes use the hash function h for all
+// threshold signatures.
+func NewIdentitiesWithHash(n, epoch int, committee map[int]bool, h crypto.Hash, keyShares tcrsa.KeyShareList, keyMeta *tcrsa.KeyMeta) ([]*Identity, error) {
+	sks := make([]ed25519.PrivateKey, n)
+	cert := &MembershipCertificate{
+		Epoch:   epoch,
+		Members: make([]*Member, n),
+		SigHash: h,
+	}
+	for i := 0; i < n; i++ {
+		pk, sk, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return nil, err
+		}
+		sks[i] = sk
+		cert.Members[i] = &Member{
+			NodeId:    i,
+			Pk:        pk,
+			Committee: committee[i],
+		}
+	}
+	if err := cert.sign(keyShares, keyMeta); err != nil {
+		return nil, err
+	}
+
+	identities := make([]*Identity, n)
+	for i := 0; i < n; i++ {
+		identities[i] = &Identity{
+			NodeId: i,
+			Sk:     sks[i],
+			Cert:   cert,
+		}
+	}
+	return identities, nil
+}
+
+// Hash returns a sha256 hash over the epoch and all members of the certificate.
+func (c *MembershipCertificate) Hash() [32]byte {
+	e := NewEncoder(certificateHashDomain).Int(c.Epoch).Int(int(c.SigHash)).Int(len(c.Members))
+	for _, m := range c.Members {
+		e.Int(m.NodeId).Bytes(m.Pk).Bool(m.Committee)
+	}
+	return e.Sum()
+}
+
+// sign signs the certificate with the first k key shares.
+func (c *MembershipCertificate) sign(keyShares tcrsa.KeyShareList, keyMeta *tcrsa.KeyMeta) error {
+	hash := c.Hash()
+	paddedHash, err := PrepareSigHash(keyMeta, c.SignatureHash(), hash[:])
+	if err != nil {
+		return err
+	}
+	if len(keyShares) < int(keyMeta.K) {
+		return errors.New("not enough key shares to sign the membership certificate")
+	}
+	sigShares := make(tcrsa.SigShareList, keyMeta.K)
+	for i := 0; i < int(keyMeta.K); i++ {
+		sigShares[i], err = keyShares[i].Sign(paddedHash, c.SignatureHash(), keyMeta)
+		if err != nil {
+			return err
+		}
+	}
+	c.Sig, err = sigShares.Join(paddedHash, keyMeta)
+	return err
+}
+
+// Verify returns an error if the certificate is malformed or not signed by the dealer.
+func (c *MembershipCertificate) Verify(keyMeta *tcrsa.KeyMeta) error {
+	for i, m := range c.Members {
+		if m == nil || m.NodeId != i || len(m.Pk) != ed25519.PublicKeySize {
+			return fmt.Errorf("malformed membership certificate entry %d", i)
+		}
+	}
+	hash := c.Hash()
+	if err := VerifyThresholdSig(keyMeta, c.SignatureHash(), hash[:], c.Sig); err != nil {
+		return fmt.Errorf("invalid signature on membership certificate: %w", err)
+	}
+	return nil
+}
+
+// SignatureHash returns the hash function of the threshold signatures chosen by the dealer.
+func (c *MembershipCertificate) SignatureHash() crypto.Hash {
+	if c.SigHash == 0 {
+		return DefaultSigHash
+	}
+	return c.SigHash
+}
+
+// IsMember returns whether node id is listed in the certificate.
+func (c *MembershipCertificate) IsMember(id int) bool {
+	return id >= 0 && id < len(c.Members)
+}
+
+// IsCommittee returns whether node id is a committee member.
+func (c *MembershipCertificate) IsCommittee(id int) bool {
+	return c.IsMember(id) && c.Members[id].Committee
+}
+
+// Committee returns the committee members listed in the certificate.
+func (c *MembershipCertificate) Committee() map[int]bool {
+	committee := make(map[int]bool)
+	for _, m := range c.Members {
+		if m != nil && m.Committee {
+			committee[m.NodeId] = true
+		}
+	}
+	return committee
+}
+
+// CommitteeIndex returns the position of node id among the committee members ordered by node id.
+// The dealer hands out the key shares of the committee in this order, so the key share of a
+// member has the index CommitteeIndex+1. It returns false if the node isn't a committee member.
+func CommitteeIndex(committee map[int]bool, id int) (int, bool) {
+	if !committee[id] {
+		return 0, false
+	}
+	index := 0
+	for member, ok := range committee {
+		if ok && member < id {
+			index++
+		}
+	}
+	return index, true
+}
+
+// Sign signs a hash. The domain separates signatures of different message types.
+func (id *Identity) Sign(domain string, hash [32]byte) []byte {
+	return ed25519.Sign(id.Sk, signedData(domain, hash))
+}
+
+// VerifySig returns whether sig is a valid signature of node sender on a hash.
+func (c *MembershipCertificate) VerifySig(sender int, domain string, hash [32]byte, sig []byte) bool {
+	if !c.IsMember(sender) || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(c.Members[sender].Pk, signedData(domain, hash), sig)
+}
+
+// signedData returns the data that gets signed for a hash in a domain.
+func signedData(domain string, hash [32]byte) []byte {
+	return NewEncoder(signedDataDomain).String(domain).Hash(hash).Encoded()
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/niclabs/tcrsa"
+)
+
+func TestMembershipCertificate(t *testing.T) {
+	n := 4
+	keyShares, keyMeta, err := tcrsa.NewKey(512, uint16(n/2+1), uint16(n), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	committee := map[int]bool{0: true, 1: true}
+	identities, err := NewIdentities(n, 1, committee, keyShares, keyMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := identities[0].Cert
+
+	t.Run("Certificate is signed by the dealer", func(t *testing.T) {
+		if err := cert.Verify(keyMeta); err != nil {
+			t.Errorf("Valid certificate got rejected: %s", err)
+		}
+		if !cert.IsCommittee(0) || !cert.IsCommittee(1) || cert.IsCommittee(2) || cert.IsCommittee(n) {
+			t.Errorf("Wrong committee members in certificate")
+		}
+	})
+
+	t.Run("Modified certificate gets rejected", func(t *testing.T) {
+		forged := &MembershipCertificate{
+			Epoch:   cert.Epoch,
+			Members: make([]*Member, n),
+			Sig:     cert.Sig,
+		}
+		copy(forged.Members, cert.Members)
+		forged.Members[2] = &Member{
+			NodeId:    2,
+			Pk:        cert.Members[2].Pk,
+			Committee: true,
+		}
+		if err := forged.Verify(keyMeta); err == nil {
+			t.Errorf("Certificate with modified committee got accepted")
+		}
+	})
+
+	t.Run("Certificate is signed with the hash chosen by the dealer", func(t *testing.T) {
+		keyShares, keyMeta, err := tcrsa.NewKey(1024, uint16(n/2+1), uint16(n), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		identities, err := NewIdentitiesWithHash(n, 1, committee, crypto.SHA512, keyShares, keyMeta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert := identities[0].Cert
+		if cert.SignatureHash() != crypto.SHA512 {
+			t.Errorf("Expected SHA-512, got %s", cert.SignatureHash())
+		}
+		if err := cert.Verify(keyMeta); err != nil {
+			t.Errorf("Valid certificate got rejected: %s", err)
+		}
+		forged := *cert
+		forged.SigHash = crypto.SHA256
+		if err := forged.Verify(keyMeta); err == nil {
+			t.Errorf("Certificate with modified hash function got accepted")
+		}
+	})
+
+	t.Run("Signatures are bound to the signer and the domain", func(t *testing.T) {
+		hash := sha256.Sum256([]byte("foo"))
+		sig := identities[1].Sign("test", hash)
+		if !cert.VerifySig(1, "test", hash, sig) {
+			t.Errorf("Valid signature got rejected")
+		}
+		if cert.VerifySig(2, "test", hash, sig) {
+			t.Errorf("Signature got accepted for the wrong signer")
+		}
+		if cert.VerifySig(1, "other", hash, sig) {
+			t.Errorf("Signature got accepted in the wrong domain")
+		}
+		if cert.VerifySig(n, "test", hash, sig) || cert.VerifySig(1, "test", hash, nil) {
+			t.Errorf("Signature of unknown node or empty signature got accepted")
+		}
+	})
+}
+
+func TestCommitteeIndex(t *testing.T) {
+	committee := map[int]bool{1: true, 3: true, 4: true, 5: false}
+	for id, expected := range map[int]int{1: 0, 3: 1, 4: 2} {
+		if index, ok := CommitteeIndex(committee, id); !ok || index != expected {
+			t.Errorf("Expected index %d for node %d, got %d %t", expected, id, index, ok)
+		}
+	}
+	for _, id := range []int{0, 2, 5} {
+		if _, ok := CommitteeIndex(committee, id); ok {
+			t.Errorf("Node %d isn't a committee member, but got an index", id)
+		}
+	}
+}
@@ -25,6 +25,7 @@ func NewLocalHandler(nodes map[int]chan *HandlerMessage, coin chan *CoinRequest,
 		acsChans: acsChans,
 		blaChans: blaChans,
 		abcChans: abcChans,
+		memChan:  make(chan *Message, 999),
 		round:    make(map[int]bool),
 		rbcLock:  sync.RWMutex{},
 		abaLock:  sync.RWMutex{},
@@ -132,6 +133,8 @@ func NewLocalHandler(nodes map[int]chan *HandlerMessage, coin chan *CoinRequest,
 			}
 			handlerChans.rbcLock.RUnlock()
 			return <-ch
+		case MEMPOOL:
+			return <-handlerChans.memChan
 		}
 		return nil
 	}
@@ -172,6 +175,13 @@ func NewLocalHandler(nodes map[int]chan *HandlerMessage, coin chan *CoinRequest,
 		return receive(ABC, UROUND)
 	}
 
+	memMulticast := func(msg *Message, receiver int) {
+		go multicast(msg, MEMPOOL, 0, 0, 0, receiver)
+	}
+	memReceive := func() *Message {
+		return receive(MEMPOOL)
+	}
+
 	coinCall := func(msg *CoinRequest) byte {
 		answer := make(chan byte, 100)
 		msg.AnswerLocal = answer
@@ -246,6 +256,12 @@ func NewLocalHandler(nodes map[int]chan *HandlerMessage, coin chan *CoinRequest,
 				}
 				rbcChans[msg.UROUND][msg.Instance] <- msg.Payload
 				handlerChans.rbcLock.RUnlock()
+			case MEMPOOL:
+				select {
+				case handlerChans.memChan <- msg.Payload:
+				default:
+					// Gossip is best effort and must not block the protocol
+				}
 			}
 		}
 	}
@@ -261,6 +277,8 @@ func NewLocalHandler(nodes map[int]chan *HandlerMessage, coin chan *CoinRequest,
 		ACSreceive:   acsReceive,
 		ABCmulticast: abcMulticast,
 		ABCreceive:   abcReceive,
+		MEMmulticast: memMulticast,
+		MEMreceive:   memReceive,
 		CoinCall:     coinCall,
 		Receiver:     receiver,
 	}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"crypto/sha256"
+)
+
+// Prefixes that separate leaves from inner nodes of a Merkle tree
+const (
+	merkleLeafPrefix  = 0
+	merkleInnerPrefix = 1
+)
+
+// MerkleRoot returns the root of a Merkle tree over the ordered transactions. A node without a
+// sibling is moved up to the next level unchanged. The root of no transactions is the hash of the
+// empty string.
+func MerkleRoot(txs [][]byte) [32]byte {
+	if len(txs) == 0 {
+		return sha256.Sum256(nil)
+	}
+	level := make([][32]byte, len(txs))
+	for i, tx := range txs {
+		level[i] = sha256.Sum256(append([]byte{merkleLeafPrefix}, tx...))
+	}
+	for len(level) > 1 {
+		next := make([][32]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			buf := make([]byte, 0, 1+2*32)
+			buf = append(buf, merkleInnerPrefix)
+			buf = append(buf, level[i][:]...)
+			buf = append(buf, level[i+1][:]...)
+			next = append(next, sha256.Sum256(buf))
+		}
+		level = next
+	}
+	return level[0]
+}
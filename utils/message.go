@@ -24,6 +24,11 @@ type CoinRequest struct {
 	Instance    int
 }
 
+// CoinHash returns the hash that is signed to request the coin of round in UROUND.
+func CoinHash(UROUND, round int) [32]byte {
+	return NewEncoder(coinHashDomain).Int(UROUND).Int(round).Sum()
+}
+
 type CoinAnswer struct {
 }
 
@@ -36,4 +41,5 @@ const (
 	ACS
 	ABC
 	COIN
+	MEMPOOL // Transaction gossip, independent of rounds
 )
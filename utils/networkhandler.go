@@ -42,6 +42,7 @@ func NewNetworkHandler(ips map[int]string, id, n, kappa int, rcfgs RoundConfigs)
 		blaChans:  blaChans,
 		abcChans:  abcChans,
 		coinChans: coinChans,
+		memChan:   make(chan *Message, 999),
 		round:     make(map[int]bool),
 		rbcLock:   sync.RWMutex{},
 		abaLock:   sync.RWMutex{},
@@ -77,12 +78,18 @@ func NewNetworkHandler(ips map[int]string, id, n, kappa int, rcfgs RoundConfigs)
 			Payload:  msg,
 		}
 		//log.Printf("Node %d UROUND %d %d -> %T\n", msg.Sender, m.UROUND, m.Origin, msg.Payload)
+		// Messages outside of the configured rounds, like gossip or the catch-up protocol, are sent
+		// without delay
+		rcfg := rcfgs[m.UROUND]
+		if m.Origin == MEMPOOL || rcfg == nil {
+			rcfg = &RoundConfig{}
+		}
 		if p[3] != -1 {
 			// Send only to one node
-			go handler.send(m, p[3], rcfgs[m.UROUND].Async, rcfgs[m.UROUND].Crashed[p[3]])
+			go handler.send(m, p[3], rcfg.Async, rcfg.Crashed[p[3]])
 		} else {
 			for i := 0; i < n; i++ {
-				go handler.send(m, i, rcfgs[m.UROUND].Async, rcfgs[m.UROUND].Crashed[i])
+				go handler.send(m, i, rcfg.Async, rcfg.Crashed[i])
 			}
 		}
 	}
@@ -169,6 +176,8 @@ func NewNetworkHandler(ips map[int]string, id, n, kappa int, rcfgs RoundConfigs)
 			}
 			handlerChans.coinLock.RUnlock()
 			return <-ch
+		case MEMPOOL:
+			return <-handlerChans.memChan
 		}
 		return nil
 	}
@@ -209,6 +218,13 @@ func NewNetworkHandler(ips map[int]string, id, n, kappa int, rcfgs RoundConfigs)
 		return receive(ABC, UROUND)
 	}
 
+	memMulticast := func(msg *Message, receiver int) {
+		go multicast(msg, MEMPOOL, 0, 0, 0, receiver)
+	}
+	memReceive := func() *Message {
+		return receive(MEMPOOL)
+	}
+
 	var coinConn *gob.Encoder
 	var coinConnLock sync.Mutex
 	coinCall := func(msg *CoinRequest) byte {
@@ -265,6 +281,8 @@ func NewNetworkHandler(ips map[int]string, id, n, kappa int, rcfgs RoundConfigs)
 		ACSreceive:   acsReceive,
 		ABCmulticast: abcMulticast,
 		ABCreceive:   abcReceive,
+		MEMmulticast: memMulticast,
+		MEMreceive:   memReceive,
 		CoinCall:     coinCall,
 		Receiver:     receiver,
 	}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"fmt"
+
+	"github.com/niclabs/tcrsa"
+)
+
+// DefaultSigHash is the hash function of threshold signatures if none was chosen by the dealer.
+const DefaultSigHash = crypto.SHA256
+
+// SigDigest returns the digest of a message hash that is signed with hash function h. Message
+// hashes are sha256 hashes, so with SHA-256 the hash itself is signed. Other hash functions hash
+// it again to get a digest of their size.
+func SigDigest(h crypto.Hash, hash []byte) []byte {
+	if h == crypto.SHA256 {
+		return hash
+	}
+	d := h.New()
+	d.Write(hash)
+	return d.Sum(nil)
+}
+
+// PrepareSigHash returns the padded digest of a message hash for signing it with a threshold RSA
+// key of keyMeta and hash function h.
+func PrepareSigHash(keyMeta *tcrsa.KeyMeta, h crypto.Hash, hash []byte) ([]byte, error) {
+	if !h.Available() {
+		return nil, fmt.Errorf("unsupported hash function %d", h)
+	}
+	return tcrsa.PrepareDocumentHash(keyMeta.PublicKey.Size(), h, SigDigest(h, hash))
+}
+
+// VerifyThresholdSig returns an error if sig isn't a valid signature of keyMeta on the message hash
+// with hash function h.
+func VerifyThresholdSig(keyMeta *tcrsa.KeyMeta, h crypto.Hash, hash, sig []byte) error {
+	if !h.Available() {
+		return fmt.Errorf("unsupported hash function %d", h)
+	}
+	return rsa.VerifyPKCS1v15(keyMeta.PublicKey, h, SigDigest(h, hash), sig)
+}
@@ -18,6 +18,8 @@ type HandlerFuncs struct {
 	ACSreceive   func(UROUND int) *Message
 	ABCmulticast func(msg *Message, UROUND int, receiver int)
 	ABCreceive   func(UROUND int) *Message
+	MEMmulticast func(msg *Message, receiver int)
+	MEMreceive   func() *Message
 	CoinCall     func(msg *CoinRequest) byte
 	Receiver     func()
 }
@@ -29,6 +31,7 @@ type HandlerChans struct {
 	blaChans  map[int]map[int]chan *Message   // UROUND -> round -> channel
 	abcChans  map[int]chan *Message           // UROUND -> channel
 	coinChans map[int]map[int][]chan *Message // UROUND -> round -> instance -> channel
+	memChan   chan *Message                   // Transaction gossip
 	round     map[int]bool                    // Maximum round for which the channels are set
 	rbcLock   sync.RWMutex
 	abaLock   sync.RWMutex
@@ -167,6 +170,12 @@ func (h *HandlerChans) listener(id, n, kappa int, c net.Conn) {
 			h.rbcLock.RLock()
 			h.rbcChans[msg.UROUND][msg.Instance] <- msg.Payload
 			h.rbcLock.RUnlock()
+		case MEMPOOL:
+			select {
+			case h.memChan <- msg.Payload:
+			default:
+				// Gossip is best effort and must not block the protocol
+			}
 		case COIN:
 			// Check if there are channels for the current round.
 			h.coinLock.Lock()